@@ -0,0 +1,48 @@
+package main
+
+// flag parsing (audit file path), hash chain verification, reporting first broken entry
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/auditor"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run returns 0 if chain is intact, 1 if it is broken, 2 on usage or read error
+func run(args []string, out, errOut io.Writer) int {
+	fs := flag.NewFlagSet("auditVerify", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	path := fs.String("file", "audit.log", "audit log file")
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+
+	n, last, err := auditor.VerifyFile(*path)
+	ce := &auditor.ChainError{}
+	if errors.As(err, &ce) {
+		fmt.Fprintf(out, "chain is broken at line %d: %s, %d entries before it are intact\n", ce.Line, ce.Reason, n)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 2
+	}
+	if n == 0 {
+		fmt.Fprintln(out, "chain is intact: no entries")
+		return 0
+	}
+	fmt.Fprintf(out, "chain is intact: %d entries, last hash %s\n", n, last)
+	return 0
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/auditor"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+type auditVerifySuite struct {
+	suite.Suite
+}
+
+func TestAuditVerifySuite(t *testing.T) {
+	suite.Run(t, new(auditVerifySuite))
+}
+
+// newLog returns path of audit log with n entries
+func newLog(s *auditVerifySuite, n int) string {
+	path := filepath.Join(s.T().TempDir(), "audit.log")
+	a, err := auditor.NewFileAuditor(path)
+	s.NoError(err)
+	for i := 0; i < n; i++ {
+		s.NoError(a.Record(model.AuditEntry{Request: uuid.New(), Actor: "crm", ActorKind: "app", Action: model.AuditSave, Outcome: model.AuditSuccess}))
+	}
+	s.NoError(a.Close())
+	return path
+}
+
+func (s *auditVerifySuite) TestRun() {
+	intact := newLog(s, 3)
+	empty := filepath.Join(s.T().TempDir(), "empty.log")
+	s.NoError(os.WriteFile(empty, nil, 0644))
+	broken := newLog(s, 3)
+	b, err := os.ReadFile(broken)
+	s.NoError(err)
+	s.NoError(os.WriteFile(broken, bytes.Replace(b, []byte(`"actor":"crm"`), []byte(`"actor":"shop"`), 1), 0644))
+
+	tt := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantOut    string
+		wantErrOut bool
+	}{
+		{
+			name:    "intact",
+			args:    []string{"-file", intact},
+			wantOut: "chain is intact: 3 entries, last hash ",
+		},
+		{
+			name:    "no entries",
+			args:    []string{"-file", empty},
+			wantOut: "chain is intact: no entries",
+		},
+		{
+			name:     "broken",
+			args:     []string{"-file", broken},
+			wantCode: 1,
+			wantOut:  "chain is broken at line 1: ",
+		},
+		{
+			name:       "missing file",
+			args:       []string{"-file", filepath.Join(s.T().TempDir(), "missing.log")},
+			wantCode:   2,
+			wantErrOut: true,
+		},
+		{
+			name:       "unknown flag",
+			args:       []string{"-path", intact},
+			wantCode:   2,
+			wantErrOut: true,
+		},
+		{
+			name:       "help",
+			args:       []string{"-h"},
+			wantErrOut: true,
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+			code := run(v.args, out, errOut)
+			s.Equal(v.wantCode, code)
+			s.True(strings.HasPrefix(out.String(), v.wantOut), out.String())
+			s.Equal(v.wantErrOut, errOut.Len() > 0, errOut.String())
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+// flag parsing (folder, uuid, from/to, stream, level, follow, output format), searching Saver files including gzipped rotations
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/saver"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/runtimeops"
+)
+
+// timeLayouts are accepted by -from and -to, times without zone are local
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+type config struct {
+	folder string
+	query  model.LogQuery
+	follow bool
+	// enc encodes found records, nil enc means stored lines are printed as they are
+	enc saver.Encoder
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run returns 0 on success, 1 on read error, 2 on usage error
+func run(ctx context.Context, args []string, stdout, errOut io.Writer) int {
+	c, err := parseFlags(args, errOut)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 2
+	}
+
+	out := bufio.NewWriter(stdout)
+	defer out.Flush()
+	write := func(wl model.WrappedLog, line string) error {
+		var err error
+		if c.enc == nil {
+			_, err = out.WriteString(line + "\n")
+		} else {
+			var b []byte
+			b, err = c.enc.Encode(wl)
+			if err == nil {
+				_, err = out.Write(b)
+			}
+		}
+		if err == nil && c.follow {
+			err = out.Flush()
+		}
+		return err
+	}
+
+	r := saver.NewReader(c.folder, runtimeops.GetSep(), nil)
+	if c.follow {
+		err = r.Follow(ctx, c.query, write)
+	} else {
+		err = r.Find(c.query, write)
+	}
+	if err != nil {
+		out.Flush()
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	return 0
+}
+
+func parseFlags(args []string, errOut io.Writer) (config, error) {
+	c := config{}
+	fs := flag.NewFlagSet("logQuery", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	fs.StringVar(&c.folder, "folder", ".", "Saver folder")
+	id := fs.String("uuid", "", "request uuid")
+	from := fs.String("from", "", "records from this time, inclusive")
+	to := fs.String("to", "", "records before this time")
+	fs.StringVar(&c.query.Stream, "stream", "all", "stream name")
+	levels := fs.String("level", "", "comma separated levels: DEBUG,INFO,WARN,ERROR,SIGNAL")
+	fs.BoolVar(&c.follow, "follow", false, "wait for new records like tail -f")
+	output := fs.String("output", "raw", "output format: raw (lines as stored) or json")
+	err := fs.Parse(args)
+	if err != nil {
+		return c, err
+	}
+
+	if *id != "" {
+		c.query.UUID, err = uuid.Parse(*id)
+		if err != nil {
+			return c, fmt.Errorf("invalid -uuid: %w", err)
+		}
+	}
+	c.query.From, err = parseTime(*from)
+	if err != nil {
+		return c, fmt.Errorf("invalid -from: %w", err)
+	}
+	c.query.To, err = parseTime(*to)
+	if err != nil {
+		return c, fmt.Errorf("invalid -to: %w", err)
+	}
+	if *levels != "" {
+		for _, v := range strings.Split(*levels, ",") {
+			l, err := model.ParseLevelName(strings.TrimSpace(v))
+			if err != nil {
+				return c, fmt.Errorf("invalid -level: %w", err)
+			}
+			c.query.Levels = append(c.query.Levels, l)
+		}
+	}
+	switch *output {
+	case "raw":
+	case "json":
+		c.enc = saver.JSONEncoder{}
+	default:
+		return c, fmt.Errorf("invalid -output %q, raw or json expected", *output)
+	}
+	return c, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, v := range timeLayouts {
+		t, err := time.ParseInLocation(v, s, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q does not match %s", s, strings.Join(timeLayouts, ", "))
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/saver"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/runtimeops"
+)
+
+type logQuerySuite struct {
+	suite.Suite
+}
+
+func TestLogQuerySuite(t *testing.T) {
+	suite.Run(t, new(logQuerySuite))
+}
+
+func (s *logQuerySuite) TestParseTime() {
+	tt := []struct {
+		name    string
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "empty", in: ""},
+		{name: "RFC3339", in: "2023-11-23T10:00:00+03:00", want: time.Date(2023, 11, 23, 7, 0, 0, 0, time.UTC)},
+		{name: "date and time", in: "2023-11-23 10:00:00", want: time.Date(2023, 11, 23, 10, 0, 0, 0, time.Local)},
+		{name: "date and time with T", in: "2023-11-23T10:00:00", want: time.Date(2023, 11, 23, 10, 0, 0, 0, time.Local)},
+		{name: "date", in: "2023-11-23", want: time.Date(2023, 11, 23, 0, 0, 0, 0, time.Local)},
+		{name: "wrong", in: "23.11.2023", wantErr: true},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			got, err := parseTime(v.in)
+			if v.wantErr {
+				s.Error(err)
+				return
+			}
+			s.NoError(err)
+			s.True(v.want.Equal(got), "want %s, got %s", v.want, got)
+		})
+	}
+}
+
+func (s *logQuerySuite) TestParseFlags() {
+	id := uuid.MustParse("6f0c2a3e-8f6b-4f52-9a57-3b1c8d9e1f20")
+
+	tt := []struct {
+		name     string
+		args     []string
+		wantConf config
+		wantErr  bool
+	}{
+		{
+			name:     "defaults",
+			wantConf: config{folder: ".", query: model.LogQuery{Stream: "all"}},
+		},
+		{
+			name: "all flags",
+			args: []string{"-folder", "logs", "-uuid", id.String(), "-from", "2023-11-23", "-to", "2023-11-24", "-stream", "err", "-level", "ERROR, SIGNAL", "-follow", "-output", "json"},
+			wantConf: config{
+				folder: "logs",
+				query: model.LogQuery{
+					UUID:   id,
+					From:   time.Date(2023, 11, 23, 0, 0, 0, 0, time.Local),
+					To:     time.Date(2023, 11, 24, 0, 0, 0, 0, time.Local),
+					Stream: "err",
+					Levels: []model.Level{model.LevelError, model.LevelSignal},
+				},
+				follow: true,
+				enc:    saver.JSONEncoder{},
+			},
+		},
+		{name: "invalid uuid", args: []string{"-uuid", "x"}, wantErr: true},
+		{name: "invalid from", args: []string{"-from", "yesterday"}, wantErr: true},
+		{name: "invalid to", args: []string{"-to", "tomorrow"}, wantErr: true},
+		{name: "invalid level", args: []string{"-level", "INFO,TRACE"}, wantErr: true},
+		{name: "invalid output", args: []string{"-output", "xml"}, wantErr: true},
+		{name: "unknown flag", args: []string{"-tail"}, wantErr: true},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			got, err := parseFlags(v.args, &bytes.Buffer{})
+			if v.wantErr {
+				s.Error(err)
+				return
+			}
+			s.NoError(err)
+			s.Equal(v.wantConf, got)
+		})
+	}
+}
+
+func (s *logQuerySuite) TestRun() {
+	folder := s.T().TempDir()
+	id := uuid.MustParse("6f0c2a3e-8f6b-4f52-9a57-3b1c8d9e1f20")
+	t := time.Date(2023, 11, 23, 10, 0, 0, 0, time.UTC)
+	wls := []model.WrappedLog{
+		{T: t, UW: model.UUIDWrapper{UUID: id}, L: "request", F: []model.Field{{Key: "status", Value: 200}}},
+		{T: t.Add(time.Second), UW: model.UUIDWrapper{UUID: uuid.New()}, L: "other request"},
+	}
+	// write returns first line stored in folder by Saver with enc, scanner drops line ending so line is printed with \n
+	write := func(folder string, enc saver.Encoder) string {
+		sv := saver.NewSaverWithConfig(saver.Config{Folder: folder, Sep: runtimeops.GetSep(), Limit: 1 << 20, Encoder: enc})
+		for _, v := range wls {
+			s.NoError(sv.Save(v))
+		}
+		s.NoError(sv.Close())
+
+		files, err := filepath.Glob(filepath.Join(folder, "*all*"))
+		s.NoError(err)
+		s.Require().Len(files, 1)
+		stored, err := os.ReadFile(files[0])
+		s.NoError(err)
+		return strings.TrimRight(string(bytes.SplitAfter(stored, []byte("\n"))[0]), "\r\n") + "\n"
+	}
+	firstLine := write(folder, saver.TextEncoder{})
+	jsonFolder := s.T().TempDir()
+	firstJSONLine := write(jsonFolder, saver.JSONEncoder{})
+
+	tt := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantOut  string
+		wantErr  bool
+	}{
+		{
+			name:    "raw prints stored line",
+			args:    []string{"-folder", folder, "-uuid", id.String()},
+			wantOut: firstLine,
+		},
+		{
+			name:    "raw prints stored JSON line",
+			args:    []string{"-folder", jsonFolder, "-uuid", id.String()},
+			wantOut: firstJSONLine,
+		},
+		{
+			name: "json",
+			args: []string{"-folder", folder, "-uuid", id.String(), "-output", "json"},
+			// message and fields of text line are not told apart
+			wantOut: `{"time":"2023-11-23T10:00:00Z","level":"INFO","uuid":"6f0c2a3e-8f6b-4f52-9a57-3b1c8d9e1f20","msg":"request status=200"}` + "\n",
+		},
+		{
+			name: "nothing found",
+			args: []string{"-folder", folder, "-from", "2024-01-01"},
+		},
+		{
+			name:     "usage error",
+			args:     []string{"-output", "xml"},
+			wantCode: 2,
+			wantErr:  true,
+		},
+		{
+			name: "help",
+			args: []string{"-h"},
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+			code := run(context.Background(), v.args, out, errOut)
+			s.Equal(v.wantCode, code)
+			s.Equal(v.wantOut, out.String())
+			if v.wantErr {
+				s.NotEmpty(errOut.String())
+			}
+		})
+	}
+}
@@ -1,3 +1,302 @@
 package main
 
 // adaprer coupling, starting, SIGINT listening
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"os/signal"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vynovikov/study/notifications_example/internal/adapters/left/tp"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/left/tps"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/middle/aggregator"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/middle/application"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/middle/fanout"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/middle/limiter"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/middle/receiver"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/auditor"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/authorizer"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/credentials"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/saver"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/sessions"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/store"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/runtimeops"
+)
+
+type server interface {
+	Run() error
+	Stop(context.Context) error
+}
+
+// config holds parsed flags of the service
+type config struct {
+	addr       string
+	origins    []string
+	tlsAddr    string
+	cert       string
+	key        string
+	clientCA   string
+	jwks       string
+	folder     string
+	audit      string
+	slow       time.Duration
+	identities authorizer.PatternMapper
+	network    *authorizer.NetworkConfig
+	limits     limiter.Config
+}
+
+func main() {
+	c, err := parseFlags(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	err = run(c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func parseFlags(args []string, errOut io.Writer) (config, error) {
+	c := config{}
+	fs := flag.NewFlagSet("notificationExample", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	fs.StringVar(&c.addr, "addr", ":8080", "HTTP address")
+	origins := fs.String("cors-origins", "", "comma separated browser origins allowed to call HTTP server with cookies")
+	fs.StringVar(&c.tlsAddr, "tls-addr", "", "HTTPS address, HTTPS server is not started if empty")
+	fs.StringVar(&c.cert, "cert", "", "server certificate PEM file")
+	fs.StringVar(&c.key, "key", "", "server key PEM file")
+	fs.StringVar(&c.clientCA, "client-ca", "", "PEM file of CAs client certificates are verified by")
+	identities := fs.String("identities", "", "comma separated pattern=APPID pairs mapping client certificate names to apps")
+	networks := fs.String("networks", "", "comma separated prefix=CIDR|CIDR route groups internal requests are allowed from")
+	proxies := fs.String("trusted-proxies", "", "comma separated CIDRs of proxies whose forwarding headers are trusted")
+	fs.StringVar(&c.jwks, "jwks", "", "JWKS file of user token keys")
+	fs.StringVar(&c.folder, "logs", "logs", "log folder")
+	fs.StringVar(&c.audit, "audit", "audit.log", "audit log file, verified by auditVerify")
+	fs.DurationVar(&c.slow, "slow", receiver.DefaultSlowThreshold, "latency requests are logged as slow after")
+	appLimit := fs.String("app-limit", "", "rate limit per APPID on every route as PerSecond:Burst, not limited if empty")
+	userLimit := fs.String("user-limit", "", "rate limit per user_uuid on every route as PerSecond:Burst, not limited if empty")
+	ipLimit := fs.String("ip-limit", "", "rate limit per client IP on every route as PerSecond:Burst, not limited if empty")
+	err := fs.Parse(args)
+	if err != nil {
+		return c, err
+	}
+
+	c.origins = splitList(*origins)
+	c.identities, err = parseIdentities(*identities)
+	if err != nil {
+		return c, fmt.Errorf("invalid -identities: %w", err)
+	}
+	groups, err := parseGroups(*networks)
+	if err != nil {
+		return c, fmt.Errorf("invalid -networks: %w", err)
+	}
+	trusted, err := parsePrefixes(splitList(*proxies))
+	if err != nil {
+		return c, fmt.Errorf("invalid -trusted-proxies: %w", err)
+	}
+	if len(groups) > 0 || len(trusted) > 0 {
+		c.network = &authorizer.NetworkConfig{Groups: groups, TrustedProxies: trusted}
+	}
+	c.limits.Default.App, err = parseRate(*appLimit)
+	if err != nil {
+		return c, fmt.Errorf("invalid -app-limit: %w", err)
+	}
+	c.limits.Default.User, err = parseRate(*userLimit)
+	if err != nil {
+		return c, fmt.Errorf("invalid -user-limit: %w", err)
+	}
+	c.limits.Default.IP, err = parseRate(*ipLimit)
+	if err != nil {
+		return c, fmt.Errorf("invalid -ip-limit: %w", err)
+	}
+	return c, nil
+}
+
+func run(c config) error {
+	err := os.MkdirAll(c.folder, 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create log folder: %w", err)
+	}
+	creds := credentials.NewMemCredentials()
+	ac := authorizer.Config{Secrets: creds, Scopes: creds}
+	if len(c.identities) > 0 {
+		ac.Identities = c.identities
+	}
+	if c.network != nil {
+		ac.Network = authorizer.NewNetworkPolicy(*c.network)
+	}
+	if c.jwks != "" {
+		ks, err := authorizer.NewJWKSFile(c.jwks)
+		if err != nil {
+			return err
+		}
+		ac.Keys = ks
+	}
+	au, err := auditor.NewFileAuditor(c.audit)
+	if err != nil {
+		return err
+	}
+	st := store.NewMemStore()
+	sv := saver.NewSaverWithConfig(saver.Config{
+		Folder:  c.folder,
+		Sep:     runtimeops.GetSep(),
+		Limit:   10 << 20,
+		Streams: []model.LogStream{saver.AccessStream},
+		Sinks:   []saver.Sink{saver.NewStdoutSink()},
+	})
+	app := application.NewApplication(application.Adapters{
+		Store:       st,
+		Authorizer:  authorizer.NewAuthorizer(ac),
+		Saver:       saver.NewAsyncSaver(sv, saver.AsyncConfig{}),
+		Aggregator:  aggregator.NewAggregator(time.Hour),
+		Credentials: creds,
+		Sessions:    sessions.NewMemSessions(24 * time.Hour),
+		Fanout:      fanout.NewFanout(st, 1000, 100),
+		Auditor:     au,
+	})
+	rcvr := receiver.NewReceiver(app, limiter.NewLimiter(c.limits), &sync.WaitGroup{}, &sync.WaitGroup{})
+	rcvr.SetSlowThreshold(c.slow)
+	h := rcvr.AccessLog(rcvr.Routes())
+
+	servers := []server{tp.NewTp(tp.Config{Addr: c.addr, AllowedOrigins: c.origins}, h)}
+	if c.tlsAddr != "" {
+		t, err := tps.NewTps(tps.Config{Addr: c.tlsAddr, CertFile: c.cert, KeyFile: c.key, ClientCAFile: c.clientCA}, h)
+		if err != nil {
+			return errors.Join(err, app.Stop())
+		}
+		servers = append(servers, t)
+	}
+
+	app.Start()
+	rcvr.Start()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	errs := make(chan error, len(servers))
+	for _, v := range servers {
+		go func(s server) {
+			errs <- s.Run()
+		}(v)
+	}
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+
+	sctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, v := range servers {
+		serr := v.Stop(sctx)
+		if serr != nil && err == nil {
+			err = serr
+		}
+	}
+	rcvr.Stop()
+	return errors.Join(err, app.Stop())
+}
+
+// splitList returns non-empty comma separated items of s
+func splitList(s string) []string {
+	res := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// parseIdentities parses comma separated pattern=APPID pairs
+func parseIdentities(s string) (authorizer.PatternMapper, error) {
+	res := authorizer.PatternMapper{}
+	for _, v := range splitList(s) {
+		i := strings.LastIndex(v, "=")
+		if i <= 0 || i == len(v)-1 {
+			return nil, fmt.Errorf("%q is not pattern=APPID", v)
+		}
+		p := strings.TrimSpace(v[:i])
+		_, err := path.Match(p, "")
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %w", p, err)
+		}
+		res = append(res, authorizer.IdentityPattern{Pattern: p, AppID: strings.TrimSpace(v[i+1:])})
+	}
+	return res, nil
+}
+
+// parseGroups parses comma separated prefix=CIDR|CIDR route groups, prefix is the group name
+func parseGroups(s string) ([]authorizer.RouteGroup, error) {
+	res := make([]authorizer.RouteGroup, 0)
+	for _, v := range splitList(s) {
+		prefix, cidrs, ok := strings.Cut(v, "=")
+		prefix = strings.TrimSpace(prefix)
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("%q is not prefix=CIDR|CIDR", v)
+		}
+		nets, err := parsePrefixes(strings.Split(cidrs, "|"))
+		if err != nil {
+			return nil, fmt.Errorf("group %q: %w", prefix, err)
+		}
+		res = append(res, authorizer.RouteGroup{Name: prefix, Prefix: prefix, Networks: nets})
+	}
+	return res, nil
+}
+
+// parsePrefixes parses CIDRs, single address is taken as its host prefix
+func parsePrefixes(ss []string) ([]netip.Prefix, error) {
+	res := make([]netip.Prefix, 0, len(ss))
+	for _, v := range ss {
+		v = strings.TrimSpace(v)
+		if !strings.Contains(v, "/") {
+			a, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, netip.PrefixFrom(a, a.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, p.Masked())
+	}
+	return res, nil
+}
+
+// parseRate parses PerSecond:Burst, empty s is zero Rate
+func parseRate(s string) (limiter.Rate, error) {
+	if s == "" {
+		return limiter.Rate{}, nil
+	}
+	ps, b, ok := strings.Cut(s, ":")
+	if !ok {
+		return limiter.Rate{}, fmt.Errorf("%q is not PerSecond:Burst", s)
+	}
+	perSecond, err := strconv.ParseFloat(ps, 64)
+	if err != nil || perSecond <= 0 {
+		return limiter.Rate{}, fmt.Errorf("invalid rate %q", ps)
+	}
+	burst, err := strconv.Atoi(b)
+	if err != nil || burst < 1 {
+		return limiter.Rate{}, fmt.Errorf("invalid burst %q", b)
+	}
+	return limiter.Rate{PerSecond: perSecond, Burst: burst}, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/middle/limiter"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/middle/receiver"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/authorizer"
+)
+
+type mainSuite struct {
+	suite.Suite
+}
+
+func TestMainSuite(t *testing.T) {
+	suite.Run(t, new(mainSuite))
+}
+
+func (s *mainSuite) TestParseFlags() {
+	base := config{
+		addr:       ":8080",
+		origins:    []string{},
+		folder:     "logs",
+		audit:      "audit.log",
+		slow:       receiver.DefaultSlowThreshold,
+		identities: authorizer.PatternMapper{},
+	}
+
+	tt := []struct {
+		name     string
+		args     []string
+		wantConf func(config) config
+		wantErr  string
+	}{
+		{
+			name:     "defaults",
+			wantConf: func(c config) config { return c },
+		},
+		{
+			name: "mTLS identities and networks",
+			args: []string{
+				"-tls-addr", ":8443", "-identities", "billing.*.svc=billing, spiffe://corp/mailer=mailer",
+				"-networks", "/api/v1/notifications/batch=10.0.0.0/8|192.168.1.7,/api/v1/admin=127.0.0.1/32",
+				"-trusted-proxies", "10.0.0.1,172.16.0.0/12",
+			},
+			wantConf: func(c config) config {
+				c.tlsAddr = ":8443"
+				c.identities = authorizer.PatternMapper{{Pattern: "billing.*.svc", AppID: "billing"}, {Pattern: "spiffe://corp/mailer", AppID: "mailer"}}
+				c.network = &authorizer.NetworkConfig{
+					Groups: []authorizer.RouteGroup{
+						{
+							Name:     "/api/v1/notifications/batch",
+							Prefix:   "/api/v1/notifications/batch",
+							Networks: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.168.1.7/32")},
+						},
+						{Name: "/api/v1/admin", Prefix: "/api/v1/admin", Networks: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}},
+					},
+					TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.1/32"), netip.MustParsePrefix("172.16.0.0/12")},
+				}
+				return c
+			},
+		},
+		{
+			name: "trusted proxies only",
+			args: []string{"-trusted-proxies", "10.0.0.0/8"},
+			wantConf: func(c config) config {
+				c.network = &authorizer.NetworkConfig{Groups: []authorizer.RouteGroup{}, TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+				return c
+			},
+		},
+		{
+			name: "limits",
+			args: []string{"-app-limit", "100:200", "-user-limit", "5:10", "-ip-limit", "0.5:3"},
+			wantConf: func(c config) config {
+				c.limits = limiter.Config{Default: limiter.Limit{
+					App:  limiter.Rate{PerSecond: 100, Burst: 200},
+					User: limiter.Rate{PerSecond: 5, Burst: 10},
+					IP:   limiter.Rate{PerSecond: 0.5, Burst: 3},
+				}}
+				return c
+			},
+		},
+		{name: "identity without app", args: []string{"-identities", "billing.*"}, wantErr: "invalid -identities"},
+		{name: "bad identity pattern", args: []string{"-identities", "[billing=billing"}, wantErr: "invalid -identities"},
+		{name: "group without prefix", args: []string{"-networks", "10.0.0.0/8"}, wantErr: "invalid -networks"},
+		{name: "bad group CIDR", args: []string{"-networks", "/api=10.0.0.0/33"}, wantErr: "invalid -networks"},
+		{name: "bad proxy", args: []string{"-trusted-proxies", "proxy.local"}, wantErr: "invalid -trusted-proxies"},
+		{name: "limit without burst", args: []string{"-app-limit", "10"}, wantErr: "invalid -app-limit"},
+		{name: "zero burst", args: []string{"-user-limit", "10:0"}, wantErr: "invalid -user-limit"},
+		{name: "negative rate", args: []string{"-ip-limit", "-1:5"}, wantErr: "invalid -ip-limit"},
+		{name: "unknown flag", args: []string{"-port", "80"}, wantErr: "flag provided but not defined"},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			got, err := parseFlags(v.args, &bytes.Buffer{})
+			if v.wantErr != "" {
+				s.ErrorContains(err, v.wantErr)
+				return
+			}
+			s.NoError(err)
+			s.Equal(v.wantConf(base), got)
+		})
+	}
+}
+
+func (s *mainSuite) TestParseFlagsHelp() {
+	errOut := &bytes.Buffer{}
+	_, err := parseFlags([]string{"-h"}, errOut)
+	s.ErrorIs(err, flag.ErrHelp)
+	s.Contains(errOut.String(), "-identities")
+	s.Contains(errOut.String(), "-ip-limit")
+}
@@ -1,3 +1,101 @@
 package tp
 
-// http settings and routes
+// http settings, CORS layer, access log middleware and routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+type Tp interface {
+	Run() error
+	Stop(context.Context) error
+}
+
+// Tp implementation
+
+// Config holds server address and browser origins allowed to call it with cookies
+type Config struct {
+	Addr           string
+	AllowedOrigins []string
+}
+
+const (
+	corsMethods = "GET, POST, PUT"
+	corsMaxAge  = "600"
+)
+
+var corsHeaders = strings.Join([]string{"Authorization", "Content-Type", model.CSRFHeader}, ", ")
+
+type tp struct {
+	srv *http.Server
+}
+
+// NewTp returns HTTP server of h. If c.AllowedOrigins is not empty, h is wrapped in CORS layer.
+func NewTp(c Config, h http.Handler) *tp {
+	if len(c.AllowedOrigins) > 0 {
+		h = cors(c.AllowedOrigins, h)
+	}
+	return &tp{
+		srv: &http.Server{
+			Addr:              c.Addr,
+			Handler:           h,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// Run serves until Stop is called
+func (t *tp) Run() error {
+	err := t.srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (t *tp) Stop(ctx context.Context) error {
+	return t.srv.Shutdown(ctx)
+}
+
+// cors lets browser pages of allowed origins call h with credentials (session and CSRF cookies).
+// Requests of other origins get no CORS headers, so browser does not expose responses to them, their preflights are rejected.
+func cors(origins []string, h http.Handler) http.Handler {
+	allowed := make(map[string]struct{}, len(origins))
+	for _, v := range origins {
+		allowed[strings.TrimRight(v, "/")] = struct{}{}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		if origin == "" {
+			h.ServeHTTP(w, req)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		_, ok := allowed[origin]
+		preflight := req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != ""
+		if !ok {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			h.ServeHTTP(w, req)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		if preflight {
+			w.Header().Set("Access-Control-Allow-Methods", corsMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsHeaders)
+			w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
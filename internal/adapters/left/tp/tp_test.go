@@ -0,0 +1,127 @@
+package tp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type tpSuite struct {
+	suite.Suite
+}
+
+func TestTpSuite(t *testing.T) {
+	suite.Run(t, new(tpSuite))
+}
+
+func (s *tpSuite) TestRunStop() {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	s.NoError(err)
+	addr := l.Addr().String()
+	s.NoError(l.Close())
+
+	t := NewTp(Config{Addr: addr}, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	done := make(chan error, 1)
+	go func() { done <- t.Run() }()
+
+	var res *http.Response
+	s.Eventually(func() bool {
+		res, err = http.Get("http://" + addr + "/api/v1/notifications")
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	s.NoError(err)
+	s.Equal("ok", string(body))
+
+	s.NoError(t.Stop(context.Background()))
+	s.NoError(<-done)
+}
+
+func (s *tpSuite) TestCORS() {
+	h := cors([]string{"https://inbox.example.com/"}, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	tt := []struct {
+		name            string
+		method          string
+		origin          string
+		requestMethod   string
+		wantStatus      int
+		wantOrigin      string
+		wantCredentials string
+		wantMethods     string
+		wantBody        string
+	}{
+		{
+			name:       "same origin",
+			method:     "GET",
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+		{
+			name:            "allowed origin",
+			method:          "POST",
+			origin:          "https://inbox.example.com",
+			wantStatus:      http.StatusOK,
+			wantOrigin:      "https://inbox.example.com",
+			wantCredentials: "true",
+			wantBody:        "ok",
+		},
+		{
+			name:       "other origin",
+			method:     "POST",
+			origin:     "https://evil.example.com",
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+		{
+			name:            "allowed preflight",
+			method:          "OPTIONS",
+			origin:          "https://inbox.example.com",
+			requestMethod:   "POST",
+			wantStatus:      http.StatusNoContent,
+			wantOrigin:      "https://inbox.example.com",
+			wantCredentials: "true",
+			wantMethods:     corsMethods,
+		},
+		{
+			name:          "other preflight",
+			method:        "OPTIONS",
+			origin:        "https://evil.example.com",
+			requestMethod: "POST",
+			wantStatus:    http.StatusForbidden,
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			req := httptest.NewRequest(v.method, "http://localhost:8080/api/v1/notifications/read", nil)
+			if v.origin != "" {
+				req.Header.Set("Origin", v.origin)
+			}
+			if v.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", v.requestMethod)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			s.Equal(v.wantStatus, rec.Code)
+			s.Equal(v.wantOrigin, rec.Header().Get("Access-Control-Allow-Origin"))
+			s.Equal(v.wantCredentials, rec.Header().Get("Access-Control-Allow-Credentials"))
+			s.Equal(v.wantMethods, rec.Header().Get("Access-Control-Allow-Methods"))
+			s.Equal(v.wantBody, rec.Body.String())
+			if v.origin != "" {
+				s.Equal("Origin", rec.Header().Get("Vary"))
+			}
+		})
+	}
+}
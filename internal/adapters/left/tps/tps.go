@@ -1,3 +1,81 @@
 package tps
 
-// https settings and routes
+// https settings, client certificate verification, access log middleware and routes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+type Tps interface {
+	Run() error
+	Stop(context.Context) error
+}
+
+// Tps implementation
+
+// Config holds server address and PEM files of server certificate, its key and CAs client certificates are verified by
+type Config struct {
+	Addr         string
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+}
+
+type tps struct {
+	srv *http.Server
+	cfg Config
+}
+
+// NewTps returns HTTPS server of h. Every client must present certificate signed by CA from ClientCAFile.
+func NewTps(c Config, h http.Handler) (*tps, error) {
+	pem, err := os.ReadFile(c.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("in tps.NewTps unable to read client CA file: %w", err)
+	}
+	tc, err := TLSConfig(pem)
+	if err != nil {
+		return nil, fmt.Errorf("in tps.NewTps %w", err)
+	}
+	return &tps{
+		srv: &http.Server{
+			Addr:              c.Addr,
+			Handler:           h,
+			TLSConfig:         tc,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		cfg: c,
+	}, nil
+}
+
+// TLSConfig requires and verifies client certificates against CAs in clientCAs PEM
+func TLSConfig(clientCAs []byte) (*tls.Config, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(clientCAs) {
+		return nil, errors.New("no client CA certificates found")
+	}
+	return &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
+
+// Run serves until Stop is called
+func (t *tps) Run() error {
+	err := t.srv.ListenAndServeTLS(t.cfg.CertFile, t.cfg.KeyFile)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (t *tps) Stop(ctx context.Context) error {
+	return t.srv.Shutdown(ctx)
+}
@@ -0,0 +1,126 @@
+package tps
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type tpsSuite struct {
+	suite.Suite
+}
+
+func TestTpsSuite(t *testing.T) {
+	suite.Run(t, new(tpsSuite))
+}
+
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newAuthority(s *tpsSuite) authority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.NoError(err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	s.NoError(err)
+	cert, err := x509.ParseCertificate(der)
+	s.NoError(err)
+	return authority{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (a authority) client(s *tpsSuite, cn string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.NoError(err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, a.cert, &key.PublicKey, a.key)
+	s.NoError(err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func (s *tpsSuite) TestClientCertificate() {
+	ca, other := newAuthority(s), newAuthority(s)
+
+	tc, err := TLSConfig(ca.pem)
+	s.NoError(err)
+	s.Equal(tls.RequireAndVerifyClientCert, tc.ClientAuth)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.TLS.VerifiedChains[0][0].Subject.CommonName))
+	}))
+	srv.TLS = tc
+	srv.StartTLS()
+	defer srv.Close()
+
+	tt := []struct {
+		name     string
+		certs    []tls.Certificate
+		wantBody string
+		wantErr  bool
+	}{
+		{
+			name:     "trusted certificate",
+			certs:    []tls.Certificate{ca.client(s, "crm.internal")},
+			wantBody: "crm.internal",
+		},
+		{
+			name:    "no certificate",
+			wantErr: true,
+		},
+		{
+			name:    "untrusted certificate",
+			certs:   []tls.Certificate{other.client(s, "crm.internal")},
+			wantErr: true,
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			c := srv.Client()
+			tr := c.Transport.(*http.Transport).Clone()
+			tr.TLSClientConfig.Certificates = v.certs
+			c.Transport = tr
+
+			res, err := c.Get(srv.URL)
+			if v.wantErr {
+				s.Error(err)
+				return
+			}
+			s.NoError(err)
+			defer res.Body.Close()
+			b, err := io.ReadAll(res.Body)
+			s.NoError(err)
+			s.Equal(v.wantBody, string(b))
+		})
+	}
+
+	_, err = TLSConfig([]byte("not a certificate"))
+	s.Error(err)
+}
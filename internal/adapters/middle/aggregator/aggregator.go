@@ -0,0 +1,87 @@
+package aggregator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+type Aggregator interface {
+	Collapse([]model.NotificationDataStructured) []model.Digest
+}
+
+// Aggregator implementation
+
+type aggregator struct {
+	window time.Duration
+}
+
+// NewAggregator returns Aggregator collapsing notifications created within window
+func NewAggregator(window time.Duration) *aggregator {
+	return &aggregator{
+		window: window,
+	}
+}
+
+type key struct {
+	object   uuid.UUID
+	category string
+}
+
+// Collapse groups notifications sharing object_uuid and category whose created_at
+// differs from the group's first one by no more than window.
+// Digests keep order of their first members, single notifications become digests of count 1.
+// Urgent notifications are never collapsed, digest priority is the highest of its members.
+func (a *aggregator) Collapse(items []model.NotificationDataStructured) []model.Digest {
+	res := make([]model.Digest, 0, len(items))
+	open := make(map[key]int)
+	anchors := make(map[key]time.Time)
+
+	for _, v := range items {
+		k := key{object: v.ObjectUUID, category: v.Category}
+		t := v.Time()
+		i, ok := open[k]
+		if ok && v.Priority != model.PriorityUrgent && within(anchors[k], t, a.window) {
+			d := &res[i]
+			d.Count++
+			d.Members = append(d.Members, v.UUID)
+			d.Name = fmt.Sprintf("%d new events on %s", d.Count, v.Name)
+			d.Description = ""
+			if v.CreatedAt > d.CreatedAt {
+				d.CreatedAt = v.CreatedAt
+			}
+			if v.Priority.Rank() > d.Priority.Rank() {
+				d.Priority = v.Priority
+			}
+			continue
+		}
+		res = append(res, model.Digest{
+			UUID:        v.UUID,
+			UserUUID:    v.UserUUID,
+			ObjectUUID:  v.ObjectUUID,
+			Category:    v.Category,
+			Name:        v.Name,
+			Description: v.Description,
+			Count:       1,
+			Members:     []uuid.UUID{v.UUID},
+			CreatedAt:   v.CreatedAt,
+			Priority:    v.Priority,
+		})
+		if v.Priority == model.PriorityUrgent {
+			continue
+		}
+		open[k] = len(res) - 1
+		anchors[k] = t
+	}
+	return res
+}
+
+func within(anchor, t time.Time, window time.Duration) bool {
+	d := t.Sub(anchor)
+	if d < 0 {
+		d = -d
+	}
+	return d <= window
+}
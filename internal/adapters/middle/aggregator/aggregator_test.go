@@ -0,0 +1,109 @@
+package aggregator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+type aggregatorSuite struct {
+	suite.Suite
+}
+
+func TestAggregatorSuite(t *testing.T) {
+	suite.Run(t, new(aggregatorSuite))
+}
+
+func (s *aggregatorSuite) TestCollapse() {
+	obj1, obj2 := uuid.New(), uuid.New()
+	u := []uuid.UUID{uuid.New(), uuid.New(), uuid.New(), uuid.New()}
+
+	tt := []struct {
+		name      string
+		items     []model.NotificationDataStructured
+		wantCount []int
+		wantNames []string
+	}{
+		{
+			name: "same object and category within window",
+			items: []model.NotificationDataStructured{
+				{UUID: u[0], ObjectUUID: obj1, Category: "new_rank", Name: "X", CreatedAt: "2022-10-03T12:40:00.000000Z"},
+				{UUID: u[1], ObjectUUID: obj1, Category: "new_rank", Name: "X", CreatedAt: "2022-10-03T12:30:00.000000Z"},
+				{UUID: u[2], ObjectUUID: obj1, Category: "new_rank", Name: "X", CreatedAt: "2022-10-03T12:20:00.000000Z"},
+			},
+			wantCount: []int{3},
+			wantNames: []string{"3 new events on X"},
+		},
+		{
+			name: "different category or object",
+			items: []model.NotificationDataStructured{
+				{UUID: u[0], ObjectUUID: obj1, Category: "new_rank", Name: "X", CreatedAt: "2022-10-03T12:40:00.000000Z"},
+				{UUID: u[1], ObjectUUID: obj1, Category: "invite", Name: "X", CreatedAt: "2022-10-03T12:30:00.000000Z"},
+				{UUID: u[2], ObjectUUID: obj2, Category: "new_rank", Name: "Y", CreatedAt: "2022-10-03T12:20:00.000000Z"},
+			},
+			wantCount: []int{1, 1, 1},
+			wantNames: []string{"X", "X", "Y"},
+		},
+		{
+			name: "outside window",
+			items: []model.NotificationDataStructured{
+				{UUID: u[0], ObjectUUID: obj1, Category: "new_rank", Name: "X", CreatedAt: "2022-10-03T12:40:00.000000Z"},
+				{UUID: u[1], ObjectUUID: obj1, Category: "new_rank", Name: "X", CreatedAt: "2022-10-03T12:10:00.000000Z"},
+				{UUID: u[2], ObjectUUID: obj1, Category: "new_rank", Name: "X", CreatedAt: "2022-10-03T10:00:00.000000Z"},
+				{UUID: u[3], ObjectUUID: obj1, Category: "new_rank", Name: "X", CreatedAt: "2022-10-03T09:50:00.000000Z"},
+			},
+			wantCount: []int{2, 2},
+			wantNames: []string{"2 new events on X", "2 new events on X"},
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			a := NewAggregator(time.Hour)
+
+			got := a.Collapse(v.items)
+
+			s.Len(got, len(v.wantCount))
+			members := 0
+			for i, w := range got {
+				s.Equal(v.wantCount[i], w.Count)
+				s.Equal(v.wantNames[i], w.Name)
+				s.Len(w.Members, w.Count)
+				members += w.Count
+			}
+			s.Equal(len(v.items), members)
+		})
+	}
+}
+
+func (s *aggregatorSuite) TestCollapseKeepsLatestTime() {
+	obj := uuid.New()
+	a := NewAggregator(time.Hour)
+
+	got := a.Collapse([]model.NotificationDataStructured{
+		{UUID: uuid.New(), ObjectUUID: obj, Category: "c", CreatedAt: "2022-10-03T12:00:00.000000Z"},
+		{UUID: uuid.New(), ObjectUUID: obj, Category: "c", CreatedAt: "2022-10-03T12:30:00.000000Z"},
+	})
+
+	s.Len(got, 1)
+	s.Equal("2022-10-03T12:30:00.000000Z", got[0].CreatedAt)
+}
+
+func (s *aggregatorSuite) TestCollapseSkipsUrgent() {
+	obj := uuid.New()
+	a := NewAggregator(time.Hour)
+
+	got := a.Collapse([]model.NotificationDataStructured{
+		{UUID: uuid.New(), ObjectUUID: obj, Category: "c", Priority: model.PriorityNormal, CreatedAt: "2022-10-03T12:30:00.000000Z"},
+		{UUID: uuid.New(), ObjectUUID: obj, Category: "c", Priority: model.PriorityUrgent, CreatedAt: "2022-10-03T12:20:00.000000Z"},
+		{UUID: uuid.New(), ObjectUUID: obj, Category: "c", Priority: model.PriorityHigh, CreatedAt: "2022-10-03T12:10:00.000000Z"},
+	})
+
+	s.Len(got, 2)
+	s.Equal(2, got[0].Count)
+	s.Equal(model.PriorityHigh, got[0].Priority)
+	s.Equal(1, got[1].Count)
+	s.Equal(model.PriorityUrgent, got[1].Priority)
+}
@@ -1,16 +1,734 @@
 package application
 
-import "github.com/vynovikov/study/notifications_example/internal/pkg/model"
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/middle/aggregator"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/middle/fanout"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/auditor"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/authorizer"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/credentials"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/saver"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/sessions"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/store"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/logger"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
 
 type Application interface {
 	Save(model.WrappedReq) error
 	Extract(model.WrappedReq) ([][]byte, error)
 	Count(model.WrappedReq) (int, error)
-	AuthInternal(model.WrappedReq) error
-	AuthExternal(model.WrappedReq) error
+	MarkRead(model.WrappedReq) (int, error)
+	Delete(model.WrappedReq) (int, error)
+	Broadcast(model.WrappedReq) (uuid.UUID, error)
+	BroadcastProgress(model.WrappedReq) (model.BroadcastProgress, error)
+	Login(model.WrappedReq) (model.Session, error)
+	Logout(model.WrappedReq) error
+	CreateApp(model.WrappedReq) (model.App, error)
+	App(model.WrappedReq) (model.App, error)
+	IssueSecret(model.WrappedReq) (model.AppSecret, error)
+	RevokeSecret(model.WrappedReq) error
+	RevokeApp(model.WrappedReq) error
+	AuthInternal(model.WrappedReq) (model.AppIdentity, error)
+	AuthExternal(model.WrappedReq) (model.AppIdentity, error)
+	AuthUser(model.WrappedReq) (model.Principal, error)
+	AuthAccess(model.WrappedReq) error
+	ClientIP(model.WrappedReq) string
 	Start()
-	Stop()
-	Log(model.UUIDWrapper, string)
+	Stop() error
+	Logger() logger.Logger
+	SetLogLevel(model.WrappedReq, model.Level)
+	Redactions() map[string]map[string]uint64
+}
+
+// Application implementation
+
+const (
+	viewExpanded  = "expanded"
+	viewCollapsed = "collapsed"
+)
+
+// Adapters are modules application depends on
+type Adapters struct {
+	Store      store.Store
+	Authorizer authorizer.Authorizer
+	// Policy decides who may access whose notifications, authorizer.RolePolicy if not set
+	Policy     authorizer.Policy
+	Saver      saver.Saver
+	Aggregator aggregator.Aggregator
+	// Credentials holds apps managed through admin routes
+	Credentials credentials.Credentials
+	// Sessions holds browser sessions
+	Sessions   sessions.Sessions
+	Fanout     fanout.Fanout
+	Priorities model.PriorityDefaults
+	// Auditor records saves, broadcast writes, deletes, mark-reads, admin actions and denied requests,
+	// nothing is recorded if not set
+	Auditor auditor.Auditor
+}
+
+type application struct {
+	Adapters
+	log logger.Logger
+	// stderr gets errors which can not be logged because Saver is closed
+	stderr io.Writer
+}
+
+func NewApplication(a Adapters) *application {
+	if a.Policy == nil {
+		a.Policy = authorizer.RolePolicy{}
+	}
+	app := &application{
+		Adapters: a,
+		log:      logger.NewLogger(a.Saver, model.LevelInfo),
+		stderr:   os.Stderr,
+	}
+	if f, ok := a.Fanout.(fanout.WriteObserver); ok {
+		f.OnWrite(app.auditBroadcast)
+	}
+	return app
+}
+
+// Save validates batch of notifications in request body and writes it to Store.
+// Notifications without priority get default priority of their category.
+func (a *application) Save(wr model.WrappedReq) error {
+	items, err := a.save(wr)
+	a.auditItems(wr, model.AuditSave, items, err)
+	return err
+}
+
+// save returns notifications it was asked to save
+func (a *application) save(wr model.WrappedReq) ([]model.NotificationDataStructured, error) {
+	items := make([]model.NotificationDataStructured, 0)
+	err := json.Unmarshal(wr.Body, &items)
+	if err != nil {
+		return nil, fmt.Errorf("in application.Save unable to parse body: %w", err)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("in application.Save request has empty batch")
+	}
+	for i, v := range items {
+		err = validate(v)
+		if err != nil {
+			return items, fmt.Errorf("in application.Save item %d: %w", i, err)
+		}
+		if v.Priority == "" {
+			items[i].Priority = a.Priorities.For(v.Category)
+		}
+	}
+	return items, a.Store.Write(items, wr.UUID)
+}
+
+// Extract returns page of user's notifications, or page of digests if view parameter is "collapsed"
+func (a *application) Extract(wr model.WrappedReq) ([][]byte, error) {
+	q := wr.Req.URL.Query()
+	u, err := userUUID(q)
+	if err != nil {
+		return nil, fmt.Errorf("in application.Extract %w", err)
+	}
+	switch q.Get("view") {
+	case "", viewExpanded:
+		rows, err := a.Store.Read(u, q)
+		if err != nil {
+			return nil, err
+		}
+		return marshalAll(rows)
+	case viewCollapsed:
+		digests, err := a.digests(u, q)
+		if err != nil {
+			return nil, err
+		}
+		page, perPage, err := model.Paging(q)
+		if err != nil {
+			return nil, fmt.Errorf("in application.Extract %w", err)
+		}
+		from := (page - 1) * perPage
+		if from >= len(digests) {
+			return nil, model.ErrNoRows
+		}
+		to := from + perPage
+		if to > len(digests) {
+			to = len(digests)
+		}
+		return marshalAll(digests[from:to])
+	}
+	return nil, fmt.Errorf("in application.Extract unknown view %q", q.Get("view"))
+}
+
+// Count returns number of user's notifications, or number of digests if view parameter is "collapsed"
+func (a *application) Count(wr model.WrappedReq) (int, error) {
+	q := wr.Req.URL.Query()
+	u, err := userUUID(q)
+	if err != nil {
+		return -1, fmt.Errorf("in application.Count %w", err)
+	}
+	switch q.Get("view") {
+	case "", viewExpanded:
+		return a.Store.Count(u, q)
+	case viewCollapsed:
+		digests, err := a.digests(u, q)
+		if err != nil {
+			return 0, err
+		}
+		return len(digests), nil
+	}
+	return -1, fmt.Errorf("in application.Count unknown view %q", q.Get("view"))
+}
+
+// MarkRead marks notifications with uuids given in request body as read by user given by user_uuid parameter
+func (a *application) MarkRead(wr model.WrappedReq) (int, error) {
+	u, uuids, err := a.targets(wr)
+	if err != nil {
+		err = fmt.Errorf("in application.MarkRead %w", err)
+		a.audit(wr, model.AuditMarkRead, userString(u), uuidStrings(uuids), err)
+		return 0, err
+	}
+	n, err := a.Store.MarkRead(u, uuids, time.Now().UTC().Format(model.CreatedAtLayout))
+	a.audit(wr, model.AuditMarkRead, u.String(), uuidStrings(uuids), err)
+	return n, err
+}
+
+// Delete deletes notifications with uuids given in request body of user given by user_uuid parameter
+func (a *application) Delete(wr model.WrappedReq) (int, error) {
+	u, uuids, err := a.targets(wr)
+	if err != nil {
+		err = fmt.Errorf("in application.Delete %w", err)
+		a.audit(wr, model.AuditDelete, userString(u), uuidStrings(uuids), err)
+		return 0, err
+	}
+	n, err := a.Store.Delete(u, uuids)
+	a.audit(wr, model.AuditDelete, u.String(), uuidStrings(uuids), err)
+	return n, err
+}
+
+// targets returns user and notification uuids of request with body {"uuids":[...]}
+func (a *application) targets(wr model.WrappedReq) (uuid.UUID, []uuid.UUID, error) {
+	u, err := userUUID(wr.Req.URL.Query())
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+	body := struct {
+		UUIDs []uuid.UUID `json:"uuids"`
+	}{}
+	err = json.Unmarshal(wr.Body, &body)
+	if err != nil {
+		return u, nil, fmt.Errorf("unable to parse body: %w", err)
+	}
+	if len(body.UUIDs) == 0 {
+		return u, nil, errors.New("request has empty uuids")
+	}
+	return u, body.UUIDs, nil
+}
+
+// Broadcast validates broadcast in request body and queues it to Fanout
+func (a *application) Broadcast(wr model.WrappedReq) (uuid.UUID, error) {
+	b := model.Broadcast{}
+	err := json.Unmarshal(wr.Body, &b)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("in application.Broadcast unable to parse body: %w", err)
+	}
+	if (len(b.Users) == 0) == (b.Segment == "") {
+		return uuid.Nil, errors.New("in application.Broadcast request must have either users or segment")
+	}
+	if b.Category == "" {
+		return uuid.Nil, errors.New("in application.Broadcast request has empty category")
+	}
+	if b.CreatedAt != "" {
+		n := model.NotificationDataStructured{CreatedAt: b.CreatedAt}
+		if n.Time().IsZero() {
+			return uuid.Nil, fmt.Errorf("in application.Broadcast invalid created_at %q", b.CreatedAt)
+		}
+	}
+	if b.Priority == "" {
+		b.Priority = a.Priorities.For(b.Category)
+	}
+	if !b.Priority.Valid() {
+		return uuid.Nil, fmt.Errorf("in application.Broadcast invalid priority %q", b.Priority)
+	}
+	b.AppID, b.Request = wr.Identity.AppID, wr.UUID
+	id, err := a.Fanout.Submit(b)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("in application.Broadcast %w", err)
+	}
+	a.log.WithUUID(wr.UUID).Info("broadcast queued", logger.UUID("broadcast", id))
+	return id, nil
+}
+
+// BroadcastProgress returns progress of broadcast given by uuid parameter.
+// Broadcast of another app is forbidden.
+func (a *application) BroadcastProgress(wr model.WrappedReq) (model.BroadcastProgress, error) {
+	s := wr.Req.URL.Query().Get("uuid")
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return model.BroadcastProgress{}, fmt.Errorf("in application.BroadcastProgress request has invalid uuid parameter %q", s)
+	}
+	p, err := a.Fanout.Progress(id)
+	if err != nil {
+		return model.BroadcastProgress{}, fmt.Errorf("in application.BroadcastProgress %w", err)
+	}
+	if p.AppID != wr.Identity.AppID {
+		return model.BroadcastProgress{}, fmt.Errorf("in application.BroadcastProgress broadcast %s is not sent by app %q: %w", id, wr.Identity.AppID, model.ErrForbidden)
+	}
+	return p, nil
+}
+
+// AuthInternal returns identity of app by its client certificate, app scope is checked for every item of request.
+// Requests from not allowed networks are logged, denied requests are audited.
+func (a *application) AuthInternal(wr model.WrappedReq) (model.AppIdentity, error) {
+	id, err := a.Authorizer.Internal(wr)
+	if errors.Is(err, authorizer.ErrNetworkDenied) {
+		a.log.WithUUID(wr.UUID).Warn("internal request denied", logger.Err(err))
+	}
+	if err != nil {
+		wr.Identity = id
+		a.denied(wr, "", err)
+	}
+	return id, err
+}
+
+// AuthExternal returns identity of app by its request signature, app scope is checked for every item of request.
+// Denied requests are audited.
+func (a *application) AuthExternal(wr model.WrappedReq) (model.AppIdentity, error) {
+	id, err := a.Authorizer.External(wr)
+	if err != nil {
+		wr.Identity = id
+		a.denied(wr, "", err)
+	}
+	return id, err
+}
+
+// ClientIP returns address of client request is made by, forwarding headers of trusted proxies are followed.
+// Client hidden by proxy is "unknown", remote address that can not be parsed is returned as is.
+func (a *application) ClientIP(wr model.WrappedReq) string {
+	addr, err := a.Authorizer.ClientAddr(wr)
+	if err != nil {
+		return wr.Req.RemoteAddr
+	}
+	if !addr.IsValid() {
+		return "unknown"
+	}
+	return addr.String()
+}
+
+// AuthUser returns user authenticated by token, or by session cookie if request has no Authorization header.
+// State-changing requests authorized by session must repeat CSRF cookie in CSRF header. Denied requests are audited.
+func (a *application) AuthUser(wr model.WrappedReq) (model.Principal, error) {
+	p, err := a.authUser(wr)
+	if err != nil {
+		a.denied(wr, "", err)
+	}
+	return p, err
+}
+
+func (a *application) authUser(wr model.WrappedReq) (model.Principal, error) {
+	if wr.Req.Header.Get("Authorization") == "" && a.Sessions != nil {
+		c, err := wr.Req.Cookie(model.SessionCookie)
+		if err == nil {
+			return a.sessionUser(wr, c.Value)
+		}
+	}
+	c, err := a.Authorizer.User(wr)
+	if err != nil {
+		return model.Principal{}, err
+	}
+	return model.Principal{Subject: c.Subject, Roles: c.Roles}, nil
+}
+
+func (a *application) sessionUser(wr model.WrappedReq, id string) (model.Principal, error) {
+	s, err := a.Sessions.Get(id)
+	if err != nil {
+		return model.Principal{}, fmt.Errorf("in application.AuthUser %w", err)
+	}
+	switch wr.Req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return s.Principal, nil
+	}
+	c, err := wr.Req.Cookie(model.CSRFCookie)
+	if err != nil {
+		return model.Principal{}, errors.New("in application.AuthUser request has no CSRF cookie")
+	}
+	h := wr.Req.Header.Get(model.CSRFHeader)
+	if h == "" || subtle.ConstantTimeCompare([]byte(h), []byte(c.Value)) != 1 || subtle.ConstantTimeCompare([]byte(h), []byte(s.CSRF)) != 1 {
+		return model.Principal{}, errors.New("in application.AuthUser CSRF header does not match session")
+	}
+	return s.Principal, nil
+}
+
+// Login creates session of wr.Principal
+func (a *application) Login(wr model.WrappedReq) (model.Session, error) {
+	s, err := a.Sessions.Create(model.Session{Principal: wr.Principal})
+	if err != nil {
+		return model.Session{}, err
+	}
+	a.log.WithUUID(wr.UUID).Info("logged in", logger.String("subject", wr.Principal.Subject))
+	return s, nil
+}
+
+// Logout deletes session given by session cookie
+func (a *application) Logout(wr model.WrappedReq) error {
+	c, err := wr.Req.Cookie(model.SessionCookie)
+	if err != nil {
+		return errors.New("in application.Logout request has no session cookie")
+	}
+	return a.Sessions.Delete(c.Value)
+}
+
+// AuthAccess checks that wr.Principal may perform wr.Op on notifications of user given by user_uuid parameter,
+// or admin operation. Allowed access to notifications of other user is logged, denied access is audited.
+func (a *application) AuthAccess(wr model.WrappedReq) error {
+	err := a.authAccess(wr)
+	if err != nil {
+		u, _ := userUUID(wr.Req.URL.Query())
+		a.denied(wr, userString(u), err)
+	}
+	return err
+}
+
+func (a *application) authAccess(wr model.WrappedReq) error {
+	if wr.Op == model.OperationAdmin {
+		err := a.Policy.Allow(wr.Principal, wr.Op, uuid.Nil)
+		if err != nil {
+			return fmt.Errorf("in application.AuthAccess %w", err)
+		}
+		return nil
+	}
+	u, err := userUUID(wr.Req.URL.Query())
+	if err != nil {
+		return fmt.Errorf("in application.AuthAccess %w", err)
+	}
+	err = a.Policy.Allow(wr.Principal, wr.Op, u)
+	if err != nil {
+		return fmt.Errorf("in application.AuthAccess %w", err)
+	}
+	if wr.Principal.Subject != u.String() {
+		a.log.WithUUID(wr.UUID).Warn("access to notifications of another user",
+			logger.String("subject", wr.Principal.Subject), logger.Any("roles", wr.Principal.Roles), logger.String("op", string(wr.Op)), logger.UUID("user", u))
+	}
+	return nil
+}
+
+// CreateApp creates app given in request body
+func (a *application) CreateApp(wr model.WrappedReq) (model.App, error) {
+	app, err := a.createApp(wr)
+	targets := []string{}
+	if app.ID != "" {
+		targets = append(targets, app.ID)
+	}
+	a.audit(wr, model.AuditAppCreate, "", targets, err)
+	if err != nil {
+		return model.App{}, err
+	}
+	return app, nil
+}
+
+// createApp returns app as requested if it is not created
+func (a *application) createApp(wr model.WrappedReq) (model.App, error) {
+	app := model.App{}
+	err := json.Unmarshal(wr.Body, &app)
+	if err != nil {
+		return model.App{}, fmt.Errorf("in application.CreateApp unable to parse body: %w", err)
+	}
+	for _, v := range app.Scope.Operations {
+		switch v {
+		case model.OperationWrite, model.OperationBroadcast:
+		default:
+			return app, fmt.Errorf("in application.CreateApp operation %q can not be granted to app", v)
+		}
+	}
+	created, err := a.Credentials.Create(app)
+	if err != nil {
+		return app, err
+	}
+	app = created
+	a.log.WithUUID(wr.UUID).Info("app created", logger.String("subject", wr.Principal.Subject), logger.String("app_id", app.ID))
+	return app, nil
+}
+
+// App returns app given by app_id parameter with metadata of its active secrets
+func (a *application) App(wr model.WrappedReq) (model.App, error) {
+	return a.Credentials.App(wr.Req.URL.Query().Get("app_id"))
+}
+
+// IssueSecret issues new secret of app given by app_id parameter
+func (a *application) IssueSecret(wr model.WrappedReq) (model.AppSecret, error) {
+	appID := wr.Req.URL.Query().Get("app_id")
+	sec, err := a.Credentials.Issue(appID)
+	if err != nil {
+		a.audit(wr, model.AuditSecretIssue, "", []string{appID}, err)
+		return model.AppSecret{}, err
+	}
+	a.audit(wr, model.AuditSecretIssue, "", []string{appID, sec.UUID.String()}, nil)
+	a.log.WithUUID(wr.UUID).Info("secret issued", logger.String("subject", wr.Principal.Subject), logger.String("app_id", appID), logger.UUID("secret", sec.UUID))
+	return sec, nil
+}
+
+// RevokeSecret revokes secret given by uuid parameter of app given by app_id parameter
+func (a *application) RevokeSecret(wr model.WrappedReq) error {
+	q := wr.Req.URL.Query()
+	appID := q.Get("app_id")
+	u, err := uuid.Parse(q.Get("uuid"))
+	if err != nil {
+		err = fmt.Errorf("in application.RevokeSecret request has invalid uuid parameter %q", q.Get("uuid"))
+		a.audit(wr, model.AuditSecretRevoke, "", []string{appID, q.Get("uuid")}, err)
+		return err
+	}
+	err = a.Credentials.RevokeSecret(appID, u)
+	a.audit(wr, model.AuditSecretRevoke, "", []string{appID, u.String()}, err)
+	if err != nil {
+		return err
+	}
+	a.log.WithUUID(wr.UUID).Info("secret revoked", logger.String("subject", wr.Principal.Subject), logger.String("app_id", appID), logger.UUID("secret", u))
+	return nil
+}
+
+// RevokeApp revokes app given by app_id parameter with all its secrets
+func (a *application) RevokeApp(wr model.WrappedReq) error {
+	appID := wr.Req.URL.Query().Get("app_id")
+	err := a.Credentials.Revoke(appID)
+	a.audit(wr, model.AuditAppRevoke, "", []string{appID}, err)
+	if err != nil {
+		return err
+	}
+	a.log.WithUUID(wr.UUID).Info("app revoked", logger.String("subject", wr.Principal.Subject), logger.String("app_id", appID))
+	return nil
+}
+
+func (a *application) Start() {
+	if a.Fanout != nil {
+		a.Fanout.Start()
+	}
+	a.log.Signal("application started")
+}
+
+// Stop waits for Fanout, closes Store and Saver, nothing can be logged after it.
+// Saver is closed last, asynchronous Saver writes all queued records before Close returns.
+// Close errors are returned, the one of Saver is also written to stderr as it can not be logged.
+func (a *application) Stop() error {
+	errs := make([]error, 0)
+	if a.Fanout != nil {
+		a.Fanout.Stop()
+	}
+	err := a.Store.Close()
+	if err != nil {
+		a.log.Error("in application.Stop unable to close store", logger.Err(err))
+		errs = append(errs, fmt.Errorf("in application.Stop unable to close store: %w", err))
+	}
+	if a.Sessions != nil {
+		err = a.Sessions.Close()
+		if err != nil {
+			a.log.Error("in application.Stop unable to close sessions", logger.Err(err))
+			errs = append(errs, fmt.Errorf("in application.Stop unable to close sessions: %w", err))
+		}
+	}
+	if a.Credentials != nil {
+		err = a.Credentials.Close()
+		if err != nil {
+			a.log.Error("in application.Stop unable to close credentials", logger.Err(err))
+			errs = append(errs, fmt.Errorf("in application.Stop unable to close credentials: %w", err))
+		}
+	}
+	if a.Auditor != nil {
+		err = a.Auditor.Close()
+		if err != nil {
+			a.log.Error("in application.Stop unable to close auditor", logger.Err(err))
+			errs = append(errs, fmt.Errorf("in application.Stop unable to close auditor: %w", err))
+		}
+	}
+	a.log.Signal("application stopped")
+	err = a.Saver.Close()
+	if err != nil {
+		err = fmt.Errorf("in application.Stop unable to close saver: %w", err)
+		fmt.Fprintln(a.stderr, err)
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (a *application) Logger() logger.Logger {
+	return a.log
+}
+
+// SetLogLevel changes minimal log level to l on behalf of wr.Principal, change is logged and audited
+func (a *application) SetLogLevel(wr model.WrappedReq, l model.Level) {
+	old := a.log.Level()
+	a.log.SetLevel(l)
+	a.log.WithUUID(wr.UUID).Warn("log level changed", logger.String("level", l.Name()), logger.String("subject", wr.Principal.Subject))
+	a.audit(wr, model.AuditLogLevel, "", []string{old.Name(), l.Name()}, nil)
+}
+
+// Redactions returns number of log records every redaction rule fired on by stream, empty if Saver does not redact
+func (a *application) Redactions() map[string]map[string]uint64 {
+	if r, ok := a.Saver.(saver.RedactionCounter); ok {
+		if res := r.Redactions(); res != nil {
+			return res
+		}
+	}
+	return map[string]map[string]uint64{}
 }
 
-// Receiver implementation
+// digests reads all user's notifications matching q and collapses them
+func (a *application) digests(u uuid.UUID, q url.Values) ([]model.Digest, error) {
+	n, err := a.Store.Count(u, q)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, model.ErrNoRows
+	}
+	all := url.Values{}
+	for i, v := range q {
+		all[i] = v
+	}
+	all.Set("page", "1")
+	all.Set("per_page", strconv.Itoa(n))
+	rows, err := a.Store.Read(u, all)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]model.NotificationDataStructured, 0, len(rows))
+	for _, v := range rows {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var item model.NotificationDataStructured
+		err = json.Unmarshal(b, &item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return a.Aggregator.Collapse(items), nil
+}
+
+func userUUID(q url.Values) (uuid.UUID, error) {
+	s := q.Get("user_uuid")
+	if s == "" {
+		return uuid.Nil, errors.New("request has empty user_uuid parameter")
+	}
+	u, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("request has invalid user_uuid parameter %q", s)
+	}
+	return u, nil
+}
+
+func validate(n model.NotificationDataStructured) error {
+	if n.UserUUID == uuid.Nil {
+		return errors.New("empty user_uuid")
+	}
+	if n.UUID == uuid.Nil {
+		return errors.New("empty uuid")
+	}
+	if n.Category == "" {
+		return errors.New("empty category")
+	}
+	if n.Time().IsZero() {
+		return fmt.Errorf("invalid created_at %q", n.CreatedAt)
+	}
+	if n.Priority != "" && !n.Priority.Valid() {
+		return fmt.Errorf("invalid priority %q", n.Priority)
+	}
+	return nil
+}
+
+func marshalAll[T any](items []T) ([][]byte, error) {
+	res := make([][]byte, 0, len(items))
+	for _, v := range items {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, b)
+	}
+	return res, nil
+}
+
+// audit records action of wr on targets of user's notifications with outcome given by err
+func (a *application) audit(wr model.WrappedReq, action model.AuditAction, user string, targets []string, err error) {
+	if a.Auditor == nil {
+		return
+	}
+	a.record(wr, action, auditEntry(wr, action, user, targets, err))
+}
+
+// auditItems records action of wr on items with outcome given by err, one entry per owner of items
+func (a *application) auditItems(wr model.WrappedReq, action model.AuditAction, items []model.NotificationDataStructured, err error) {
+	if a.Auditor == nil {
+		return
+	}
+	a.record(wr, action, auditEntry(wr, action, "", nil, err).ByUser(items)...)
+}
+
+// auditBroadcast records chunk of broadcast written by Fanout on behalf of app that submitted it
+func (a *application) auditBroadcast(b model.Broadcast, items []model.NotificationDataStructured, err error) {
+	wr := model.WrappedReq{UUID: b.Request, Identity: model.AppIdentity{AppID: b.AppID}}
+	a.auditItems(wr, model.AuditBroadcast, items, err)
+}
+
+// denied records request to path denied with err
+func (a *application) denied(wr model.WrappedReq, user string, err error) {
+	a.audit(wr, model.AuditDenied, user, []string{wr.Req.URL.Path}, err)
+}
+
+// record passes entries to Auditor, failure to record is logged
+func (a *application) record(wr model.WrappedReq, action model.AuditAction, es ...model.AuditEntry) {
+	err := a.Auditor.Record(es...)
+	if err != nil {
+		a.log.WithUUID(wr.UUID).Error("in application.audit unable to record entry", logger.String("action", string(action)), logger.Err(err))
+	}
+}
+
+// auditEntry returns entry of action of wr on targets of user's notifications with outcome given by err.
+// Actor is app if request is made by app, otherwise user, anonymous if neither is known.
+func auditEntry(wr model.WrappedReq, action model.AuditAction, user string, targets []string, err error) model.AuditEntry {
+	e := model.AuditEntry{
+		Request:   wr.UUID,
+		Actor:     wr.Principal.Subject,
+		ActorKind: "user",
+		Action:    action,
+		User:      user,
+		Targets:   targets,
+		Outcome:   model.AuditSuccess,
+	}
+	if wr.Identity.AppID != "" {
+		e.Actor, e.ActorKind = wr.Identity.AppID, "app"
+	}
+	if e.Actor == "" {
+		e.ActorKind = "anonymous"
+	}
+	if e.Targets == nil {
+		e.Targets = []string{}
+	}
+	if err != nil {
+		e.Outcome, e.Error = model.AuditFailure, err.Error()
+	}
+	return e
+}
+
+func uuidStrings(us []uuid.UUID) []string {
+	res := make([]string, 0, len(us))
+	for _, v := range us {
+		res = append(res, v.String())
+	}
+	return res
+}
+
+// userString returns empty string for nil uuid
+func userString(u uuid.UUID) string {
+	if u == uuid.Nil {
+		return ""
+	}
+	return u.String()
+}
@@ -0,0 +1,654 @@
+package application
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/middle/aggregator"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/middle/fanout"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/auditor"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/authorizer"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/credentials"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/saver"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/store"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/logger"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/runtimeops"
+)
+
+type applicationSuite struct {
+	suite.Suite
+}
+
+func TestApplicationSuite(t *testing.T) {
+	suite.Run(t, new(applicationSuite))
+}
+
+type mockSaver struct {
+	mu   sync.Mutex
+	logs []model.WrappedLog
+}
+
+func (m *mockSaver) Save(wl model.WrappedLog) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logs = append(m.logs, wl)
+	return nil
+}
+func (m *mockSaver) Flush() error { return nil }
+func (m *mockSaver) Close() error { return nil }
+
+type failingSaver struct {
+	mockSaver
+}
+
+func (m *failingSaver) Close() error { return errors.New("disk is full") }
+
+type mockAuthorizer struct {
+	claims model.Claims
+	addr   netip.Addr
+	err    error
+}
+
+func (m *mockAuthorizer) Internal(model.WrappedReq) (model.AppIdentity, error) {
+	return model.AppIdentity{}, m.err
+}
+func (m *mockAuthorizer) External(model.WrappedReq) (model.AppIdentity, error) {
+	return model.AppIdentity{}, m.err
+}
+func (m *mockAuthorizer) User(model.WrappedReq) (model.Claims, error) {
+	return m.claims, m.err
+}
+func (m *mockAuthorizer) ClientAddr(wr model.WrappedReq) (netip.Addr, error) {
+	return m.addr, m.err
+}
+
+const userUUIDStr = "2593ede0-2301-4480-a452-752f03dcfab0"
+
+func newTestApp() *application {
+	st := store.NewMemStore()
+	return NewApplication(Adapters{
+		Store:       st,
+		Saver:       &mockSaver{},
+		Aggregator:  aggregator.NewAggregator(time.Hour),
+		Fanout:      fanout.NewFanout(st, 500, 10),
+		Credentials: credentials.NewMemCredentials(),
+	})
+}
+
+func batch(items ...model.NotificationDataStructured) model.WrappedReq {
+	b, _ := json.Marshal(items)
+	return model.WrappedReq{
+		UUID: uuid.New(),
+		Req:  httptest.NewRequest("PUT", "/api/v1/notifications/batch", nil),
+		Body: b,
+	}
+}
+
+func get(query string) model.WrappedReq {
+	return model.WrappedReq{
+		UUID: uuid.New(),
+		Req:  httptest.NewRequest("GET", "/api/v1/notifications?"+query, nil),
+	}
+}
+
+func (s *applicationSuite) TestSaveValidation() {
+	a := newTestApp()
+	u := uuid.MustParse(userUUIDStr)
+
+	s.Error(a.Save(batch()))
+	s.Error(a.Save(batch(model.NotificationDataStructured{UserUUID: u, UUID: uuid.New(), Category: "c", CreatedAt: "yesterday"})))
+	s.Error(a.Save(batch(model.NotificationDataStructured{UUID: uuid.New(), Category: "c", CreatedAt: "2022-10-02T12:43:46.000000Z"})))
+	s.NoError(a.Save(batch(model.NotificationDataStructured{UserUUID: u, UUID: uuid.New(), Category: "c", CreatedAt: "2022-10-02T12:43:46.000000Z"})))
+}
+
+func (s *applicationSuite) TestViews() {
+	a := newTestApp()
+	u := uuid.MustParse(userUUIDStr)
+	obj := uuid.New()
+	s.NoError(a.Save(batch(
+		model.NotificationDataStructured{UserUUID: u, UUID: uuid.New(), ObjectUUID: obj, Category: "new_rank", Name: "X", CreatedAt: "2022-10-02T12:10:00.000000Z"},
+		model.NotificationDataStructured{UserUUID: u, UUID: uuid.New(), ObjectUUID: obj, Category: "new_rank", Name: "X", CreatedAt: "2022-10-02T12:20:00.000000Z"},
+		model.NotificationDataStructured{UserUUID: u, UUID: uuid.New(), ObjectUUID: obj, Category: "new_rank", Name: "X", CreatedAt: "2022-10-02T12:30:00.000000Z"},
+		model.NotificationDataStructured{UserUUID: u, UUID: uuid.New(), ObjectUUID: uuid.New(), Category: "new_rank", Name: "Y", CreatedAt: "2022-10-02T12:40:00.000000Z"},
+	)))
+
+	tt := []struct {
+		name      string
+		query     string
+		wantCount int
+		wantLen   int
+		wantFirst map[string]interface{}
+	}{
+		{
+			name:      "expanded by default",
+			query:     "user_uuid=" + userUUIDStr,
+			wantCount: 4,
+			wantLen:   4,
+			wantFirst: map[string]interface{}{"name": "Y"},
+		},
+		{
+			name:      "expanded",
+			query:     "user_uuid=" + userUUIDStr + "&view=expanded&per_page=2",
+			wantCount: 4,
+			wantLen:   2,
+			wantFirst: map[string]interface{}{"name": "Y"},
+		},
+		{
+			name:      "collapsed",
+			query:     "user_uuid=" + userUUIDStr + "&view=collapsed",
+			wantCount: 2,
+			wantLen:   2,
+			wantFirst: map[string]interface{}{"name": "Y", "count": float64(1)},
+		},
+		{
+			name:      "collapsed second page",
+			query:     "user_uuid=" + userUUIDStr + "&view=collapsed&page=2&per_page=1",
+			wantCount: 2,
+			wantLen:   1,
+			wantFirst: map[string]interface{}{"name": "3 new events on X", "count": float64(3), "created_at": "2022-10-02T12:30:00.000000Z"},
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			n, err := a.Count(get(v.query))
+			s.NoError(err)
+			s.Equal(v.wantCount, n)
+
+			data, err := a.Extract(get(v.query))
+			s.NoError(err)
+			s.Len(data, v.wantLen)
+
+			first := make(map[string]interface{})
+			s.NoError(json.Unmarshal(data[0], &first))
+			for i, w := range v.wantFirst {
+				s.Equal(w, first[i], i)
+			}
+		})
+	}
+
+	_, err := a.Extract(get("user_uuid=" + userUUIDStr + "&view=sideways"))
+	s.Error(err)
+	_, err = a.Extract(get("user_uuid=" + uuid.NewString() + "&view=collapsed"))
+	s.ErrorIs(err, model.ErrNoRows)
+}
+
+func (s *applicationSuite) TestPriority() {
+	a := newTestApp()
+	a.Priorities = model.PriorityDefaults{"incident": model.PriorityUrgent}
+	u := uuid.MustParse(userUUIDStr)
+
+	s.Error(a.Save(batch(model.NotificationDataStructured{UserUUID: u, UUID: uuid.New(), Category: "c", Priority: "asap", CreatedAt: "2022-10-02T12:00:00.000000Z"})))
+	s.NoError(a.Save(batch(
+		model.NotificationDataStructured{UserUUID: u, UUID: uuid.New(), Category: "incident", Name: "a", CreatedAt: "2022-10-02T12:00:00.000000Z"},
+		model.NotificationDataStructured{UserUUID: u, UUID: uuid.New(), Category: "news", Name: "b", CreatedAt: "2022-10-02T12:10:00.000000Z"},
+		model.NotificationDataStructured{UserUUID: u, UUID: uuid.New(), Category: "news", Name: "c", Priority: model.PriorityLow, CreatedAt: "2022-10-02T12:20:00.000000Z"},
+	)))
+
+	data, err := a.Extract(get("user_uuid=" + userUUIDStr + "&sort_by=priority&order=desc"))
+	s.NoError(err)
+	got := make([]string, 0, len(data))
+	for _, v := range data {
+		n := model.NotificationDataStructured{}
+		s.NoError(json.Unmarshal(v, &n))
+		got = append(got, n.Name+":"+string(n.Priority))
+	}
+	s.Equal([]string{"a:urgent", "b:normal", "c:low"}, got)
+
+	n, err := a.Count(get("user_uuid=" + userUUIDStr + `&filter={"priority":{"type":"list","value":["urgent","high"]}}`))
+	s.NoError(err)
+	s.Equal(1, n)
+}
+
+func (s *applicationSuite) TestBroadcast() {
+	a := newTestApp()
+	a.Start()
+	defer a.Stop()
+	u := uuid.MustParse(userUUIDStr)
+	crm := model.AppIdentity{AppID: "crm", Subject: "crm"}
+
+	tt := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{
+			name: "users",
+			body: `{"users":["` + userUUIDStr + `"],"category":"news","name":"release"}`,
+		},
+		{
+			name:    "no recipients",
+			body:    `{"category":"news"}`,
+			wantErr: true,
+		},
+		{
+			name:    "users and segment",
+			body:    `{"users":["` + userUUIDStr + `"],"segment":"beta","category":"news"}`,
+			wantErr: true,
+		},
+		{
+			name:    "empty category",
+			body:    `{"users":["` + userUUIDStr + `"]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid priority",
+			body:    `{"users":["` + userUUIDStr + `"],"category":"news","priority":"asap"}`,
+			wantErr: true,
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			wr := model.WrappedReq{UUID: uuid.New(), Req: httptest.NewRequest("POST", "/api/v1/notifications/broadcast", nil), Body: []byte(v.body), Identity: crm}
+			id, err := a.Broadcast(wr)
+			if v.wantErr {
+				s.Error(err)
+				return
+			}
+			s.NoError(err)
+
+			var p model.BroadcastProgress
+			for i := 0; i < 100; i++ {
+				p, err = a.BroadcastProgress(model.WrappedReq{UUID: uuid.New(), Req: httptest.NewRequest("GET", "/api/v1/notifications/broadcast/progress?uuid="+id.String(), nil), Identity: crm})
+				s.NoError(err)
+				if p.State == model.BroadcastDone {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			s.Equal(model.BroadcastDone, p.State)
+			s.Equal(1, p.Done)
+			s.Equal("crm", p.AppID)
+
+			_, err = a.BroadcastProgress(model.WrappedReq{UUID: uuid.New(), Req: httptest.NewRequest("GET", "/api/v1/notifications/broadcast/progress?uuid="+id.String(), nil), Identity: model.AppIdentity{AppID: "mailer"}})
+			s.ErrorIs(err, model.ErrForbidden)
+		})
+	}
+
+	n, err := a.Count(get("user_uuid=" + u.String()))
+	s.NoError(err)
+	s.Equal(1, n)
+
+	_, err = a.BroadcastProgress(model.WrappedReq{UUID: uuid.New(), Req: httptest.NewRequest("GET", "/api/v1/notifications/broadcast/progress?uuid=x", nil)})
+	s.Error(err)
+}
+
+func (s *applicationSuite) TestClientIP() {
+	tt := []struct {
+		name   string
+		remote string
+		auth   *mockAuthorizer
+		want   string
+	}{
+		{name: "resolved", remote: "10.0.0.1:4000", auth: &mockAuthorizer{addr: netip.MustParseAddr("192.0.2.10")}, want: "192.0.2.10"},
+		{name: "hidden by proxy", remote: "10.0.0.1:4000", auth: &mockAuthorizer{}, want: "unknown"},
+		{name: "unparsable", remote: "pipe", auth: &mockAuthorizer{err: errors.New("unable to parse remote address")}, want: "pipe"},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			a := newTestApp()
+			a.Authorizer = v.auth
+			wr := get("user_uuid=" + userUUIDStr)
+			wr.Req.RemoteAddr = v.remote
+			s.Equal(v.want, a.ClientIP(wr))
+		})
+	}
+}
+
+func (s *applicationSuite) TestAuthUser() {
+	a := newTestApp()
+	a.Authorizer = &mockAuthorizer{claims: model.Claims{Subject: userUUIDStr, Roles: []model.Role{model.RoleSupport}}}
+	p, err := a.AuthUser(get("user_uuid=" + userUUIDStr))
+	s.NoError(err)
+	s.Equal(model.Principal{Subject: userUUIDStr, Roles: []model.Role{model.RoleSupport}}, p)
+
+	a.Authorizer = &mockAuthorizer{err: errors.New("token is expired")}
+	_, err = a.AuthUser(get("user_uuid=" + userUUIDStr))
+	s.Error(err)
+}
+
+func (s *applicationSuite) TestAuthInternal() {
+	a := newTestApp()
+	saver := a.Saver.(*mockSaver)
+	wr := batch()
+
+	a.Authorizer = &mockAuthorizer{err: errors.New("in authorizer.Internal request has no verified client certificate")}
+	_, err := a.AuthInternal(wr)
+	s.Error(err)
+	s.Empty(saver.logs)
+
+	a.Authorizer = &mockAuthorizer{err: fmt.Errorf("in authorizer.Internal %w: 198.51.100.7 to route group \"notifications\"", authorizer.ErrNetworkDenied)}
+	_, err = a.AuthInternal(wr)
+	s.True(errors.Is(err, authorizer.ErrNetworkDenied))
+	s.Len(saver.logs, 1)
+	s.Equal(model.UUIDWrapper{UUID: wr.UUID, Str: "WARN"}, saver.logs[0].UW)
+	s.Equal("error", saver.logs[0].F[0].Key)
+	s.ErrorContains(saver.logs[0].F[0].Value.(error), "198.51.100.7")
+}
+
+func (s *applicationSuite) TestAuthAccess() {
+	other := "f593ede0-2301-4480-a452-752f03dcfab0"
+	user := model.Principal{Subject: userUUIDStr, Roles: []model.Role{model.RoleUser}}
+	support := model.Principal{Subject: uuid.NewString(), Roles: []model.Role{model.RoleSupport}}
+	auditor := model.Principal{Subject: uuid.NewString(), Roles: []model.Role{model.RoleAuditor}}
+	admin := model.Principal{Subject: uuid.NewString(), Roles: []model.Role{model.RoleAdmin}}
+
+	tt := []struct {
+		name      string
+		principal model.Principal
+		op        model.Operation
+		query     string
+		wantErr   bool
+		wantLog   bool
+	}{
+		{
+			name:      "user reads own",
+			principal: user,
+			op:        model.OperationRead,
+			query:     "user_uuid=" + userUUIDStr,
+		},
+		{
+			name:      "user deletes own",
+			principal: user,
+			op:        model.OperationDelete,
+			query:     "user_uuid=" + userUUIDStr,
+		},
+		{
+			name:      "user reads other",
+			principal: user,
+			op:        model.OperationRead,
+			query:     "user_uuid=" + other,
+			wantErr:   true,
+		},
+		{
+			name:      "support reads other",
+			principal: support,
+			op:        model.OperationRead,
+			query:     "user_uuid=" + other,
+			wantLog:   true,
+		},
+		{
+			name:      "support deletes other",
+			principal: support,
+			op:        model.OperationDelete,
+			query:     "user_uuid=" + other,
+			wantErr:   true,
+		},
+		{
+			name:      "auditor reads other",
+			principal: auditor,
+			op:        model.OperationRead,
+			query:     "user_uuid=" + other,
+			wantLog:   true,
+		},
+		{
+			name:      "auditor marks read",
+			principal: auditor,
+			op:        model.OperationMarkRead,
+			query:     "user_uuid=" + other,
+			wantErr:   true,
+		},
+		{
+			name:      "admin deletes other",
+			principal: admin,
+			op:        model.OperationDelete,
+			query:     "user_uuid=" + other,
+			wantLog:   true,
+		},
+		{
+			name:      "user performs admin operation",
+			principal: user,
+			op:        model.OperationAdmin,
+			query:     "user_uuid=" + userUUIDStr,
+			wantErr:   true,
+		},
+		{
+			name:      "no user_uuid",
+			principal: admin,
+			op:        model.OperationRead,
+			query:     "",
+			wantErr:   true,
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			a := newTestApp()
+			saver := a.Saver.(*mockSaver)
+			wr := get(v.query)
+			wr.Op = v.op
+			wr.Principal = v.principal
+
+			err := a.AuthAccess(wr)
+			if v.wantErr {
+				s.Error(err)
+			} else {
+				s.NoError(err)
+			}
+			if !v.wantLog {
+				s.Empty(saver.logs)
+				return
+			}
+			s.Len(saver.logs, 1)
+			s.Equal(model.UUIDWrapper{UUID: wr.UUID, Str: "WARN"}, saver.logs[0].UW)
+			s.Contains(saver.logs[0].F, logger.String("subject", v.principal.Subject))
+			s.Contains(saver.logs[0].F, logger.String("user", other))
+			s.Contains(saver.logs[0].F, logger.String("op", string(v.op)))
+		})
+	}
+}
+
+func admin(method, url, body string) model.WrappedReq {
+	return model.WrappedReq{
+		UUID:      uuid.New(),
+		Req:       httptest.NewRequest(method, url, nil),
+		Body:      []byte(body),
+		Op:        model.OperationAdmin,
+		Principal: model.Principal{Subject: userUUIDStr, Roles: []model.Role{model.RoleAdmin}},
+	}
+}
+
+func (s *applicationSuite) TestApps() {
+	a := newTestApp()
+
+	wr := admin("POST", "/api/v1/admin/apps", "")
+	s.NoError(a.AuthAccess(wr))
+	wr.Principal.Roles = []model.Role{model.RoleSupport}
+	s.Error(a.AuthAccess(wr))
+
+	_, err := a.CreateApp(admin("POST", "/api/v1/admin/apps", `{"id":"crm","scope":{"operations":["read"]}}`))
+	s.Error(err)
+	_, err = a.CreateApp(admin("POST", "/api/v1/admin/apps", `{"id":"crm","scope":{"operations":["delete"]}}`))
+	s.Error(err)
+	app, err := a.CreateApp(admin("POST", "/api/v1/admin/apps", `{"id":"crm","name":"CRM","scope":{"operations":["write"]}}`))
+	s.NoError(err)
+	s.Equal("crm", app.ID)
+	s.False(app.CreatedAt.IsZero())
+
+	first, err := a.IssueSecret(admin("POST", "/api/v1/admin/apps/secret?app_id=crm", ""))
+	s.NoError(err)
+	s.NotEmpty(first.Secret)
+	_, err = a.IssueSecret(admin("POST", "/api/v1/admin/apps/secret?app_id=crm", ""))
+	s.NoError(err)
+	_, err = a.IssueSecret(admin("POST", "/api/v1/admin/apps/secret?app_id=crm", ""))
+	s.ErrorIs(err, credentials.ErrTooManySecrets)
+
+	got, err := a.App(admin("GET", "/api/v1/admin/apps/info?app_id=crm", ""))
+	s.NoError(err)
+	s.Equal("CRM", got.Name)
+	s.Len(got.Secrets, 2)
+	s.Equal(first.UUID, got.Secrets[0].UUID)
+	s.Empty(got.Secrets[0].Secret)
+	_, err = a.App(admin("GET", "/api/v1/admin/apps/info?app_id=shop", ""))
+	s.ErrorIs(err, credentials.ErrUnknownApp)
+
+	s.Error(a.RevokeSecret(admin("POST", "/api/v1/admin/apps/secret/revoke?app_id=crm&uuid=x", "")))
+	s.NoError(a.RevokeSecret(admin("POST", "/api/v1/admin/apps/secret/revoke?app_id=crm&uuid="+first.UUID.String(), "")))
+	_, err = a.IssueSecret(admin("POST", "/api/v1/admin/apps/secret?app_id=crm", ""))
+	s.NoError(err)
+
+	s.NoError(a.RevokeApp(admin("POST", "/api/v1/admin/apps/revoke?app_id=crm", "")))
+	s.Error(a.RevokeApp(admin("POST", "/api/v1/admin/apps/revoke?app_id=crm", "")))
+	_, err = a.IssueSecret(admin("POST", "/api/v1/admin/apps/secret?app_id=crm", ""))
+	s.ErrorIs(err, credentials.ErrRevokedApp)
+}
+
+func (s *applicationSuite) TestStopFlushesSaver() {
+	logs := &mockSaver{}
+	st := store.NewMemStore()
+	a := NewApplication(Adapters{
+		Store:  st,
+		Saver:  saver.NewAsyncSaver(logs, saver.AsyncConfig{QueueSize: 4, BatchSize: 2}),
+		Fanout: fanout.NewFanout(st, 500, 10),
+	})
+	a.Start()
+	for i := 0; i < 20; i++ {
+		a.Logger().Info("request handled")
+	}
+	s.NoError(a.Stop())
+
+	s.Len(logs.logs, 22)
+	s.Equal("application started", logs.logs[0].L)
+	s.Equal("application stopped", logs.logs[21].L)
+	s.Error(a.Saver.Save(model.WrappedLog{}))
+}
+
+func (s *applicationSuite) TestStopSaverError() {
+	a := NewApplication(Adapters{
+		Store: store.NewMemStore(),
+		Saver: &failingSaver{},
+	})
+	stderr := &bytes.Buffer{}
+	a.stderr = stderr
+	err := a.Stop()
+	s.ErrorContains(err, "unable to close saver: disk is full")
+	s.Equal("in application.Stop unable to close saver: disk is full\n", stderr.String())
+}
+
+func (s *applicationSuite) TestRedactions() {
+	a := newTestApp()
+	s.Equal(map[string]map[string]uint64{}, a.Redactions())
+
+	st := store.NewMemStore()
+	a = NewApplication(Adapters{
+		Store: st,
+		Saver: saver.NewAsyncSaver(saver.NewSaverWithConfig(saver.Config{Folder: s.T().TempDir(), Sep: runtimeops.GetSep(), Limit: 1000}), saver.AsyncConfig{}),
+	})
+	a.Logger().WithUUID(uuid.New()).Info("logged in", logger.String("subject", "2593ede0-2301-4480-a452-752f03dcfab0"))
+	a.Stop()
+	s.Equal(map[string]map[string]uint64{"all": {"subject": 1}}, a.Redactions())
+}
+
+func (s *applicationSuite) TestAudit() {
+	path := filepath.Join(s.T().TempDir(), "audit.log")
+	au, err := auditor.NewFileAuditor(path)
+	s.NoError(err)
+	a := newTestApp()
+	a.Auditor = au
+	a.Start()
+
+	other := "f593ede0-2301-4480-a452-752f03dcfab0"
+	crm := model.AppIdentity{AppID: "crm"}
+	u := uuid.MustParse(userUUIDStr)
+	n := model.NotificationDataStructured{UserUUID: u, UUID: uuid.New(), Category: "c", CreatedAt: "2022-10-02T12:43:46.000000Z"}
+	n2 := model.NotificationDataStructured{UserUUID: uuid.MustParse(other), UUID: uuid.New(), Category: "c", CreatedAt: "2022-10-02T12:43:46.000000Z"}
+	wr := batch(n, n2)
+	wr.Identity = crm
+	s.NoError(a.Save(wr))
+	wr = batch()
+	wr.Identity = crm
+	s.Error(a.Save(wr))
+
+	change := func(url string) model.WrappedReq {
+		return model.WrappedReq{
+			UUID:      uuid.New(),
+			Req:       httptest.NewRequest("POST", url+"?user_uuid="+userUUIDStr, nil),
+			Body:      []byte(`{"uuids":["` + n.UUID.String() + `"]}`),
+			Principal: model.Principal{Subject: "support", Roles: []model.Role{model.RoleSupport}},
+		}
+	}
+	_, err = a.MarkRead(change("/api/v1/notifications/read"))
+	s.NoError(err)
+	_, err = a.Delete(change("/api/v1/notifications/delete"))
+	s.NoError(err)
+	_, err = a.CreateApp(admin("POST", "/api/v1/admin/apps", `{"id":"crm","name":"CRM","scope":{"operations":["write"]}}`))
+	s.NoError(err)
+	s.Error(a.RevokeSecret(admin("POST", "/api/v1/admin/apps/secret/revoke?app_id=crm&uuid=x", "")))
+	a.SetLogLevel(admin("POST", "/api/v1/admin/loglevel", `{"level":"debug"}`), model.LevelDebug)
+
+	// denied requests
+	wr = get("user_uuid=" + other)
+	wr.Op, wr.Principal = model.OperationRead, model.Principal{Subject: userUUIDStr, Roles: []model.Role{model.RoleUser}}
+	s.Error(a.AuthAccess(wr))
+	a.Authorizer = &mockAuthorizer{err: errors.New("in authorizer.External signature does not match")}
+	_, err = a.AuthExternal(batch())
+	s.Error(err)
+
+	// broadcast writes are recorded by Fanout on behalf of app
+	wr = model.WrappedReq{UUID: uuid.New(), Req: httptest.NewRequest("POST", "/api/v1/notifications/broadcast", nil), Identity: crm,
+		Body: []byte(`{"users":["` + userUUIDStr + `","` + other + `"],"category":"news"}`)}
+	id, err := a.Broadcast(wr)
+	s.NoError(err)
+	for i := 0; i < 100; i++ {
+		p, err := a.Fanout.Progress(id)
+		s.NoError(err)
+		if p.State == model.BroadcastDone {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.NoError(a.Stop())
+	s.ErrorContains(au.Record(model.AuditEntry{}), "file already closed")
+
+	b, err := os.ReadFile(path)
+	s.NoError(err)
+	lines := bytes.SplitAfter(b, []byte("\n"))
+	lines = lines[:len(lines)-1]
+	want := []model.AuditEntry{
+		{Seq: 1, Actor: "crm", ActorKind: "app", Action: model.AuditSave, User: userUUIDStr, Targets: []string{n.UUID.String()}, Outcome: model.AuditSuccess},
+		{Seq: 2, Actor: "crm", ActorKind: "app", Action: model.AuditSave, User: other, Targets: []string{n2.UUID.String()}, Outcome: model.AuditSuccess},
+		{Seq: 3, Actor: "crm", ActorKind: "app", Action: model.AuditSave, Targets: []string{}, Outcome: model.AuditFailure, Error: "in application.Save request has empty batch"},
+		{Seq: 4, Actor: "support", ActorKind: "user", Action: model.AuditMarkRead, User: userUUIDStr, Targets: []string{n.UUID.String()}, Outcome: model.AuditSuccess},
+		{Seq: 5, Actor: "support", ActorKind: "user", Action: model.AuditDelete, User: userUUIDStr, Targets: []string{n.UUID.String()}, Outcome: model.AuditSuccess},
+		{Seq: 6, Actor: userUUIDStr, ActorKind: "user", Action: model.AuditAppCreate, Targets: []string{"crm"}, Outcome: model.AuditSuccess},
+		{Seq: 7, Actor: userUUIDStr, ActorKind: "user", Action: model.AuditSecretRevoke, Targets: []string{"crm", "x"}, Outcome: model.AuditFailure, Error: `in application.RevokeSecret request has invalid uuid parameter "x"`},
+		{Seq: 8, Actor: userUUIDStr, ActorKind: "user", Action: model.AuditLogLevel, Targets: []string{"INFO", "DEBUG"}, Outcome: model.AuditSuccess},
+		{Seq: 9, Actor: userUUIDStr, ActorKind: "user", Action: model.AuditDenied, User: other, Targets: []string{"/api/v1/notifications"}, Outcome: model.AuditFailure, Error: "in application.AuthAccess " + userUUIDStr + ` with roles [user] may not perform "read" on notifications of user ` + other},
+		{Seq: 10, Actor: "", ActorKind: "anonymous", Action: model.AuditDenied, Targets: []string{"/api/v1/notifications/batch"}, Outcome: model.AuditFailure, Error: "in authorizer.External signature does not match"},
+		{Seq: 11, Actor: "crm", ActorKind: "app", Action: model.AuditBroadcast, User: userUUIDStr, Targets: []string{}, Outcome: model.AuditSuccess},
+		{Seq: 12, Actor: "crm", ActorKind: "app", Action: model.AuditBroadcast, User: other, Targets: []string{}, Outcome: model.AuditSuccess},
+	}
+	s.Len(lines, len(want))
+	for i, v := range lines {
+		e := model.AuditEntry{}
+		s.NoError(json.Unmarshal(v, &e))
+		s.NotEqual(uuid.Nil, e.Request)
+		s.False(e.Time.IsZero())
+		if e.Action == model.AuditBroadcast {
+			s.Equal(wr.UUID, e.Request)
+			s.Len(e.Targets, 1)
+			e.Targets = []string{}
+		}
+		e.Request, e.Time, e.Prev, e.Hash = uuid.Nil, time.Time{}, "", ""
+		s.Equal(want[i], e)
+	}
+	cnt, _, err := auditor.VerifyFile(path)
+	s.NoError(err)
+	s.Equal(len(want), cnt)
+
+	// delete disguised as mark-read breaks the chain
+	lines[4] = bytes.Replace(lines[4], []byte(`"action":"delete"`), []byte(`"action":"mark_read"`), 1)
+	s.NoError(os.WriteFile(path, bytes.Join(lines, nil), 0640))
+	_, _, err = auditor.VerifyFile(path)
+	s.ErrorContains(err, "line 5: hash does not match")
+}
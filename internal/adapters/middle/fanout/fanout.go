@@ -0,0 +1,275 @@
+package fanout
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/store"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+type Fanout interface {
+	Submit(model.Broadcast) (uuid.UUID, error)
+	Progress(uuid.UUID) (model.BroadcastProgress, error)
+	Start()
+	Stop()
+}
+
+// WriteObserver is Fanout reporting every chunk of broadcast written to Store
+type WriteObserver interface {
+	OnWrite(func(model.Broadcast, []model.NotificationDataStructured, error))
+}
+
+// Fanout implementation
+
+var (
+	ErrQueueFull = errors.New("broadcast queue is full")
+	ErrNotFound  = errors.New("broadcast not found")
+	ErrStopped   = errors.New("fanout is stopped")
+)
+
+const (
+	DefaultChunk    = 500
+	DefaultMaxQueue = 100
+
+	// finished broadcasts whose progress is kept
+	keepFinished = 1000
+)
+
+type job struct {
+	id uuid.UUID
+	b  model.Broadcast
+}
+
+type fanout struct {
+	store    store.Store
+	chunk    int
+	maxQueue int
+	onWrite  func(model.Broadcast, []model.NotificationDataStructured, error)
+
+	mu       sync.Mutex
+	queue    []job
+	progress map[uuid.UUID]*model.BroadcastProgress
+	finished []uuid.UUID
+
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	stopped  bool
+	wg       sync.WaitGroup
+}
+
+// NewFanout returns Fanout writing broadcasts to s in chunks of chunk users.
+// At most maxQueue broadcasts wait in queue, so memory stays bounded by queue and chunk size.
+// Not positive chunk and maxQueue are replaced by DefaultChunk and DefaultMaxQueue.
+func NewFanout(s store.Store, chunk, maxQueue int) *fanout {
+	if chunk <= 0 {
+		chunk = DefaultChunk
+	}
+	if maxQueue <= 0 {
+		maxQueue = DefaultMaxQueue
+	}
+	return &fanout{
+		store:    s,
+		chunk:    chunk,
+		maxQueue: maxQueue,
+		progress: make(map[uuid.UUID]*model.BroadcastProgress),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Submit queues broadcast and returns its uuid. Urgent broadcasts are queued ahead of others.
+func (f *fanout) Submit(b model.Broadcast) (uuid.UUID, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.stopped {
+		return uuid.Nil, ErrStopped
+	}
+	if len(f.queue) >= f.maxQueue {
+		return uuid.Nil, ErrQueueFull
+	}
+	j := job{id: uuid.New(), b: b}
+	pos := len(f.queue)
+	if b.Priority == model.PriorityUrgent {
+		pos = 0
+		for pos < len(f.queue) && f.queue[pos].b.Priority == model.PriorityUrgent {
+			pos++
+		}
+	}
+	f.queue = append(f.queue, job{})
+	copy(f.queue[pos+1:], f.queue[pos:])
+	f.queue[pos] = j
+
+	f.progress[j.id] = &model.BroadcastProgress{
+		UUID:  j.id,
+		AppID: b.AppID,
+		State: model.BroadcastQueued,
+		Total: len(b.Users),
+	}
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+	return j.id, nil
+}
+
+func (f *fanout) Progress(id uuid.UUID) (model.BroadcastProgress, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.progress[id]
+	if !ok {
+		return model.BroadcastProgress{}, ErrNotFound
+	}
+	return *p, nil
+}
+
+// OnWrite sets function called after every chunk is written to Store with its notifications and write error.
+// It must be set before Start.
+func (f *fanout) OnWrite(fn func(model.Broadcast, []model.NotificationDataStructured, error)) {
+	f.onWrite = fn
+}
+
+// Start runs single worker processing queue
+func (f *fanout) Start() {
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		for {
+			select {
+			case <-f.stop:
+				return
+			case <-f.wake:
+			}
+			for {
+				j, ok := f.next()
+				if !ok {
+					break
+				}
+				f.run(j)
+				select {
+				case <-f.stop:
+					return
+				default:
+				}
+			}
+		}
+	}()
+}
+
+// Stop waits for broadcast being written and cancels queued ones. Stop may be called more than once.
+func (f *fanout) Stop() {
+	f.stopOnce.Do(func() {
+		f.mu.Lock()
+		f.stopped = true
+		f.mu.Unlock()
+
+		close(f.stop)
+		f.wg.Wait()
+		f.cancelQueued()
+	})
+}
+
+// cancelQueued marks broadcasts left in queue as cancelled
+func (f *fanout) cancelQueued() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, v := range f.queue {
+		p := f.progress[v.id]
+		p.State = model.BroadcastCancelled
+		p.Error = ErrStopped.Error()
+	}
+	f.queue = nil
+}
+
+func (f *fanout) next() (job, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.queue) == 0 {
+		return job{}, false
+	}
+	j := f.queue[0]
+	f.queue[0] = job{}
+	f.queue = f.queue[1:]
+	f.progress[j.id].State = model.BroadcastRunning
+	return j, true
+}
+
+func (f *fanout) run(j job) {
+	if j.b.CreatedAt == "" {
+		j.b.CreatedAt = now()
+	}
+	write := func(users []uuid.UUID) error {
+		items := make([]model.NotificationDataStructured, 0, len(users))
+		for _, v := range users {
+			items = append(items, model.NotificationDataStructured{
+				UserUUID:    v,
+				Category:    j.b.Category,
+				UUID:        uuid.New(),
+				ObjectUUID:  j.b.ObjectUUID,
+				Name:        j.b.Name,
+				Description: j.b.Description,
+				CreatedAt:   j.b.CreatedAt,
+				Priority:    j.b.Priority,
+			})
+		}
+		err := f.store.Write(items, j.id)
+		if f.onWrite != nil {
+			f.onWrite(j.b, items, err)
+		}
+		if err != nil {
+			return err
+		}
+		f.mu.Lock()
+		p := f.progress[j.id]
+		p.Done += len(users)
+		if j.b.Segment != "" {
+			p.Total = p.Done
+		}
+		f.mu.Unlock()
+		return nil
+	}
+
+	var err error
+	if j.b.Segment != "" {
+		err = f.store.Segment(j.b.Segment, f.chunk, write)
+	} else {
+		for i := 0; i < len(j.b.Users) && err == nil; i += f.chunk {
+			end := i + f.chunk
+			if end > len(j.b.Users) {
+				end = len(j.b.Users)
+			}
+			err = write(j.b.Users[i:end])
+		}
+	}
+	f.finish(j.id, err)
+}
+
+func (f *fanout) finish(id uuid.UUID, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p := f.progress[id]
+	p.State = model.BroadcastDone
+	if err != nil {
+		p.State = model.BroadcastFailed
+		p.Error = fmt.Sprintf("%v", err)
+	}
+	f.finished = append(f.finished, id)
+	if len(f.finished) > keepFinished {
+		delete(f.progress, f.finished[0])
+		f.finished = f.finished[1:]
+	}
+}
+
+// now is created_at of broadcasts without one
+func now() string {
+	return time.Now().UTC().Format(model.CreatedAtLayout)
+}
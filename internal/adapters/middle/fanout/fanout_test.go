@@ -0,0 +1,253 @@
+package fanout
+
+import (
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/store"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+type fanoutSuite struct {
+	suite.Suite
+}
+
+func TestFanoutSuite(t *testing.T) {
+	suite.Run(t, new(fanoutSuite))
+}
+
+// countingStore records size of every written chunk
+type countingStore struct {
+	store.Store
+	mu     sync.Mutex
+	chunks []int
+	names  []string
+}
+
+func (c *countingStore) Write(items []model.NotificationDataStructured, u uuid.UUID) error {
+	c.mu.Lock()
+	c.chunks = append(c.chunks, len(items))
+	if len(items) > 0 {
+		c.names = append(c.names, items[0].Name)
+	}
+	c.mu.Unlock()
+	return c.Store.Write(items, u)
+}
+
+func users(n int) []uuid.UUID {
+	res := make([]uuid.UUID, 0, n)
+	for i := 0; i < n; i++ {
+		res = append(res, uuid.New())
+	}
+	return res
+}
+
+func wait(f *fanout, id uuid.UUID) model.BroadcastProgress {
+	for i := 0; i < 500; i++ {
+		p, _ := f.Progress(id)
+		if p.State == model.BroadcastDone || p.State == model.BroadcastFailed {
+			return p
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	p, _ := f.Progress(id)
+	return p
+}
+
+func (s *fanoutSuite) TestSubmit() {
+	mem := store.NewMemStore()
+	segment := users(1200)
+	mem.AddSegment("beta", segment)
+
+	tt := []struct {
+		name       string
+		b          model.Broadcast
+		wantTotal  int
+		wantChunks []int
+	}{
+		{
+			name:       "users",
+			b:          model.Broadcast{Users: users(10000), Category: "news", Name: "release", AppID: "crm"},
+			wantTotal:  10000,
+			wantChunks: []int{500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 500},
+		},
+		{
+			name:       "segment",
+			b:          model.Broadcast{Segment: "beta", Category: "news", Name: "beta"},
+			wantTotal:  1200,
+			wantChunks: []int{500, 500, 200},
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			cs := &countingStore{Store: mem}
+			f := NewFanout(cs, 500, 10)
+			f.Start()
+			defer f.Stop()
+
+			id, err := f.Submit(v.b)
+			s.NoError(err)
+
+			p := wait(f, id)
+			s.Equal(model.BroadcastDone, p.State)
+			s.Equal(v.b.AppID, p.AppID)
+			s.Equal(v.wantTotal, p.Total)
+			s.Equal(v.wantTotal, p.Done)
+			s.Equal(v.wantChunks, cs.chunks)
+		})
+	}
+
+	n, err := mem.Count(segment[0], url.Values{})
+	s.NoError(err)
+	s.Equal(1, n)
+}
+
+func (s *fanoutSuite) TestUnknown() {
+	f := NewFanout(store.NewMemStore(), 500, 10)
+	f.Start()
+	defer f.Stop()
+
+	_, err := f.Progress(uuid.New())
+	s.ErrorIs(err, ErrNotFound)
+
+	id, err := f.Submit(model.Broadcast{Segment: "missing", Category: "news"})
+	s.NoError(err)
+	s.Equal(model.BroadcastFailed, wait(f, id).State)
+}
+
+func (s *fanoutSuite) TestQueue() {
+	cs := &countingStore{Store: store.NewMemStore()}
+	f := NewFanout(cs, 500, 3)
+
+	for _, v := range []model.Broadcast{
+		{Users: users(1), Category: "news", Name: "first", Priority: model.PriorityNormal},
+		{Users: users(1), Category: "news", Name: "second", Priority: model.PriorityLow},
+		{Users: users(1), Category: "incident", Name: "urgent", Priority: model.PriorityUrgent},
+	} {
+		_, err := f.Submit(v)
+		s.NoError(err)
+	}
+	_, err := f.Submit(model.Broadcast{Users: users(1), Category: "news"})
+	s.ErrorIs(err, ErrQueueFull)
+
+	f.Start()
+	defer f.Stop()
+	for i := 0; i < 500; i++ {
+		cs.mu.Lock()
+		n := len(cs.names)
+		cs.mu.Unlock()
+		if n == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Equal([]string{"urgent", "first", "second"}, cs.names)
+}
+
+func (s *fanoutSuite) TestDefaults() {
+	tt := []struct {
+		name         string
+		chunk        int
+		maxQueue     int
+		wantChunk    int
+		wantMaxQueue int
+	}{
+		{
+			name:         "zero",
+			wantChunk:    DefaultChunk,
+			wantMaxQueue: DefaultMaxQueue,
+		},
+		{
+			name:         "negative",
+			chunk:        -1,
+			maxQueue:     -1,
+			wantChunk:    DefaultChunk,
+			wantMaxQueue: DefaultMaxQueue,
+		},
+		{
+			name:         "given",
+			chunk:        10,
+			maxQueue:     2,
+			wantChunk:    10,
+			wantMaxQueue: 2,
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			cs := &countingStore{Store: store.NewMemStore()}
+			f := NewFanout(cs, v.chunk, v.maxQueue)
+			s.Equal(v.wantChunk, f.chunk)
+			s.Equal(v.wantMaxQueue, f.maxQueue)
+
+			f.Start()
+			defer f.Stop()
+			id, err := f.Submit(model.Broadcast{Users: users(v.wantChunk + 1), Category: "news"})
+			s.NoError(err)
+			s.Equal(model.BroadcastDone, wait(f, id).State)
+			s.Equal([]int{v.wantChunk, 1}, cs.chunks)
+		})
+	}
+}
+
+func (s *fanoutSuite) TestStop() {
+	cs := &countingStore{Store: store.NewMemStore()}
+	f := NewFanout(cs, 500, 10)
+
+	ids := make([]uuid.UUID, 0)
+	for i := 0; i < 3; i++ {
+		id, err := f.Submit(model.Broadcast{Users: users(1), Category: "news"})
+		s.NoError(err)
+		ids = append(ids, id)
+	}
+	f.Stop()
+	f.Stop()
+
+	for _, v := range ids {
+		p, err := f.Progress(v)
+		s.NoError(err)
+		s.Equal(model.BroadcastCancelled, p.State)
+		s.Equal(ErrStopped.Error(), p.Error)
+	}
+	s.Empty(cs.chunks)
+
+	_, err := f.Submit(model.Broadcast{Users: users(1), Category: "news"})
+	s.ErrorIs(err, ErrStopped)
+}
+
+func (s *fanoutSuite) TestOnWrite() {
+	f := NewFanout(store.NewMemStore(), 2, 10)
+	var (
+		mu     sync.Mutex
+		chunks [][]model.NotificationDataStructured
+	)
+	f.OnWrite(func(b model.Broadcast, items []model.NotificationDataStructured, err error) {
+		s.NoError(err)
+		s.Equal("crm", b.AppID)
+		mu.Lock()
+		chunks = append(chunks, items)
+		mu.Unlock()
+	})
+	f.Start()
+	defer f.Stop()
+
+	us := users(3)
+	id, err := f.Submit(model.Broadcast{Users: us, Category: "news", AppID: "crm", Request: uuid.New()})
+	s.NoError(err)
+	s.Equal(model.BroadcastDone, wait(f, id).State)
+
+	mu.Lock()
+	defer mu.Unlock()
+	s.Len(chunks, 2)
+	got := make([]uuid.UUID, 0, len(us))
+	for _, c := range chunks {
+		for _, v := range c {
+			s.NotEqual(uuid.Nil, v.UUID)
+			got = append(got, v.UserUUID)
+		}
+	}
+	s.Equal(us, got)
+}
@@ -0,0 +1,181 @@
+package limiter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+// Token buckets per route, keyed by APPID, user_uuid and client IP
+type Limiter interface {
+	Allow(string, model.LimitKey) (time.Duration, error)
+	AllowIP(string, string) (time.Duration, error)
+	State() model.LimiterState
+}
+
+// Limiter implementation
+
+// ErrLimited is returned when request exceeds rate limit
+var ErrLimited = errors.New("rate limit exceeded")
+
+// Rate allows PerSecond requests on average and Burst requests at once. Zero Rate is not limited.
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+// Limit holds rates of route for every APPID, user_uuid and client IP
+type Limit struct {
+	App  Rate
+	User Rate
+	IP   Rate
+}
+
+// Config holds limits of routes, routes not listed get Default
+type Config struct {
+	Routes  map[string]Limit
+	Default Limit
+}
+
+type bucketKey struct {
+	route string
+	kind  string
+	value string
+}
+
+type part struct {
+	kind  string
+	value string
+	rate  Rate
+}
+
+type bucket struct {
+	rate    Rate
+	tokens  float64
+	updated time.Time
+}
+
+type limiter struct {
+	Config
+	mu      sync.Mutex
+	buckets map[bucketKey]*bucket
+	counts  map[string]model.RouteLimitState
+	pruned  time.Time
+	now     func() time.Time
+}
+
+func NewLimiter(c Config) *limiter {
+	return &limiter{
+		Config:  c,
+		buckets: make(map[bucketKey]*bucket),
+		counts:  make(map[string]model.RouteLimitState),
+		now:     time.Now,
+	}
+}
+
+// Allow takes token from buckets of every non-empty part of k on route.
+// If any bucket is empty, no token is taken and time after which request may be repeated is returned with ErrLimited.
+func (l *limiter) Allow(route string, k model.LimitKey) (time.Duration, error) {
+	lim := l.limit(route)
+	return l.take(route, []part{
+		{"app", k.AppID, lim.App},
+		{"user", k.User, lim.User},
+		{"ip", k.IP, lim.IP},
+	}, true)
+}
+
+// AllowIP takes token from bucket of client ip on route. It is checked before request is authenticated,
+// so only its rejections are counted, allowed request is counted by Allow.
+func (l *limiter) AllowIP(route, ip string) (time.Duration, error) {
+	return l.take(route, []part{{"ip", ip, l.limit(route).IP}}, false)
+}
+
+func (l *limiter) limit(route string) Limit {
+	lim, ok := l.Routes[route]
+	if !ok {
+		lim = l.Default
+	}
+	return lim
+}
+
+// take takes token from every bucket of parts or from none. Allowed request is counted if count is set.
+func (l *limiter) take(route string, parts []part, count bool) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.prune(now)
+
+	taken := make([]*bucket, 0, len(parts))
+	var (
+		wait   time.Duration
+		denied error
+	)
+	for _, v := range parts {
+		if v.value == "" || v.rate.PerSecond <= 0 || v.rate.Burst <= 0 {
+			continue
+		}
+		key := bucketKey{route: route, kind: v.kind, value: v.value}
+		b, ok := l.buckets[key]
+		if !ok {
+			b = &bucket{rate: v.rate, tokens: float64(v.rate.Burst), updated: now}
+			l.buckets[key] = b
+		}
+		b.tokens = math.Min(float64(v.rate.Burst), b.tokens+now.Sub(b.updated).Seconds()*v.rate.PerSecond)
+		b.updated = now
+		if b.tokens < 1 {
+			w := time.Duration((1 - b.tokens) / v.rate.PerSecond * float64(time.Second))
+			if w > wait {
+				wait = w
+			}
+			denied = fmt.Errorf("%w: %s %q on route %q", ErrLimited, v.kind, v.value, route)
+			continue
+		}
+		taken = append(taken, b)
+	}
+
+	c := l.counts[route]
+	if denied != nil {
+		c.Rejected++
+		l.counts[route] = c
+		return wait, denied
+	}
+	for _, v := range taken {
+		v.tokens--
+	}
+	if count {
+		c.Allowed++
+		l.counts[route] = c
+	}
+	return 0, nil
+}
+
+func (l *limiter) State() model.LimiterState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := model.LimiterState{
+		Buckets: len(l.buckets),
+		Routes:  make(map[string]model.RouteLimitState, len(l.counts)),
+	}
+	for i, v := range l.counts {
+		s.Routes[i] = v
+	}
+	return s
+}
+
+// prune removes buckets which are refilled, new bucket would be the same
+func (l *limiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < time.Minute {
+		return
+	}
+	for i, v := range l.buckets {
+		if v.tokens+now.Sub(v.updated).Seconds()*v.rate.PerSecond >= float64(v.rate.Burst) {
+			delete(l.buckets, i)
+		}
+	}
+	l.pruned = now
+}
@@ -0,0 +1,115 @@
+package limiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+type limiterSuite struct {
+	suite.Suite
+}
+
+func TestLimiterSuite(t *testing.T) {
+	suite.Run(t, new(limiterSuite))
+}
+
+const (
+	batchRoute = "/api/v1/notifications/batch"
+	countRoute = "/api/v1/notifications/count"
+)
+
+func (s *limiterSuite) TestAllow() {
+	clock := time.Date(2022, 10, 2, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(Config{
+		Routes: map[string]Limit{
+			batchRoute: {App: Rate{PerSecond: 1, Burst: 2}, IP: Rate{PerSecond: 10, Burst: 3}},
+			countRoute: {User: Rate{PerSecond: 0.5, Burst: 1}},
+		},
+	})
+	l.now = func() time.Time { return clock }
+
+	crm := model.LimitKey{AppID: "crm", IP: "192.0.2.10"}
+	mailer := model.LimitKey{AppID: "mailer", IP: "192.0.2.10"}
+	user := model.LimitKey{User: "2593ede0-2301-4480-a452-752f03dcfab0", IP: "192.0.2.10"}
+
+	tt := []struct {
+		name     string
+		after    time.Duration
+		route    string
+		key      model.LimitKey
+		wantWait time.Duration
+	}{
+		{name: "burst 1", route: batchRoute, key: crm},
+		{name: "burst 2", route: batchRoute, key: crm},
+		{name: "app bucket empty", route: batchRoute, key: crm, wantWait: time.Second},
+		{name: "other app, same IP", route: batchRoute, key: mailer},
+		{name: "IP bucket empty", route: batchRoute, key: mailer, wantWait: 100 * time.Millisecond},
+		{name: "refilled partially", after: 500 * time.Millisecond, route: batchRoute, key: crm, wantWait: 500 * time.Millisecond},
+		{name: "refilled", after: 500 * time.Millisecond, route: batchRoute, key: crm},
+		{name: "user", route: countRoute, key: user},
+		{name: "user bucket empty", route: countRoute, key: user, wantWait: 2 * time.Second},
+		{name: "route without limit", route: "/api/v1/notifications", key: user},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			clock = clock.Add(v.after)
+			wait, err := l.Allow(v.route, v.key)
+			if v.wantWait == 0 {
+				s.NoError(err)
+				return
+			}
+			s.True(errors.Is(err, ErrLimited))
+			s.InDelta(v.wantWait, wait, float64(time.Millisecond))
+		})
+	}
+
+	st := l.State()
+	s.Equal(model.RouteLimitState{Allowed: 4, Rejected: 3}, st.Routes[batchRoute])
+	s.Equal(model.RouteLimitState{Allowed: 1, Rejected: 1}, st.Routes[countRoute])
+	s.Equal(4, st.Buckets)
+
+	clock = clock.Add(time.Minute)
+	_, err := l.Allow(countRoute, model.LimitKey{User: "f593ede0-2301-4480-a452-752f03dcfab0"})
+	s.NoError(err)
+	s.Equal(1, l.State().Buckets)
+}
+
+func (s *limiterSuite) TestAllowIP() {
+	clock := time.Date(2022, 10, 2, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(Config{
+		Default: Limit{App: Rate{PerSecond: 1, Burst: 5}, IP: Rate{PerSecond: 1, Burst: 2}},
+	})
+	l.now = func() time.Time { return clock }
+
+	tt := []struct {
+		name     string
+		ip       string
+		wantWait time.Duration
+	}{
+		{name: "burst 1", ip: "192.0.2.10"},
+		{name: "burst 2", ip: "192.0.2.10"},
+		{name: "IP bucket empty", ip: "192.0.2.10", wantWait: time.Second},
+		{name: "other IP", ip: "198.51.100.7"},
+		{name: "empty IP is not limited", ip: ""},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			wait, err := l.AllowIP(batchRoute, v.ip)
+			if v.wantWait == 0 {
+				s.NoError(err)
+				return
+			}
+			s.True(errors.Is(err, ErrLimited))
+			s.InDelta(v.wantWait, wait, float64(time.Millisecond))
+		})
+	}
+	s.Equal(model.RouteLimitState{Rejected: 1}, l.State().Routes[batchRoute])
+
+	_, err := l.Allow(batchRoute, model.LimitKey{AppID: "crm"})
+	s.NoError(err)
+	s.Equal(model.RouteLimitState{Allowed: 1, Rejected: 1}, l.State().Routes[batchRoute])
+}
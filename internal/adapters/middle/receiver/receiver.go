@@ -1,8 +1,20 @@
 package receiver
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/middle/application"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/middle/limiter"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/logger"
 	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
 )
 
@@ -10,9 +22,939 @@ type Receiver interface {
 	HandlePut() http.HandlerFunc
 	HandleGet() http.HandlerFunc
 	HandleCount() http.HandlerFunc
-	Log(model.UUIDWrapper, string)
+	HandleMarkRead() http.HandlerFunc
+	HandleDelete() http.HandlerFunc
+	HandleBroadcast() http.HandlerFunc
+	HandleBroadcastProgress() http.HandlerFunc
+	HandleLogin() http.HandlerFunc
+	HandleLogout() http.HandlerFunc
+	HandleAppCreate() http.HandlerFunc
+	HandleAppSecret() http.HandlerFunc
+	HandleAppSecretRevoke() http.HandlerFunc
+	HandleAppRevoke() http.HandlerFunc
+	HandleLimits() http.HandlerFunc
+	HandleLogLevel() http.HandlerFunc
+	HandleRedactions() http.HandlerFunc
+	AccessLog(http.Handler) http.Handler
+	Logger() logger.Logger
 	Start()
 	Stop()
 }
 
 // Receiver implementation
+
+const (
+	codeUnauthorized    = 50002100
+	codeWrongRequest    = 50002300
+	codeTooManyRequests = 50002900
+
+	msgUnauthorized    = "Unauthorized"
+	msgWrongRequest    = "Wrong request"
+	msgTooManyRequests = "Too many requests"
+
+	maxBodySize = 10 << 20
+
+	// DefaultSlowThreshold is latency access log marks requests slow after
+	DefaultSlowThreshold = time.Second
+)
+
+type errorItem struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+type errorResponse struct {
+	Success bool        `json:"success"`
+	Error   []errorItem `json:"error"`
+}
+
+type putResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data"`
+	Error   []errorItem `json:"error,omitempty"`
+}
+
+type meta struct {
+	PerPage     int `json:"per_page"`
+	CurrentPage int `json:"current_page"`
+	From        int `json:"from"`
+	To          int `json:"to"`
+	LastPage    int `json:"last_page"`
+	Total       int `json:"total"`
+}
+
+type listResponse struct {
+	Success bool                     `json:"success"`
+	Meta    meta                     `json:"meta"`
+	Data    []map[string]interface{} `json:"data"`
+}
+
+type countResponse struct {
+	Success bool           `json:"success"`
+	Data    map[string]int `json:"data"`
+}
+
+type dataResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data"`
+}
+
+type receiver struct {
+	app      application.Application
+	limiter  limiter.Limiter
+	handlers *sync.WaitGroup
+	stopped  *sync.WaitGroup
+	slow     time.Duration
+	now      func() time.Time
+}
+
+// NewReceiver returns Receiver running methods of a, requests are limited by l unless it is nil.
+// handlers counts requests being handled, stopped is done when Receiver is stopped.
+func NewReceiver(a application.Application, l limiter.Limiter, handlers, stopped *sync.WaitGroup) *receiver {
+	return &receiver{
+		app:      a,
+		limiter:  l,
+		handlers: handlers,
+		stopped:  stopped,
+		slow:     DefaultSlowThreshold,
+		now:      time.Now,
+	}
+}
+
+// SetSlowThreshold sets latency access log marks requests slow after, DefaultSlowThreshold if d is not positive
+func (r *receiver) SetSlowThreshold(d time.Duration) {
+	if d <= 0 {
+		d = DefaultSlowThreshold
+	}
+	r.slow = d
+}
+
+// HandlePut saves batch of notifications sent by authorized app.
+// If app scope does not allow some items, nothing is saved and denied items are returned.
+func (r *receiver) HandlePut() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.handlers.Add(1)
+		defer r.handlers.Done()
+
+		if req.Method != http.MethodPut {
+			r.write(w, http.StatusMethodNotAllowed, putResponse{Error: wrongRequest()})
+			return
+		}
+		wr, err := r.wrap(req)
+		if err != nil {
+			r.logError("HandlePut", wr, err)
+			r.write(w, http.StatusBadRequest, putResponse{Error: wrongRequest()})
+			return
+		}
+		wr.Op = model.OperationWrite
+		wr, err = r.authApp(wr)
+		if err != nil {
+			r.appAuthFailed(w, "HandlePut", wr, err, putResponse{Error: unauthorized()})
+			return
+		}
+		if r.limited(w, "HandlePut", wr) {
+			return
+		}
+		err = r.app.Save(wr)
+		if err != nil {
+			r.logError("HandlePut", wr, err)
+			r.write(w, http.StatusBadRequest, putResponse{Error: wrongRequest()})
+			return
+		}
+		r.write(w, http.StatusOK, putResponse{Success: true})
+	}
+}
+
+// HandleGet returns page of user's notifications with paging meta, user is authorized by token and role policy
+func (r *receiver) HandleGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.handlers.Add(1)
+		defer r.handlers.Done()
+
+		if req.Method != http.MethodGet {
+			r.write(w, http.StatusMethodNotAllowed, errorResponse{Error: wrongRequest()})
+			return
+		}
+		wr, err := r.wrap(req)
+		if err == nil {
+			err = checkUser(req)
+		}
+		if err != nil {
+			r.logError("HandleGet", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		wr.Op = model.OperationRead
+		wr.Principal, err = r.app.AuthUser(wr)
+		if err != nil {
+			r.logError("HandleGet", wr, err)
+			r.write(w, http.StatusUnauthorized, errorResponse{Error: unauthorized()})
+			return
+		}
+		err = r.app.AuthAccess(wr)
+		if err != nil {
+			r.logError("HandleGet", wr, err)
+			r.write(w, http.StatusForbidden, errorResponse{Error: unauthorized()})
+			return
+		}
+		if r.limited(w, "HandleGet", wr) {
+			return
+		}
+		page, perPage, err := model.Paging(req.URL.Query())
+		if err != nil {
+			r.logError("HandleGet", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		data, err := r.app.Extract(wr)
+		if err != nil && !errors.Is(err, model.ErrNoRows) {
+			r.logError("HandleGet", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		total, err := r.app.Count(wr)
+		if err != nil && !errors.Is(err, model.ErrNoRows) {
+			r.logError("HandleGet", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+
+		items := make([]map[string]interface{}, 0, len(data))
+		for i, v := range data {
+			item := make(map[string]interface{})
+			err = json.Unmarshal(v, &item)
+			if err != nil {
+				r.logError("HandleGet", wr, err)
+				continue
+			}
+			item["id"] = (page-1)*perPage + i
+			items = append(items, item)
+		}
+		lastPage := (total + perPage - 1) / perPage
+		if lastPage < 1 {
+			lastPage = 1
+		}
+		r.write(w, http.StatusOK, listResponse{
+			Success: true,
+			Meta: meta{
+				PerPage:     perPage,
+				CurrentPage: page,
+				From:        (page-1)*perPage + 1,
+				To:          page * perPage,
+				LastPage:    lastPage,
+				Total:       total,
+			},
+			Data: items,
+		})
+	}
+}
+
+// HandleCount returns number of user's notifications, user is authorized by token and role policy
+func (r *receiver) HandleCount() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.handlers.Add(1)
+		defer r.handlers.Done()
+
+		if req.Method != http.MethodGet {
+			r.write(w, http.StatusMethodNotAllowed, errorResponse{Error: wrongRequest()})
+			return
+		}
+		wr, err := r.wrap(req)
+		if err == nil {
+			err = checkUser(req)
+		}
+		if err != nil {
+			r.logError("HandleCount", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		wr.Op = model.OperationRead
+		wr.Principal, err = r.app.AuthUser(wr)
+		if err != nil {
+			r.logError("HandleCount", wr, err)
+			r.write(w, http.StatusUnauthorized, errorResponse{Error: unauthorized()})
+			return
+		}
+		err = r.app.AuthAccess(wr)
+		if err != nil {
+			r.logError("HandleCount", wr, err)
+			r.write(w, http.StatusForbidden, errorResponse{Error: unauthorized()})
+			return
+		}
+		if r.limited(w, "HandleCount", wr) {
+			return
+		}
+		n, err := r.app.Count(wr)
+		if err != nil && !errors.Is(err, model.ErrNoRows) {
+			r.logError("HandleCount", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		if n < 0 {
+			n = 0
+		}
+		r.write(w, http.StatusOK, countResponse{Success: true, Data: map[string]int{"count": n}})
+	}
+}
+
+// HandleMarkRead marks user's notifications given in body {"uuids":[...]} as read
+func (r *receiver) HandleMarkRead() http.HandlerFunc {
+	return r.handleChange("HandleMarkRead", model.OperationMarkRead, r.app.MarkRead)
+}
+
+// HandleDelete deletes user's notifications given in body {"uuids":[...]}
+func (r *receiver) HandleDelete() http.HandlerFunc {
+	return r.handleChange("HandleDelete", model.OperationDelete, r.app.Delete)
+}
+
+// handleChange runs state-changing method of user's notifications, response has number of changed ones
+func (r *receiver) handleChange(handler string, op model.Operation, do func(model.WrappedReq) (int, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.handlers.Add(1)
+		defer r.handlers.Done()
+
+		if req.Method != http.MethodPost {
+			r.write(w, http.StatusMethodNotAllowed, errorResponse{Error: wrongRequest()})
+			return
+		}
+		wr, err := r.wrap(req)
+		if err == nil {
+			err = checkUser(req)
+		}
+		if err != nil {
+			r.logError(handler, wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		wr.Op = op
+		wr.Principal, err = r.app.AuthUser(wr)
+		if err != nil {
+			r.logError(handler, wr, err)
+			r.write(w, http.StatusUnauthorized, errorResponse{Error: unauthorized()})
+			return
+		}
+		err = r.app.AuthAccess(wr)
+		if err != nil {
+			r.logError(handler, wr, err)
+			r.write(w, http.StatusForbidden, errorResponse{Error: unauthorized()})
+			return
+		}
+		if r.limited(w, handler, wr) {
+			return
+		}
+		n, err := do(wr)
+		if err != nil {
+			r.logError(handler, wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		r.write(w, http.StatusOK, countResponse{Success: true, Data: map[string]int{"count": n}})
+	}
+}
+
+// HandleLogin exchanges user's token for session. Session ID is set in HttpOnly cookie,
+// CSRF token is set in cookie readable by client script and returned in response.
+func (r *receiver) HandleLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.handlers.Add(1)
+		defer r.handlers.Done()
+
+		if req.Method != http.MethodPost {
+			r.write(w, http.StatusMethodNotAllowed, errorResponse{Error: wrongRequest()})
+			return
+		}
+		wr, err := r.wrap(req)
+		if err != nil {
+			r.logError("HandleLogin", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		wr.Principal, err = r.app.AuthUser(wr)
+		if err != nil {
+			r.logError("HandleLogin", wr, err)
+			r.write(w, http.StatusUnauthorized, errorResponse{Error: unauthorized()})
+			return
+		}
+		if r.limited(w, "HandleLogin", wr) {
+			return
+		}
+		sess, err := r.app.Login(wr)
+		if err != nil {
+			r.logError("HandleLogin", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		http.SetCookie(w, sessionCookie(model.SessionCookie, sess.ID, true, sess.ExpiresAt))
+		http.SetCookie(w, sessionCookie(model.CSRFCookie, sess.CSRF, false, sess.ExpiresAt))
+		r.write(w, http.StatusOK, dataResponse{Success: true, Data: sess})
+	}
+}
+
+// HandleLogout deletes session and its cookies
+func (r *receiver) HandleLogout() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.handlers.Add(1)
+		defer r.handlers.Done()
+
+		if req.Method != http.MethodPost {
+			r.write(w, http.StatusMethodNotAllowed, errorResponse{Error: wrongRequest()})
+			return
+		}
+		wr, err := r.wrap(req)
+		if err != nil {
+			r.logError("HandleLogout", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		wr.Principal, err = r.app.AuthUser(wr)
+		if err != nil {
+			r.logError("HandleLogout", wr, err)
+			r.write(w, http.StatusUnauthorized, errorResponse{Error: unauthorized()})
+			return
+		}
+		err = r.app.Logout(wr)
+		if err != nil {
+			r.logError("HandleLogout", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		http.SetCookie(w, sessionCookie(model.SessionCookie, "", true, time.Unix(0, 0)))
+		http.SetCookie(w, sessionCookie(model.CSRFCookie, "", false, time.Unix(0, 0)))
+		r.write(w, http.StatusOK, dataResponse{Success: true})
+	}
+}
+
+// HandleBroadcast queues notification to list of users or to segment, sent by authorized app.
+// Response has uuid of broadcast to ask its progress with.
+func (r *receiver) HandleBroadcast() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.handlers.Add(1)
+		defer r.handlers.Done()
+
+		if req.Method != http.MethodPost {
+			r.write(w, http.StatusMethodNotAllowed, errorResponse{Error: wrongRequest()})
+			return
+		}
+		wr, err := r.wrap(req)
+		if err != nil {
+			r.logError("HandleBroadcast", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		wr.Op = model.OperationBroadcast
+		wr, err = r.authApp(wr)
+		if err != nil {
+			r.appAuthFailed(w, "HandleBroadcast", wr, err, errorResponse{Error: unauthorized()})
+			return
+		}
+		if r.limited(w, "HandleBroadcast", wr) {
+			return
+		}
+		id, err := r.app.Broadcast(wr)
+		if err != nil {
+			r.logError("HandleBroadcast", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		r.write(w, http.StatusAccepted, dataResponse{Success: true, Data: map[string]uuid.UUID{"uuid": id}})
+	}
+}
+
+// HandleBroadcastProgress returns progress of broadcast given by uuid parameter to app that sent it
+func (r *receiver) HandleBroadcastProgress() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.handlers.Add(1)
+		defer r.handlers.Done()
+
+		if req.Method != http.MethodGet {
+			r.write(w, http.StatusMethodNotAllowed, errorResponse{Error: wrongRequest()})
+			return
+		}
+		wr, err := r.wrap(req)
+		if err != nil {
+			r.logError("HandleBroadcastProgress", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		wr.Op = model.OperationBroadcast
+		wr, err = r.authApp(wr)
+		if err != nil {
+			r.appAuthFailed(w, "HandleBroadcastProgress", wr, err, errorResponse{Error: unauthorized()})
+			return
+		}
+		if r.limited(w, "HandleBroadcastProgress", wr) {
+			return
+		}
+		p, err := r.app.BroadcastProgress(wr)
+		if errors.Is(err, model.ErrForbidden) {
+			r.logError("HandleBroadcastProgress", wr, err)
+			r.write(w, http.StatusForbidden, errorResponse{Error: unauthorized()})
+			return
+		}
+		if err != nil {
+			r.logError("HandleBroadcastProgress", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		r.write(w, http.StatusOK, dataResponse{Success: true, Data: p})
+	}
+}
+
+// HandleAppCreate creates app, only admin may do it
+func (r *receiver) HandleAppCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.handlers.Add(1)
+		defer r.handlers.Done()
+
+		wr, ok := r.authAdmin(w, req, http.MethodPost, "HandleAppCreate")
+		if !ok {
+			return
+		}
+		app, err := r.app.CreateApp(wr)
+		if err != nil {
+			r.logError("HandleAppCreate", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		r.write(w, http.StatusCreated, dataResponse{Success: true, Data: app})
+	}
+}
+
+// HandleApp returns app with its active secrets and time they were last used at, secret values are not shown
+func (r *receiver) HandleApp() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.handlers.Add(1)
+		defer r.handlers.Done()
+
+		wr, ok := r.authAdmin(w, req, http.MethodGet, "HandleApp")
+		if !ok {
+			return
+		}
+		app, err := r.app.App(wr)
+		if err != nil {
+			r.logError("HandleApp", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		r.write(w, http.StatusOK, dataResponse{Success: true, Data: app})
+	}
+}
+
+// HandleAppSecret issues new secret of app. Secret is shown in response only.
+func (r *receiver) HandleAppSecret() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.handlers.Add(1)
+		defer r.handlers.Done()
+
+		wr, ok := r.authAdmin(w, req, http.MethodPost, "HandleAppSecret")
+		if !ok {
+			return
+		}
+		sec, err := r.app.IssueSecret(wr)
+		if err != nil {
+			r.logError("HandleAppSecret", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		r.write(w, http.StatusCreated, dataResponse{Success: true, Data: sec})
+	}
+}
+
+// HandleAppSecretRevoke revokes one secret of app
+func (r *receiver) HandleAppSecretRevoke() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.handlers.Add(1)
+		defer r.handlers.Done()
+
+		wr, ok := r.authAdmin(w, req, http.MethodPost, "HandleAppSecretRevoke")
+		if !ok {
+			return
+		}
+		err := r.app.RevokeSecret(wr)
+		if err != nil {
+			r.logError("HandleAppSecretRevoke", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		r.write(w, http.StatusOK, dataResponse{Success: true})
+	}
+}
+
+// HandleAppRevoke revokes app with all its secrets
+func (r *receiver) HandleAppRevoke() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.handlers.Add(1)
+		defer r.handlers.Done()
+
+		wr, ok := r.authAdmin(w, req, http.MethodPost, "HandleAppRevoke")
+		if !ok {
+			return
+		}
+		err := r.app.RevokeApp(wr)
+		if err != nil {
+			r.logError("HandleAppRevoke", wr, err)
+			r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+			return
+		}
+		r.write(w, http.StatusOK, dataResponse{Success: true})
+	}
+}
+
+// HandleLimits returns state of Limiter for metrics, only admin may get it
+func (r *receiver) HandleLimits() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.handlers.Add(1)
+		defer r.handlers.Done()
+
+		_, ok := r.authAdmin(w, req, http.MethodGet, "HandleLimits")
+		if !ok {
+			return
+		}
+		st := model.LimiterState{Routes: map[string]model.RouteLimitState{}}
+		if r.limiter != nil {
+			st = r.limiter.State()
+		}
+		r.write(w, http.StatusOK, dataResponse{Success: true, Data: st})
+	}
+}
+
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+// HandleLogLevel returns minimal log level on GET and changes it on POST with body {"level":"DEBUG"}, only admin may do it
+func (r *receiver) HandleLogLevel() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.handlers.Add(1)
+		defer r.handlers.Done()
+
+		if req.Method != http.MethodGet && req.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, POST")
+			r.write(w, http.StatusMethodNotAllowed, errorResponse{Error: wrongRequest()})
+			return
+		}
+		wr, ok := r.authAdmin(w, req, req.Method, "HandleLogLevel")
+		if !ok {
+			return
+		}
+		log := r.app.Logger()
+		if req.Method == http.MethodPost {
+			ll := logLevel{}
+			err := json.Unmarshal(wr.Body, &ll)
+			if err != nil {
+				r.logError("HandleLogLevel", wr, fmt.Errorf("invalid body: %w", err))
+				r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+				return
+			}
+			l, err := model.ParseLevelName(ll.Level)
+			if err != nil {
+				r.logError("HandleLogLevel", wr, err)
+				r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+				return
+			}
+			r.app.SetLogLevel(wr, l)
+		}
+		r.write(w, http.StatusOK, dataResponse{Success: true, Data: logLevel{Level: log.Level().Name()}})
+	}
+}
+
+// HandleRedactions returns number of log records every redaction rule fired on by stream, only admin may get it
+func (r *receiver) HandleRedactions() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.handlers.Add(1)
+		defer r.handlers.Done()
+
+		_, ok := r.authAdmin(w, req, http.MethodGet, "HandleRedactions")
+		if !ok {
+			return
+		}
+		r.write(w, http.StatusOK, dataResponse{Success: true, Data: r.app.Redactions()})
+	}
+}
+
+// statusWriter remembers status and size of response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach underlying writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// AccessLog writes access log record of every request handled by h to stream "access".
+// Request gets its uuid here, handlers and their log records use the same uuid.
+// Requests handled longer than slow threshold are written with WARN level and marked slow.
+func (r *receiver) AccessLog(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := r.now()
+		id := uuid.New()
+		sw := &statusWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, req.WithContext(model.WithRequestUUID(req.Context(), id)))
+
+		e := model.AccessEntry{
+			UUID:      id,
+			Method:    req.Method,
+			Path:      req.URL.Path,
+			Status:    sw.status,
+			Bytes:     sw.bytes,
+			Latency:   r.now().Sub(start),
+			UserAgent: req.UserAgent(),
+			IP:        r.app.ClientIP(model.WrappedReq{UUID: id, Req: req}),
+		}
+		if e.Status == 0 {
+			e.Status = http.StatusOK
+		}
+		e.Slow = e.Latency > r.slow
+		log := r.app.Logger().WithUUID(id)
+		if e.Slow {
+			log.Warn("slow request", e.Fields()...)
+			return
+		}
+		log.Info("request", e.Fields()...)
+	})
+}
+
+func (r *receiver) Logger() logger.Logger {
+	return r.app.Logger()
+}
+
+func (r *receiver) Start() {
+	r.stopped.Add(1)
+	r.app.Logger().Signal("receiver started")
+}
+
+// Stop waits for requests being handled
+func (r *receiver) Stop() {
+	r.handlers.Wait()
+	r.app.Logger().Signal("receiver stopped")
+	r.stopped.Done()
+}
+
+// Routes returns mux with all Receiver routes
+func (r *receiver) Routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/notifications/batch", r.limitIP(r.HandlePut()))
+	mux.HandleFunc("/api/v1/notifications", r.limitIP(r.HandleGet()))
+	mux.HandleFunc("/api/v1/notifications/count", r.limitIP(r.HandleCount()))
+	mux.HandleFunc("/api/v1/notifications/read", r.limitIP(r.HandleMarkRead()))
+	mux.HandleFunc("/api/v1/notifications/delete", r.limitIP(r.HandleDelete()))
+	mux.HandleFunc("/api/v1/session", r.limitIP(r.HandleLogin()))
+	mux.HandleFunc("/api/v1/session/logout", r.limitIP(r.HandleLogout()))
+	mux.HandleFunc("/api/v1/notifications/broadcast", r.limitIP(r.HandleBroadcast()))
+	mux.HandleFunc("/api/v1/notifications/broadcast/progress", r.limitIP(r.HandleBroadcastProgress()))
+	mux.HandleFunc("/api/v1/admin/apps", r.limitIP(r.HandleAppCreate()))
+	mux.HandleFunc("/api/v1/admin/apps/info", r.limitIP(r.HandleApp()))
+	mux.HandleFunc("/api/v1/admin/apps/secret", r.limitIP(r.HandleAppSecret()))
+	mux.HandleFunc("/api/v1/admin/apps/secret/revoke", r.limitIP(r.HandleAppSecretRevoke()))
+	mux.HandleFunc("/api/v1/admin/apps/revoke", r.limitIP(r.HandleAppRevoke()))
+	mux.HandleFunc("/api/v1/admin/limits", r.limitIP(r.HandleLimits()))
+	mux.HandleFunc("/api/v1/admin/loglevel", r.limitIP(r.HandleLogLevel()))
+	mux.HandleFunc("/api/v1/admin/redactions", r.limitIP(r.HandleRedactions()))
+	return mux
+}
+
+// wrap assigns uuid to request and reads its body. Uuid given by AccessLog is kept.
+func (r *receiver) wrap(req *http.Request) (model.WrappedReq, error) {
+	id, ok := model.RequestUUID(req.Context())
+	if !ok {
+		id = uuid.New()
+	}
+	wr := model.WrappedReq{
+		UUID: id,
+		Req:  req,
+	}
+	if req.Body == nil {
+		return wr, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxBodySize))
+	if err != nil {
+		return wr, fmt.Errorf("unable to read body: %w", err)
+	}
+	wr.Body = body
+	return wr, nil
+}
+
+// authAdmin checks that request of method is made by admin, otherwise writes error response
+func (r *receiver) authAdmin(w http.ResponseWriter, req *http.Request, method, handler string) (model.WrappedReq, bool) {
+	if req.Method != method {
+		r.write(w, http.StatusMethodNotAllowed, errorResponse{Error: wrongRequest()})
+		return model.WrappedReq{}, false
+	}
+	wr, err := r.wrap(req)
+	if err != nil {
+		r.logError(handler, wr, err)
+		r.write(w, http.StatusBadRequest, errorResponse{Error: wrongRequest()})
+		return wr, false
+	}
+	wr.Op = model.OperationAdmin
+	wr.Principal, err = r.app.AuthUser(wr)
+	if err != nil {
+		r.logError(handler, wr, err)
+		r.write(w, http.StatusUnauthorized, errorResponse{Error: unauthorized()})
+		return wr, false
+	}
+	err = r.app.AuthAccess(wr)
+	if err != nil {
+		r.logError(handler, wr, err)
+		r.write(w, http.StatusForbidden, errorResponse{Error: unauthorized()})
+		return wr, false
+	}
+	if r.limited(w, handler, wr) {
+		return wr, false
+	}
+	return wr, true
+}
+
+// authApp authorizes app by client certificate if request has one, otherwise by signature.
+// Returned request holds app identity.
+func (r *receiver) authApp(wr model.WrappedReq) (model.WrappedReq, error) {
+	var (
+		id  model.AppIdentity
+		err error
+	)
+	if wr.Req.TLS != nil && len(wr.Req.TLS.PeerCertificates) > 0 {
+		id, err = r.app.AuthInternal(wr)
+	} else {
+		id, err = r.app.AuthExternal(wr)
+	}
+	if err != nil {
+		return wr, err
+	}
+	wr.Identity = id
+	return wr, nil
+}
+
+// appAuthFailed writes 403 response with fail if app is not allowed to perform request, listing denied items if any.
+// Otherwise app is not authenticated and 401 is written.
+func (r *receiver) appAuthFailed(w http.ResponseWriter, handler string, wr model.WrappedReq, err error, fail interface{}) {
+	r.logError(handler, wr, err)
+	denied := model.ItemAuthErrors{}
+	if errors.As(err, &denied) {
+		r.write(w, http.StatusForbidden, putResponse{Data: denied, Error: unauthorized()})
+		return
+	}
+	if errors.Is(err, model.ErrForbidden) {
+		r.write(w, http.StatusForbidden, fail)
+		return
+	}
+	r.write(w, http.StatusUnauthorized, fail)
+}
+
+// limitIP rejects request exceeding rate limit of client IP on its route before h authenticates it,
+// so unauthenticated flood does not reach token and signature checks
+func (r *receiver) limitIP(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if r.limiter == nil {
+			h(w, req)
+			return
+		}
+		id, ok := model.RequestUUID(req.Context())
+		if !ok {
+			id = uuid.New()
+		}
+		wr := model.WrappedReq{UUID: id, Req: req}
+		wait, err := r.limiter.AllowIP(req.URL.Path, r.app.ClientIP(wr))
+		if err != nil {
+			r.tooManyRequests(w, "limitIP", wr, wait, err)
+			return
+		}
+		h(w, req)
+	}
+}
+
+// limited writes 429 response with Retry-After if authenticated request exceeds rate limit of its route.
+// Request is limited by its app and user, client IP is limited before authentication by limitIP.
+func (r *receiver) limited(w http.ResponseWriter, handler string, wr model.WrappedReq) bool {
+	if r.limiter == nil {
+		return false
+	}
+	key := model.LimitKey{AppID: wr.Identity.AppID, User: wr.Principal.Subject}
+	wait, err := r.limiter.Allow(wr.Req.URL.Path, key)
+	if err == nil {
+		return false
+	}
+	r.tooManyRequests(w, handler, wr, wait, err)
+	return true
+}
+
+func (r *receiver) tooManyRequests(w http.ResponseWriter, handler string, wr model.WrappedReq, wait time.Duration, err error) {
+	r.logError(handler, wr, err)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds())))))
+	r.write(w, http.StatusTooManyRequests, errorResponse{Error: tooManyRequests()})
+}
+
+func (r *receiver) write(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		r.app.Logger().Error("in receiver.write unable to marshal response", logger.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func (r *receiver) logError(handler string, wr model.WrappedReq, err error) {
+	r.app.Logger().WithUUID(wr.UUID).Error("in receiver."+handler, logger.Err(err))
+}
+
+// sessionCookie is Secure SameSite=Strict cookie of /api path, expired at zero unix time
+func sessionCookie(name, value string, httpOnly bool, expires time.Time) *http.Cookie {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/api",
+		Expires:  expires,
+		HttpOnly: httpOnly,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	}
+	if expires.Unix() <= 0 {
+		c.MaxAge = -1
+	}
+	return c
+}
+
+func checkUser(req *http.Request) error {
+	s := req.URL.Query().Get("user_uuid")
+	if s == "" {
+		return errors.New("request has empty user_uuid parameter")
+	}
+	_, err := uuid.Parse(s)
+	if err != nil {
+		return fmt.Errorf("request has invalid user_uuid parameter %q", s)
+	}
+	return nil
+}
+
+func unauthorized() []errorItem {
+	return []errorItem{{Code: codeUnauthorized, Msg: msgUnauthorized}}
+}
+
+func wrongRequest() []errorItem {
+	return []errorItem{{Code: codeWrongRequest, Msg: msgWrongRequest}}
+}
+
+func tooManyRequests() []errorItem {
+	return []errorItem{{Code: codeTooManyRequests, Msg: msgTooManyRequests}}
+}
@@ -3,15 +3,27 @@ package receiver
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/netip"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/middle/application"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/middle/limiter"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/sessions"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/store"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/logger"
 	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
 )
 
@@ -27,6 +39,8 @@ var nilError error
 
 type mockApp struct {
 	mock.Mock
+	// log is returned by Logger, mockLogger if nil
+	log logger.Logger
 }
 
 func (m *mockApp) Save(model.WrappedReq) error {
@@ -41,21 +55,110 @@ func (m *mockApp) Count(model.WrappedReq) (int, error) {
 	args := m.Called()
 	return args.Int(0), args.Error(1)
 }
-func (m *mockApp) AuthInternal(model.WrappedReq) error {
+func (m *mockApp) MarkRead(model.WrappedReq) (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+func (m *mockApp) Delete(model.WrappedReq) (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+func (m *mockApp) Broadcast(model.WrappedReq) (uuid.UUID, error) {
+	args := m.Called()
+	return args.Get(0).(uuid.UUID), args.Error(1)
+}
+func (m *mockApp) BroadcastProgress(model.WrappedReq) (model.BroadcastProgress, error) {
+	args := m.Called()
+	return args.Get(0).(model.BroadcastProgress), args.Error(1)
+}
+func (m *mockApp) Login(model.WrappedReq) (model.Session, error) {
+	args := m.Called()
+	return args.Get(0).(model.Session), args.Error(1)
+}
+func (m *mockApp) Logout(model.WrappedReq) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockApp) CreateApp(model.WrappedReq) (model.App, error) {
+	args := m.Called()
+	return args.Get(0).(model.App), args.Error(1)
+}
+func (m *mockApp) App(model.WrappedReq) (model.App, error) {
+	args := m.Called()
+	return args.Get(0).(model.App), args.Error(1)
+}
+func (m *mockApp) IssueSecret(model.WrappedReq) (model.AppSecret, error) {
+	args := m.Called()
+	return args.Get(0).(model.AppSecret), args.Error(1)
+}
+func (m *mockApp) RevokeSecret(model.WrappedReq) error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *mockApp) RevokeApp(model.WrappedReq) error {
 	args := m.Called()
 	return args.Error(0)
 }
-func (m *mockApp) AuthExternal(model.WrappedReq) error {
+func (m *mockApp) AuthInternal(model.WrappedReq) (model.AppIdentity, error) {
+	args := m.Called()
+	return args.Get(0).(model.AppIdentity), args.Error(1)
+}
+func (m *mockApp) AuthExternal(model.WrappedReq) (model.AppIdentity, error) {
+	args := m.Called()
+	return args.Get(0).(model.AppIdentity), args.Error(1)
+}
+func (m *mockApp) AuthUser(model.WrappedReq) (model.Principal, error) {
+	args := m.Called()
+	return args.Get(0).(model.Principal), args.Error(1)
+}
+func (m *mockApp) AuthAccess(model.WrappedReq) error {
 	args := m.Called()
 	return args.Error(0)
 }
+func (m *mockApp) ClientIP(wr model.WrappedReq) string {
+	host, _, err := net.SplitHostPort(wr.Req.RemoteAddr)
+	if err != nil {
+		return wr.Req.RemoteAddr
+	}
+	return host
+}
 func (m *mockApp) DeleteLast(model.WrappedReq) error {
 	args := m.Called()
 	return args.Error(0)
 }
-func (m *mockApp) Start()                        {}
-func (m *mockApp) Stop()                         {}
-func (m *mockApp) Log(model.UUIDWrapper, string) {}
+func (m *mockApp) Redactions() map[string]map[string]uint64 {
+	args := m.Called()
+	return args.Get(0).(map[string]map[string]uint64)
+}
+func (m *mockApp) SetLogLevel(wr model.WrappedReq, l model.Level) {
+	m.Logger().SetLevel(l)
+}
+func (m *mockApp) Start()      {}
+func (m *mockApp) Stop() error { return nil }
+func (m *mockApp) Logger() logger.Logger {
+	if m.log != nil {
+		return m.log
+	}
+	return &mockLogger{}
+}
+
+type mockLogger struct{}
+
+func (l *mockLogger) Debug(string, ...model.Field)  {}
+func (l *mockLogger) Info(string, ...model.Field)   {}
+func (l *mockLogger) Warn(string, ...model.Field)   {}
+func (l *mockLogger) Error(string, ...model.Field)  {}
+func (l *mockLogger) Signal(string, ...model.Field) {}
+func (l *mockLogger) With(...model.Field) logger.Logger {
+	return l
+}
+func (l *mockLogger) WithUUID(uuid.UUID) logger.Logger {
+	return l
+}
+func (l *mockLogger) SetLevel(model.Level) {}
+func (l *mockLogger) Level() model.Level {
+	return model.LevelInfo
+}
 
 func (s *receiverSuite) TestHandleGet() {
 	tt := []struct {
@@ -76,12 +179,12 @@ func (s *receiverSuite) TestHandleGet() {
 			number:      0,
 			method:      "GET",
 			url:         "http://localhost:8080/api/v1/notifications?page=1&per_page=10&user_uuid=2593ede0-2301-4480-a452-752f03dcfab0&filter=%7B%7D",
-			on:          []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "Start", "Stop", "Log"},
-			ret:         [][]interface{}{{nilError}, {[][]byte{}, errors.New("no rows")}, {0, nilError}, {nilError}, {nilError}, {}, {}, {}},
+			on:          []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "AuthUser", "AuthAccess", "Start", "Stop"},
+			ret:         [][]interface{}{{nilError}, {[][]byte{}, model.ErrNoRows}, {0, nilError}, {model.AppIdentity{}, nilError}, {model.AppIdentity{}, nilError}, {model.Principal{Subject: "2593ede0-2301-4480-a452-752f03dcfab0", Roles: []model.Role{model.RoleUser}}, nilError}, {nilError}, {}, {}},
 			reqError:    nil,
 			doError:     nil,
 			readError:   nil,
-			wantResBody: []byte(`{"success":true,"meta":{"per_page":10,"current_page":1,"from":1,"to":10,"last_page":1,"total":251},"data":[]}`),
+			wantResBody: []byte(`{"success":true,"meta":{"per_page":10,"current_page":1,"from":1,"to":10,"last_page":1,"total":0},"data":[]}`),
 		},
 
 		{
@@ -89,14 +192,65 @@ func (s *receiverSuite) TestHandleGet() {
 			number:      0,
 			method:      "GET",
 			url:         "http://localhost:8080/api/v1/notifications?page=1&per_page=10&user_uuid=2593ede0-2301-4480-a452-752f03dcfab0&filter=%7B%7D",
-			on:          []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "Start", "Stop", "Log"},
-			ret:         [][]interface{}{{nilError}, {[][]byte{[]byte(`{"category":"cat1","name":"alice","uuid":"azaza"}`)}, nilError}, {0, nilError}, {nilError}, {nilError}, {}, {}, {}},
+			on:          []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "AuthUser", "AuthAccess", "Start", "Stop"},
+			ret:         [][]interface{}{{nilError}, {[][]byte{[]byte(`{"category":"cat1","name":"alice","uuid":"azaza"}`)}, nilError}, {1, nilError}, {model.AppIdentity{}, nilError}, {model.AppIdentity{}, nilError}, {model.Principal{Subject: "2593ede0-2301-4480-a452-752f03dcfab0", Roles: []model.Role{model.RoleUser}}, nilError}, {nilError}, {}, {}},
 			reqError:    nil,
 			doError:     nil,
 			readError:   nil,
-			wantResBody: []byte(`{"success":true,"meta":{"per_page":10,"current_page":1,"from":1,"to":10,"last_page":1,"total":251},"data":[{"category":"cat1","id":0,"name":"alice","uuid":"azaza"}]}`),
+			wantResBody: []byte(`{"success":true,"meta":{"per_page":10,"current_page":1,"from":1,"to":10,"last_page":1,"total":1},"data":[{"category":"cat1","id":0,"name":"alice","uuid":"azaza"}]}`),
 			//,
 		},
+
+		{
+			name:        "Expanded view",
+			number:      0,
+			method:      "GET",
+			url:         "http://localhost:8080/api/v1/notifications?page=2&per_page=2&user_uuid=2593ede0-2301-4480-a452-752f03dcfab0&view=expanded",
+			on:          []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "AuthUser", "AuthAccess", "Start", "Stop"},
+			ret:         [][]interface{}{{nilError}, {[][]byte{[]byte(`{"category":"cat1","name":"alice","uuid":"azaza"}`), []byte(`{"category":"cat1","name":"alice","uuid":"bzbzb"}`)}, nilError}, {5, nilError}, {model.AppIdentity{}, nilError}, {model.AppIdentity{}, nilError}, {model.Principal{Subject: "2593ede0-2301-4480-a452-752f03dcfab0", Roles: []model.Role{model.RoleUser}}, nilError}, {nilError}, {}, {}},
+			reqError:    nil,
+			doError:     nil,
+			readError:   nil,
+			wantResBody: []byte(`{"success":true,"meta":{"per_page":2,"current_page":2,"from":3,"to":4,"last_page":3,"total":5},"data":[{"category":"cat1","id":2,"name":"alice","uuid":"azaza"},{"category":"cat1","id":3,"name":"alice","uuid":"bzbzb"}]}`),
+		},
+
+		{
+			name:        "Collapsed view",
+			number:      0,
+			method:      "GET",
+			url:         "http://localhost:8080/api/v1/notifications?page=1&per_page=10&user_uuid=2593ede0-2301-4480-a452-752f03dcfab0&view=collapsed",
+			on:          []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "AuthUser", "AuthAccess", "Start", "Stop"},
+			ret:         [][]interface{}{{nilError}, {[][]byte{[]byte(`{"category":"cat1","count":2,"members":["azaza","bzbzb"],"name":"2 new events on alice","uuid":"azaza"}`)}, nilError}, {1, nilError}, {model.AppIdentity{}, nilError}, {model.AppIdentity{}, nilError}, {model.Principal{Subject: "2593ede0-2301-4480-a452-752f03dcfab0", Roles: []model.Role{model.RoleUser}}, nilError}, {nilError}, {}, {}},
+			reqError:    nil,
+			doError:     nil,
+			readError:   nil,
+			wantResBody: []byte(`{"success":true,"meta":{"per_page":10,"current_page":1,"from":1,"to":10,"last_page":1,"total":1},"data":[{"category":"cat1","count":2,"id":0,"members":["azaza","bzbzb"],"name":"2 new events on alice","uuid":"azaza"}]}`),
+		},
+		{
+			name:        "Auth user fail",
+			number:      0,
+			method:      "GET",
+			url:         "http://localhost:8080/api/v1/notifications?page=1&per_page=10&user_uuid=2593ede0-2301-4480-a452-752f03dcfab0",
+			on:          []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "AuthUser", "AuthAccess", "Start", "Stop"},
+			ret:         [][]interface{}{{nilError}, {[][]byte{}, nilError}, {1, nilError}, {model.AppIdentity{}, nilError}, {model.AppIdentity{}, nilError}, {model.Principal{}, errors.New("in authorizer.User token is expired")}, {nilError}, {}, {}},
+			reqError:    nil,
+			doError:     nil,
+			readError:   nil,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002100,"msg":"Unauthorized"}]}`),
+		},
+
+		{
+			name:        "Subject mismatch",
+			number:      0,
+			method:      "GET",
+			url:         "http://localhost:8080/api/v1/notifications?page=1&per_page=10&user_uuid=2593ede0-2301-4480-a452-752f03dcfab0",
+			on:          []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "AuthUser", "AuthAccess", "Start", "Stop"},
+			ret:         [][]interface{}{{nilError}, {[][]byte{}, nilError}, {1, nilError}, {model.AppIdentity{}, nilError}, {model.AppIdentity{}, nilError}, {model.Principal{Subject: "0c8e0a57-8a25-4b0e-9c0a-54a1b1a2c7a1", Roles: []model.Role{model.RoleUser}}, nilError}, {errors.New("in application.AuthAccess 0c8e0a57-8a25-4b0e-9c0a-54a1b1a2c7a1 with roles [user] may not perform \"read\" on notifications of user 2593ede0-2301-4480-a452-752f03dcfab0")}, {}, {}},
+			reqError:    nil,
+			doError:     nil,
+			readError:   nil,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002100,"msg":"Unauthorized"}]}`),
+		},
 	}
 	for _, v := range tt {
 		s.Run(v.name, func() {
@@ -110,7 +264,7 @@ func (s *receiverSuite) TestHandleGet() {
 					ma.On(w).Return(v.ret[j]...)
 				}
 			}
-			rcvr := NewReceiver(ma, &sync.WaitGroup{}, &sync.WaitGroup{})
+			rcvr := NewReceiver(ma, nil, &sync.WaitGroup{}, &sync.WaitGroup{})
 
 			// setting mux
 			mux := http.NewServeMux()
@@ -175,8 +329,8 @@ func (s *receiverSuite) TestHandleCount() {
 			number:      0,
 			method:      "GET",
 			url:         "http://localhost:8080/api/v1/notifications/count?user_uuid=2593ede0-2301-4480-a452-752f03dcfab0",
-			on:          []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "Start", "Stop", "Log"},
-			ret:         [][]interface{}{{nilError}, {[][]byte{}, nilError}, {0, errors.New("no rows")}, {nilError}, {nilError}, {nilError}, {}, {}, {}},
+			on:          []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "AuthUser", "AuthAccess", "Start", "Stop"},
+			ret:         [][]interface{}{{nilError}, {[][]byte{}, nilError}, {0, model.ErrNoRows}, {model.AppIdentity{}, nilError}, {model.AppIdentity{}, nilError}, {model.Principal{Subject: "2593ede0-2301-4480-a452-752f03dcfab0", Roles: []model.Role{model.RoleUser}}, nilError}, {nilError}, {nilError}, {}, {}},
 			reqError:    nil,
 			doError:     nil,
 			readError:   nil,
@@ -188,8 +342,8 @@ func (s *receiverSuite) TestHandleCount() {
 			number:      1,
 			method:      "GET",
 			url:         "http://localhost:8080/api/v1/notifications/count",
-			on:          []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "Start", "Stop", "Log"},
-			ret:         [][]interface{}{{nilError}, {[][]byte{}, nilError}, {-1, errors.New("in application.Count request has empty user_uuid parameter")}, {nilError}, {nilError}, {nilError}, {}, {}, {}},
+			on:          []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "AuthUser", "AuthAccess", "Start", "Stop"},
+			ret:         [][]interface{}{{nilError}, {[][]byte{}, nilError}, {-1, errors.New("in application.Count request has empty user_uuid parameter")}, {model.AppIdentity{}, nilError}, {model.AppIdentity{}, nilError}, {model.Principal{Subject: "2593ede0-2301-4480-a452-752f03dcfab0", Roles: []model.Role{model.RoleUser}}, nilError}, {nilError}, {nilError}, {}, {}},
 			reqError:    nil,
 			doError:     nil,
 			readError:   nil,
@@ -201,13 +355,38 @@ func (s *receiverSuite) TestHandleCount() {
 			number:      2,
 			method:      "GET",
 			url:         "http://localhost:8080/api/v1/notifications/count?user_uuid=2593ede0-2301-4480-a452-752f03dcfab0",
-			on:          []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "Start", "Stop", "Log"},
-			ret:         [][]interface{}{{nilError}, {[][]byte{}, nilError}, {10, nilError}, {nilError}, {nilError}, {nilError}, {}, {}, {}},
+			on:          []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "AuthUser", "AuthAccess", "Start", "Stop"},
+			ret:         [][]interface{}{{nilError}, {[][]byte{}, nilError}, {10, nilError}, {model.AppIdentity{}, nilError}, {model.AppIdentity{}, nilError}, {model.Principal{Subject: "2593ede0-2301-4480-a452-752f03dcfab0", Roles: []model.Role{model.RoleUser}}, nilError}, {nilError}, {nilError}, {}, {}},
 			reqError:    nil,
 			doError:     nil,
 			readError:   nil,
 			wantResBody: []byte(`{"success":true,"data":{"count":10}}`),
 		},
+		{
+			name:        "Auth user fail",
+			number:      0,
+			method:      "GET",
+			url:         "http://localhost:8080/api/v1/notifications/count?user_uuid=2593ede0-2301-4480-a452-752f03dcfab0",
+			on:          []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "AuthUser", "AuthAccess", "Start", "Stop"},
+			ret:         [][]interface{}{{nilError}, {[][]byte{}, nilError}, {1, nilError}, {model.AppIdentity{}, nilError}, {model.AppIdentity{}, nilError}, {model.Principal{}, errors.New("in authorizer.User token is expired")}, {nilError}, {}, {}},
+			reqError:    nil,
+			doError:     nil,
+			readError:   nil,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002100,"msg":"Unauthorized"}]}`),
+		},
+
+		{
+			name:        "Subject mismatch",
+			number:      0,
+			method:      "GET",
+			url:         "http://localhost:8080/api/v1/notifications/count?user_uuid=2593ede0-2301-4480-a452-752f03dcfab0",
+			on:          []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "AuthUser", "AuthAccess", "Start", "Stop"},
+			ret:         [][]interface{}{{nilError}, {[][]byte{}, nilError}, {1, nilError}, {model.AppIdentity{}, nilError}, {model.AppIdentity{}, nilError}, {model.Principal{Subject: "0c8e0a57-8a25-4b0e-9c0a-54a1b1a2c7a1", Roles: []model.Role{model.RoleUser}}, nilError}, {errors.New("in application.AuthAccess 0c8e0a57-8a25-4b0e-9c0a-54a1b1a2c7a1 with roles [user] may not perform \"read\" on notifications of user 2593ede0-2301-4480-a452-752f03dcfab0")}, {}, {}},
+			reqError:    nil,
+			doError:     nil,
+			readError:   nil,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002100,"msg":"Unauthorized"}]}`),
+		},
 	}
 	for _, v := range tt {
 		s.Run(v.name, func() {
@@ -221,7 +400,7 @@ func (s *receiverSuite) TestHandleCount() {
 					ma.On(w).Return(v.ret[j]...)
 				}
 			}
-			rcvr := NewReceiver(ma, &sync.WaitGroup{}, &sync.WaitGroup{})
+			rcvr := NewReceiver(ma, nil, &sync.WaitGroup{}, &sync.WaitGroup{})
 
 			// setting mux
 			mux := http.NewServeMux()
@@ -294,8 +473,8 @@ func (s *receiverSuite) TestHandlePut() {
 			number:       0,
 			method:       "PUT",
 			url:          "http://localhost:8080/api/v1/notifications/batch",
-			on:           []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "Start", "Stop", "Log"},
-			ret:          [][]interface{}{{nilError}, {[][]byte{}}, {0, errors.New("no rows")}, {nilError}, {errors.New("failed")}, {nilError}, {}, {}, {}},
+			on:           []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "Start", "Stop"},
+			ret:          [][]interface{}{{nilError}, {[][]byte{}}, {0, model.ErrNoRows}, {model.AppIdentity{}, nilError}, {model.AppIdentity{}, errors.New("failed")}, {nilError}, {}, {}},
 			body:         []byte(`[{"user_uuid":"2593ede0-2301-4480-a452-752f03dcfab0","category":"new_rank","uuid":"75359b90-a0de-4e50-bbcf-ba400d17033f","task_uuid":null,"object_uuid":"fd7f3b4e-008d-4629-af8e-05fadfe4bd29","name":"25.09 \u041b\u041a\u041b D","description":"\u0412\u044b \u0431\u044b\u043b\u0438 \u043f\u0440\u0438\u0433\u043b\u0430\u0448\u0435\u043d\u044b \u043d\u0430 \u0440\u0430\u0431\u043e\u0442\u0443: 25.09 \u041b\u041a\u041b D.","created_at":"2022-10-02T12:43:46.000000Z"}]`),
 			appId:        "",
 			appSignature: "",
@@ -311,8 +490,8 @@ func (s *receiverSuite) TestHandlePut() {
 			number:       1,
 			method:       "PUT",
 			url:          "http://localhost:8080/api/v1/notifications/batch",
-			on:           []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "Start", "Stop", "Log"},
-			ret:          [][]interface{}{{nilError}, {[][]byte{}}, {0, errors.New("no rows")}, {nilError}, {nilError}, {nilError}, {}, {}, {}},
+			on:           []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "Start", "Stop"},
+			ret:          [][]interface{}{{nilError}, {[][]byte{}}, {0, model.ErrNoRows}, {model.AppIdentity{}, nilError}, {model.AppIdentity{}, nilError}, {nilError}, {}, {}},
 			body:         []byte(`[{"user_uuid":"2593ede0-2301-4480-a452-752f03dcfab0","category":"new_rank","uuid":"75359b90-a0de-4e50-bbcf-ba400d17033f","task_uuid":null,"object_uuid":"fd7f3b4e-008d-4629-af8e-05fadfe4bd29","name":"25.09 \u041b\u041a\u041b D","description":"\u0412\u044b \u0431\u044b\u043b\u0438 \u043f\u0440\u0438\u0433\u043b\u0430\u0448\u0435\u043d\u044b \u043d\u0430 \u0440\u0430\u0431\u043e\u0442\u0443: 25.09 \u041b\u041a\u041b D.","created_at":"2022-10-02T12:43:46.000000Z"}]`),
 			appId:        "",
 			appSignature: "",
@@ -322,6 +501,23 @@ func (s *receiverSuite) TestHandlePut() {
 			readError:    nil,
 			wantResBody:  []byte(`{"success":true,"data":null}`), // null interpreted as []
 		},
+
+		{
+			name:         "Scope denies item",
+			number:       2,
+			method:       "PUT",
+			url:          "http://localhost:8080/api/v1/notifications/batch",
+			on:           []string{"Save", "Extract", "Count", "AuthInternal", "AuthExternal", "Start", "Stop"},
+			ret:          [][]interface{}{{nilError}, {[][]byte{}}, {0, model.ErrNoRows}, {model.AppIdentity{}, nilError}, {model.AppIdentity{AppID: "crm", Subject: "crm"}, model.ItemAuthErrors{{Index: 0, UUID: uuid.MustParse("75359b90-a0de-4e50-bbcf-ba400d17033f"), Reason: "category \"new_rank\" is not allowed"}}}, {nilError}, {}, {}},
+			body:         []byte(`[{"user_uuid":"2593ede0-2301-4480-a452-752f03dcfab0","category":"new_rank","uuid":"75359b90-a0de-4e50-bbcf-ba400d17033f","task_uuid":null,"object_uuid":"fd7f3b4e-008d-4629-af8e-05fadfe4bd29","name":"25.09 \u041b\u041a\u041b D","description":"\u0412\u044b \u0431\u044b\u043b\u0438 \u043f\u0440\u0438\u0433\u043b\u0430\u0448\u0435\u043d\u044b \u043d\u0430 \u0440\u0430\u0431\u043e\u0442\u0443: 25.09 \u041b\u041a\u041b D.","created_at":"2022-10-02T12:43:46.000000Z"}]`),
+			appId:        "crm",
+			appSignature: "",
+			writeError:   nil,
+			reqError:     nil,
+			doError:      nil,
+			readError:    nil,
+			wantResBody:  []byte(`{"success":false,"data":[{"index":0,"uuid":"75359b90-a0de-4e50-bbcf-ba400d17033f","reason":"category \"new_rank\" is not allowed"}],"error":[{"code":50002100,"msg":"Unauthorized"}]}`),
+		},
 	}
 	for _, v := range tt {
 		s.Run(v.name, func() {
@@ -335,7 +531,7 @@ func (s *receiverSuite) TestHandlePut() {
 					ma.On(w).Return(v.ret[j]...)
 				}
 			}
-			rcvr := NewReceiver(ma, &sync.WaitGroup{}, &sync.WaitGroup{})
+			rcvr := NewReceiver(ma, nil, &sync.WaitGroup{}, &sync.WaitGroup{})
 
 			// setting mux
 			mux := http.NewServeMux()
@@ -390,3 +586,765 @@ func (s *receiverSuite) TestHandlePut() {
 		})
 	}
 }
+
+func (s *receiverSuite) TestHandleBroadcast() {
+	broadcastUUID := uuid.MustParse("0c8e0a57-8a25-4b0e-9c0a-54a1b1a2c7a1")
+	progress := model.BroadcastProgress{UUID: broadcastUUID, State: model.BroadcastRunning, Total: 10000, Done: 500}
+
+	tt := []struct {
+		name        string
+		method      string
+		url         string
+		on          []string
+		ret         [][]interface{}
+		body        []byte
+		clientCert  bool
+		wantStatus  int
+		wantResBody []byte
+	}{
+		{
+			name:        "Auth fail",
+			method:      "POST",
+			url:         "http://localhost:8080/api/v1/notifications/broadcast",
+			on:          []string{"AuthExternal", "Broadcast"},
+			ret:         [][]interface{}{{model.AppIdentity{}, errors.New("failed")}, {broadcastUUID, nilError}},
+			body:        []byte(`{"segment":"beta","category":"news"}`),
+			wantStatus:  http.StatusUnauthorized,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002100,"msg":"Unauthorized"}]}`),
+		},
+		{
+			name:        "Scope denies recipient",
+			method:      "POST",
+			url:         "http://localhost:8080/api/v1/notifications/broadcast",
+			on:          []string{"AuthExternal", "Broadcast"},
+			ret:         [][]interface{}{{model.AppIdentity{AppID: "crm", Subject: "crm"}, model.ItemAuthErrors{{Index: 1, UUID: uuid.MustParse("f593ede0-2301-4480-a452-752f03dcfab0"), Reason: "user f593ede0-2301-4480-a452-752f03dcfab0 is not allowed"}}}, {broadcastUUID, nilError}},
+			body:        []byte(`{"users":["2593ede0-2301-4480-a452-752f03dcfab0","f593ede0-2301-4480-a452-752f03dcfab0"],"category":"news"}`),
+			wantStatus:  http.StatusForbidden,
+			wantResBody: []byte(`{"success":false,"data":[{"index":1,"uuid":"f593ede0-2301-4480-a452-752f03dcfab0","reason":"user f593ede0-2301-4480-a452-752f03dcfab0 is not allowed"}],"error":[{"code":50002100,"msg":"Unauthorized"}]}`),
+		},
+		{
+			name:        "Operation forbidden",
+			method:      "POST",
+			url:         "http://localhost:8080/api/v1/notifications/broadcast",
+			on:          []string{"AuthExternal", "Broadcast"},
+			ret:         [][]interface{}{{model.AppIdentity{AppID: "mailer", Subject: "mailer"}, fmt.Errorf("in authorizer.scope app \"mailer\" may not perform \"broadcast\": %w", model.ErrForbidden)}, {broadcastUUID, nilError}},
+			body:        []byte(`{"segment":"beta","category":"news"}`),
+			wantStatus:  http.StatusForbidden,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002100,"msg":"Unauthorized"}]}`),
+		},
+		{
+			name:        "Wrong body",
+			method:      "POST",
+			url:         "http://localhost:8080/api/v1/notifications/broadcast",
+			on:          []string{"AuthExternal", "Broadcast"},
+			ret:         [][]interface{}{{model.AppIdentity{}, nilError}, {uuid.Nil, errors.New("in application.Broadcast request has empty category")}},
+			body:        []byte(`{"segment":"beta"}`),
+			wantStatus:  http.StatusBadRequest,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002300,"msg":"Wrong request"}]}`),
+		},
+		{
+			name:        "Queued",
+			method:      "POST",
+			url:         "http://localhost:8080/api/v1/notifications/broadcast",
+			on:          []string{"AuthExternal", "Broadcast"},
+			ret:         [][]interface{}{{model.AppIdentity{}, nilError}, {broadcastUUID, nilError}},
+			body:        []byte(`{"segment":"beta","category":"news"}`),
+			wantStatus:  http.StatusAccepted,
+			wantResBody: []byte(`{"success":true,"data":{"uuid":"0c8e0a57-8a25-4b0e-9c0a-54a1b1a2c7a1"}}`),
+		},
+		{
+			name:        "Queued by app with client certificate",
+			method:      "POST",
+			url:         "https://localhost:8443/api/v1/notifications/broadcast",
+			on:          []string{"AuthInternal", "Broadcast"},
+			ret:         [][]interface{}{{model.AppIdentity{AppID: "crm", Subject: "crm.internal"}, nilError}, {broadcastUUID, nilError}},
+			body:        []byte(`{"segment":"beta","category":"news"}`),
+			clientCert:  true,
+			wantStatus:  http.StatusAccepted,
+			wantResBody: []byte(`{"success":true,"data":{"uuid":"0c8e0a57-8a25-4b0e-9c0a-54a1b1a2c7a1"}}`),
+		},
+		{
+			name:        "Progress",
+			method:      "GET",
+			url:         "http://localhost:8080/api/v1/notifications/broadcast/progress?uuid=0c8e0a57-8a25-4b0e-9c0a-54a1b1a2c7a1",
+			on:          []string{"AuthExternal", "BroadcastProgress"},
+			ret:         [][]interface{}{{model.AppIdentity{}, nilError}, {progress, nilError}},
+			wantStatus:  http.StatusOK,
+			wantResBody: []byte(`{"success":true,"data":{"uuid":"0c8e0a57-8a25-4b0e-9c0a-54a1b1a2c7a1","state":"running","total":10000,"done":500}}`),
+		},
+		{
+			name:        "Progress of broadcast of another app",
+			method:      "GET",
+			url:         "http://localhost:8080/api/v1/notifications/broadcast/progress?uuid=0c8e0a57-8a25-4b0e-9c0a-54a1b1a2c7a1",
+			on:          []string{"AuthExternal", "BroadcastProgress"},
+			ret:         [][]interface{}{{model.AppIdentity{AppID: "mailer", Subject: "mailer"}, nilError}, {model.BroadcastProgress{}, fmt.Errorf("in application.BroadcastProgress broadcast is not sent by app \"mailer\": %w", model.ErrForbidden)}},
+			wantStatus:  http.StatusForbidden,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002100,"msg":"Unauthorized"}]}`),
+		},
+		{
+			name:        "Progress of unknown broadcast",
+			method:      "GET",
+			url:         "http://localhost:8080/api/v1/notifications/broadcast/progress?uuid=" + uuid.NewString(),
+			on:          []string{"AuthExternal", "BroadcastProgress"},
+			ret:         [][]interface{}{{model.AppIdentity{}, nilError}, {model.BroadcastProgress{}, errors.New("broadcast not found")}},
+			wantStatus:  http.StatusBadRequest,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002300,"msg":"Wrong request"}]}`),
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			ma := &mockApp{}
+			for j, w := range v.on {
+				ma.On(w).Return(v.ret[j]...)
+			}
+			rcvr := NewReceiver(ma, nil, &sync.WaitGroup{}, &sync.WaitGroup{})
+
+			req := httptest.NewRequest(v.method, v.url, bytes.NewReader(v.body))
+			if v.clientCert {
+				req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{}}}
+			}
+			rec := httptest.NewRecorder()
+			rcvr.Routes().ServeHTTP(rec, req)
+
+			s.Equal(v.wantStatus, rec.Code)
+			s.Equal(v.wantResBody, rec.Body.Bytes())
+		})
+	}
+}
+
+func (s *receiverSuite) TestHandleApps() {
+	adminPrincipal := model.Principal{Subject: "2593ede0-2301-4480-a452-752f03dcfab0", Roles: []model.Role{model.RoleAdmin}}
+	created := time.Date(2022, 10, 2, 12, 0, 0, 0, time.UTC)
+	secretUUID := uuid.MustParse("0c8e0a57-8a25-4b0e-9c0a-54a1b1a2c7a1")
+
+	tt := []struct {
+		name        string
+		method      string
+		url         string
+		on          []string
+		ret         [][]interface{}
+		body        []byte
+		wantStatus  int
+		wantResBody []byte
+	}{
+		{
+			name:        "Create",
+			method:      "POST",
+			url:         "http://localhost:8080/api/v1/admin/apps",
+			on:          []string{"AuthUser", "AuthAccess", "CreateApp"},
+			ret:         [][]interface{}{{adminPrincipal, nilError}, {nilError}, {model.App{ID: "crm", Name: "CRM", CreatedAt: created}, nilError}},
+			body:        []byte(`{"id":"crm","name":"CRM"}`),
+			wantStatus:  http.StatusCreated,
+			wantResBody: []byte(`{"success":true,"data":{"id":"crm","name":"CRM","scope":{"categories":null,"operations":null,"users":null},"created_at":"2022-10-02T12:00:00Z","last_used_at":"0001-01-01T00:00:00Z","revoked":false}}`),
+		},
+		{
+			name:        "Create by not admin",
+			method:      "POST",
+			url:         "http://localhost:8080/api/v1/admin/apps",
+			on:          []string{"AuthUser", "AuthAccess", "CreateApp"},
+			ret:         [][]interface{}{{model.Principal{Subject: "2593ede0-2301-4480-a452-752f03dcfab0", Roles: []model.Role{model.RoleSupport}}, nilError}, {errors.New("in application.AuthAccess may not perform \"admin\"")}, {model.App{}, nilError}},
+			body:        []byte(`{"id":"crm"}`),
+			wantStatus:  http.StatusForbidden,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002100,"msg":"Unauthorized"}]}`),
+		},
+		{
+			name:        "Create without token",
+			method:      "POST",
+			url:         "http://localhost:8080/api/v1/admin/apps",
+			on:          []string{"AuthUser", "AuthAccess", "CreateApp"},
+			ret:         [][]interface{}{{model.Principal{}, errors.New("in authorizer.User request has no bearer token")}, {nilError}, {model.App{}, nilError}},
+			body:        []byte(`{"id":"crm"}`),
+			wantStatus:  http.StatusUnauthorized,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002100,"msg":"Unauthorized"}]}`),
+		},
+		{
+			name:        "App",
+			method:      "GET",
+			url:         "http://localhost:8080/api/v1/admin/apps/info?app_id=crm",
+			on:          []string{"AuthUser", "AuthAccess", "App"},
+			ret:         [][]interface{}{{adminPrincipal, nilError}, {nilError}, {model.App{ID: "crm", CreatedAt: created, LastUsedAt: created.Add(time.Hour), Secrets: []model.AppSecret{{UUID: secretUUID, AppID: "crm", CreatedAt: created, LastUsedAt: created.Add(time.Hour)}}}, nilError}},
+			wantStatus:  http.StatusOK,
+			wantResBody: []byte(`{"success":true,"data":{"id":"crm","name":"","scope":{"categories":null,"operations":null,"users":null},"created_at":"2022-10-02T12:00:00Z","last_used_at":"2022-10-02T13:00:00Z","revoked":false,"secrets":[{"uuid":"0c8e0a57-8a25-4b0e-9c0a-54a1b1a2c7a1","app_id":"crm","created_at":"2022-10-02T12:00:00Z","last_used_at":"2022-10-02T13:00:00Z"}]}}`),
+		},
+		{
+			name:        "Unknown app",
+			method:      "GET",
+			url:         "http://localhost:8080/api/v1/admin/apps/info?app_id=shop",
+			on:          []string{"AuthUser", "AuthAccess", "App"},
+			ret:         [][]interface{}{{adminPrincipal, nilError}, {nilError}, {model.App{}, errors.New("in credentials.App unknown app \"shop\"")}},
+			wantStatus:  http.StatusBadRequest,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002300,"msg":"Wrong request"}]}`),
+		},
+		{
+			name:        "Issue secret",
+			method:      "POST",
+			url:         "http://localhost:8080/api/v1/admin/apps/secret?app_id=crm",
+			on:          []string{"AuthUser", "AuthAccess", "IssueSecret"},
+			ret:         [][]interface{}{{adminPrincipal, nilError}, {nilError}, {model.AppSecret{UUID: secretUUID, AppID: "crm", Secret: "s3cr3t", CreatedAt: created}, nilError}},
+			wantStatus:  http.StatusCreated,
+			wantResBody: []byte(`{"success":true,"data":{"uuid":"0c8e0a57-8a25-4b0e-9c0a-54a1b1a2c7a1","app_id":"crm","secret":"s3cr3t","created_at":"2022-10-02T12:00:00Z","last_used_at":"0001-01-01T00:00:00Z"}}`),
+		},
+		{
+			name:        "Issue third secret",
+			method:      "POST",
+			url:         "http://localhost:8080/api/v1/admin/apps/secret?app_id=crm",
+			on:          []string{"AuthUser", "AuthAccess", "IssueSecret"},
+			ret:         [][]interface{}{{adminPrincipal, nilError}, {nilError}, {model.AppSecret{}, errors.New("in credentials.Issue app \"crm\": app has maximum number of active secrets")}},
+			wantStatus:  http.StatusBadRequest,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002300,"msg":"Wrong request"}]}`),
+		},
+		{
+			name:        "Revoke secret",
+			method:      "POST",
+			url:         "http://localhost:8080/api/v1/admin/apps/secret/revoke?app_id=crm&uuid=0c8e0a57-8a25-4b0e-9c0a-54a1b1a2c7a1",
+			on:          []string{"AuthUser", "AuthAccess", "RevokeSecret"},
+			ret:         [][]interface{}{{adminPrincipal, nilError}, {nilError}, {nilError}},
+			wantStatus:  http.StatusOK,
+			wantResBody: []byte(`{"success":true,"data":null}`),
+		},
+		{
+			name:        "Revoke app",
+			method:      "POST",
+			url:         "http://localhost:8080/api/v1/admin/apps/revoke?app_id=crm",
+			on:          []string{"AuthUser", "AuthAccess", "RevokeApp"},
+			ret:         [][]interface{}{{adminPrincipal, nilError}, {nilError}, {nilError}},
+			wantStatus:  http.StatusOK,
+			wantResBody: []byte(`{"success":true,"data":null}`),
+		},
+		{
+			name:        "Wrong method",
+			method:      "GET",
+			url:         "http://localhost:8080/api/v1/admin/apps/revoke?app_id=crm",
+			on:          []string{"AuthUser", "AuthAccess", "RevokeApp"},
+			ret:         [][]interface{}{{adminPrincipal, nilError}, {nilError}, {nilError}},
+			wantStatus:  http.StatusMethodNotAllowed,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002300,"msg":"Wrong request"}]}`),
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			ma := &mockApp{}
+			for j, w := range v.on {
+				ma.On(w).Return(v.ret[j]...)
+			}
+			rcvr := NewReceiver(ma, nil, &sync.WaitGroup{}, &sync.WaitGroup{})
+
+			rec := httptest.NewRecorder()
+			rcvr.Routes().ServeHTTP(rec, httptest.NewRequest(v.method, v.url, bytes.NewReader(v.body)))
+
+			s.Equal(v.wantStatus, rec.Code)
+			s.Equal(v.wantResBody, rec.Body.Bytes())
+		})
+	}
+}
+
+func (s *receiverSuite) TestHandleChange() {
+	user := model.Principal{Subject: "2593ede0-2301-4480-a452-752f03dcfab0", Roles: []model.Role{model.RoleUser}}
+
+	tt := []struct {
+		name        string
+		method      string
+		url         string
+		on          []string
+		ret         [][]interface{}
+		body        []byte
+		wantStatus  int
+		wantResBody []byte
+	}{
+		{
+			name:        "Mark read",
+			method:      "POST",
+			url:         "http://localhost:8080/api/v1/notifications/read?user_uuid=2593ede0-2301-4480-a452-752f03dcfab0",
+			on:          []string{"AuthUser", "AuthAccess", "MarkRead"},
+			ret:         [][]interface{}{{user, nilError}, {nilError}, {2, nilError}},
+			body:        []byte(`{"uuids":["75359b90-a0de-4e50-bbcf-ba400d17033f","fd7f3b4e-008d-4629-af8e-05fadfe4bd29"]}`),
+			wantStatus:  http.StatusOK,
+			wantResBody: []byte(`{"success":true,"data":{"count":2}}`),
+		},
+		{
+			name:        "Delete",
+			method:      "POST",
+			url:         "http://localhost:8080/api/v1/notifications/delete?user_uuid=2593ede0-2301-4480-a452-752f03dcfab0",
+			on:          []string{"AuthUser", "AuthAccess", "Delete"},
+			ret:         [][]interface{}{{user, nilError}, {nilError}, {1, nilError}},
+			body:        []byte(`{"uuids":["75359b90-a0de-4e50-bbcf-ba400d17033f"]}`),
+			wantStatus:  http.StatusOK,
+			wantResBody: []byte(`{"success":true,"data":{"count":1}}`),
+		},
+		{
+			name:        "CSRF mismatch",
+			method:      "POST",
+			url:         "http://localhost:8080/api/v1/notifications/delete?user_uuid=2593ede0-2301-4480-a452-752f03dcfab0",
+			on:          []string{"AuthUser", "AuthAccess", "Delete"},
+			ret:         [][]interface{}{{model.Principal{}, errors.New("in application.AuthUser CSRF header does not match session")}, {nilError}, {1, nilError}},
+			body:        []byte(`{"uuids":["75359b90-a0de-4e50-bbcf-ba400d17033f"]}`),
+			wantStatus:  http.StatusUnauthorized,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002100,"msg":"Unauthorized"}]}`),
+		},
+		{
+			name:        "Auditor marks read",
+			method:      "POST",
+			url:         "http://localhost:8080/api/v1/notifications/read?user_uuid=2593ede0-2301-4480-a452-752f03dcfab0",
+			on:          []string{"AuthUser", "AuthAccess", "MarkRead"},
+			ret:         [][]interface{}{{model.Principal{Subject: uuid.NewString(), Roles: []model.Role{model.RoleAuditor}}, nilError}, {errors.New("in application.AuthAccess may not perform \"mark_read\"")}, {1, nilError}},
+			body:        []byte(`{"uuids":["75359b90-a0de-4e50-bbcf-ba400d17033f"]}`),
+			wantStatus:  http.StatusForbidden,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002100,"msg":"Unauthorized"}]}`),
+		},
+		{
+			name:        "Empty uuids",
+			method:      "POST",
+			url:         "http://localhost:8080/api/v1/notifications/read?user_uuid=2593ede0-2301-4480-a452-752f03dcfab0",
+			on:          []string{"AuthUser", "AuthAccess", "MarkRead"},
+			ret:         [][]interface{}{{user, nilError}, {nilError}, {0, errors.New("in application.MarkRead request has empty uuids")}},
+			body:        []byte(`{"uuids":[]}`),
+			wantStatus:  http.StatusBadRequest,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002300,"msg":"Wrong request"}]}`),
+		},
+		{
+			name:        "No user_uuid",
+			method:      "POST",
+			url:         "http://localhost:8080/api/v1/notifications/read",
+			on:          []string{"AuthUser", "AuthAccess", "MarkRead"},
+			ret:         [][]interface{}{{user, nilError}, {nilError}, {1, nilError}},
+			body:        []byte(`{"uuids":["75359b90-a0de-4e50-bbcf-ba400d17033f"]}`),
+			wantStatus:  http.StatusBadRequest,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002300,"msg":"Wrong request"}]}`),
+		},
+		{
+			name:        "Wrong method",
+			method:      "GET",
+			url:         "http://localhost:8080/api/v1/notifications/delete?user_uuid=2593ede0-2301-4480-a452-752f03dcfab0",
+			on:          []string{"AuthUser", "AuthAccess", "Delete"},
+			ret:         [][]interface{}{{user, nilError}, {nilError}, {1, nilError}},
+			wantStatus:  http.StatusMethodNotAllowed,
+			wantResBody: []byte(`{"success":false,"error":[{"code":50002300,"msg":"Wrong request"}]}`),
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			ma := &mockApp{}
+			for j, w := range v.on {
+				ma.On(w).Return(v.ret[j]...)
+			}
+			rcvr := NewReceiver(ma, nil, &sync.WaitGroup{}, &sync.WaitGroup{})
+
+			rec := httptest.NewRecorder()
+			rcvr.Routes().ServeHTTP(rec, httptest.NewRequest(v.method, v.url, bytes.NewReader(v.body)))
+
+			s.Equal(v.wantStatus, rec.Code)
+			s.Equal(v.wantResBody, rec.Body.Bytes())
+		})
+	}
+}
+
+type tokenAuthorizer struct {
+	claims model.Claims
+}
+
+func (t tokenAuthorizer) Internal(model.WrappedReq) (model.AppIdentity, error) {
+	return model.AppIdentity{}, errors.New("no certificate")
+}
+func (t tokenAuthorizer) External(model.WrappedReq) (model.AppIdentity, error) {
+	return model.AppIdentity{}, errors.New("no signature")
+}
+func (t tokenAuthorizer) User(wr model.WrappedReq) (model.Claims, error) {
+	if wr.Req.Header.Get("Authorization") != "Bearer good" {
+		return model.Claims{}, errors.New("bad token")
+	}
+	return t.claims, nil
+}
+func (t tokenAuthorizer) ClientAddr(wr model.WrappedReq) (netip.Addr, error) {
+	ap, err := netip.ParseAddrPort(wr.Req.RemoteAddr)
+	return ap.Addr(), err
+}
+
+type discardSaver struct{}
+
+func (discardSaver) Save(model.WrappedLog) error { return nil }
+func (discardSaver) Flush() error                { return nil }
+func (discardSaver) Close() error                { return nil }
+
+func (s *receiverSuite) TestSessionCSRF() {
+	user := "2593ede0-2301-4480-a452-752f03dcfab0"
+	app := application.NewApplication(application.Adapters{
+		Store:      store.NewMemStore(),
+		Authorizer: tokenAuthorizer{claims: model.Claims{Subject: user, Roles: []model.Role{model.RoleUser}}},
+		Saver:      discardSaver{},
+		Sessions:   sessions.NewMemSessions(time.Hour),
+	})
+	h := NewReceiver(app, nil, &sync.WaitGroup{}, &sync.WaitGroup{}).Routes()
+
+	login := httptest.NewRequest("POST", "http://localhost:8080/api/v1/session", nil)
+	login.Header.Set("Authorization", "Bearer good")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, login)
+	s.Equal(http.StatusOK, rec.Code)
+
+	cookies := map[string]*http.Cookie{}
+	for _, v := range rec.Result().Cookies() {
+		s.True(v.Secure)
+		s.Equal(http.SameSiteStrictMode, v.SameSite)
+		cookies[v.Name] = v
+	}
+	s.Require().Contains(cookies, model.SessionCookie)
+	s.Require().Contains(cookies, model.CSRFCookie)
+	s.True(cookies[model.SessionCookie].HttpOnly)
+	s.False(cookies[model.CSRFCookie].HttpOnly)
+	csrf := cookies[model.CSRFCookie].Value
+
+	tt := []struct {
+		name       string
+		method     string
+		url        string
+		header     string
+		wantStatus int
+	}{
+		{
+			name:       "read without header",
+			method:     "GET",
+			url:        "http://localhost:8080/api/v1/notifications/count?user_uuid=" + user,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "mark read without header",
+			method:     "POST",
+			url:        "http://localhost:8080/api/v1/notifications/read?user_uuid=" + user,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "mark read with wrong header",
+			method:     "POST",
+			url:        "http://localhost:8080/api/v1/notifications/read?user_uuid=" + user,
+			header:     "forged",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "mark read with header",
+			method:     "POST",
+			url:        "http://localhost:8080/api/v1/notifications/read?user_uuid=" + user,
+			header:     csrf,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "delete with header",
+			method:     "POST",
+			url:        "http://localhost:8080/api/v1/notifications/delete?user_uuid=" + user,
+			header:     csrf,
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			req := httptest.NewRequest(v.method, v.url, bytes.NewReader([]byte(`{"uuids":["75359b90-a0de-4e50-bbcf-ba400d17033f"]}`)))
+			req.AddCookie(cookies[model.SessionCookie])
+			req.AddCookie(cookies[model.CSRFCookie])
+			if v.header != "" {
+				req.Header.Set(model.CSRFHeader, v.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			s.Equal(v.wantStatus, rec.Code, rec.Body.String())
+		})
+	}
+
+	logout := httptest.NewRequest("POST", "http://localhost:8080/api/v1/session/logout", nil)
+	logout.AddCookie(cookies[model.SessionCookie])
+	logout.AddCookie(cookies[model.CSRFCookie])
+	logout.Header.Set(model.CSRFHeader, csrf)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, logout)
+	s.Equal(http.StatusOK, rec.Code)
+
+	req := httptest.NewRequest("GET", "http://localhost:8080/api/v1/notifications/count?user_uuid="+user, nil)
+	req.AddCookie(cookies[model.SessionCookie])
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	s.Equal(http.StatusUnauthorized, rec.Code)
+}
+
+func (s *receiverSuite) TestLimit() {
+	ma := &mockApp{}
+	ma.On("AuthExternal").Return(model.AppIdentity{AppID: "crm"}, nilError)
+	ma.On("Save").Return(nilError)
+	ma.On("AuthUser").Return(model.Principal{Subject: "2593ede0-2301-4480-a452-752f03dcfab0", Roles: []model.Role{model.RoleAdmin}}, nilError)
+	ma.On("AuthAccess").Return(nilError)
+	ma.On("Count").Return(3, nilError)
+
+	l := limiter.NewLimiter(limiter.Config{
+		Routes: map[string]limiter.Limit{
+			"/api/v1/notifications/batch": {App: limiter.Rate{PerSecond: 0.1, Burst: 1}},
+			"/api/v1/notifications/count": {User: limiter.Rate{PerSecond: 0.5, Burst: 2}},
+		},
+	})
+	h := NewReceiver(ma, l, &sync.WaitGroup{}, &sync.WaitGroup{}).Routes()
+
+	tooMany := []byte(`{"success":false,"error":[{"code":50002900,"msg":"Too many requests"}]}`)
+	tt := []struct {
+		name           string
+		method         string
+		url            string
+		wantStatus     int
+		wantRetryAfter string
+		wantResBody    []byte
+	}{
+		{
+			name:        "batch",
+			method:      "PUT",
+			url:         "http://localhost:8080/api/v1/notifications/batch",
+			wantStatus:  http.StatusOK,
+			wantResBody: []byte(`{"success":true,"data":null}`),
+		},
+		{
+			name:           "batch limited by app",
+			method:         "PUT",
+			url:            "http://localhost:8080/api/v1/notifications/batch",
+			wantStatus:     http.StatusTooManyRequests,
+			wantRetryAfter: "10",
+			wantResBody:    tooMany,
+		},
+		{
+			name:        "count",
+			method:      "GET",
+			url:         "http://localhost:8080/api/v1/notifications/count?user_uuid=2593ede0-2301-4480-a452-752f03dcfab0",
+			wantStatus:  http.StatusOK,
+			wantResBody: []byte(`{"success":true,"data":{"count":3}}`),
+		},
+		{
+			name:        "count, burst",
+			method:      "GET",
+			url:         "http://localhost:8080/api/v1/notifications/count?user_uuid=2593ede0-2301-4480-a452-752f03dcfab0",
+			wantStatus:  http.StatusOK,
+			wantResBody: []byte(`{"success":true,"data":{"count":3}}`),
+		},
+		{
+			name:           "count limited by user",
+			method:         "GET",
+			url:            "http://localhost:8080/api/v1/notifications/count?user_uuid=2593ede0-2301-4480-a452-752f03dcfab0",
+			wantStatus:     http.StatusTooManyRequests,
+			wantRetryAfter: "2",
+			wantResBody:    tooMany,
+		},
+		{
+			name:        "limiter state",
+			method:      "GET",
+			url:         "http://localhost:8080/api/v1/admin/limits",
+			wantStatus:  http.StatusOK,
+			wantResBody: []byte(`{"success":true,"data":{"buckets":2,"routes":{"/api/v1/admin/limits":{"allowed":1,"rejected":0},"/api/v1/notifications/batch":{"allowed":1,"rejected":1},"/api/v1/notifications/count":{"allowed":2,"rejected":1}}}}`),
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(v.method, v.url, bytes.NewReader([]byte(`[]`))))
+
+			s.Equal(v.wantStatus, rec.Code)
+			s.Equal(v.wantRetryAfter, rec.Header().Get("Retry-After"))
+			s.Equal(string(v.wantResBody), rec.Body.String())
+		})
+	}
+}
+
+func (s *receiverSuite) TestLimitIPBeforeAuth() {
+	ma := &mockApp{}
+	ma.On("AuthExternal").Return(model.AppIdentity{}, errors.New("in authorizer.External request has empty signature headers"))
+
+	l := limiter.NewLimiter(limiter.Config{
+		Routes: map[string]limiter.Limit{
+			"/api/v1/notifications/batch": {IP: limiter.Rate{PerSecond: 0.1, Burst: 1}},
+		},
+	})
+	h := NewReceiver(ma, l, &sync.WaitGroup{}, &sync.WaitGroup{}).Routes()
+
+	tt := []struct {
+		name       string
+		remote     string
+		wantStatus int
+	}{
+		{name: "first", remote: "192.0.2.10:4000", wantStatus: http.StatusUnauthorized},
+		{name: "limited by IP", remote: "192.0.2.10:4001", wantStatus: http.StatusTooManyRequests},
+		{name: "other IP", remote: "198.51.100.7:4000", wantStatus: http.StatusUnauthorized},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			req := httptest.NewRequest("PUT", "http://localhost:8080/api/v1/notifications/batch", bytes.NewReader([]byte(`[]`)))
+			req.RemoteAddr = v.remote
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			s.Equal(v.wantStatus, rec.Code)
+		})
+	}
+	ma.AssertNumberOfCalls(s.T(), "AuthExternal", 2)
+	s.Equal(model.RouteLimitState{Rejected: 1}, l.State().Routes["/api/v1/notifications/batch"])
+}
+
+func (s *receiverSuite) TestLogLevel() {
+	admin := model.Principal{Subject: "2593ede0-2301-4480-a452-752f03dcfab0", Roles: []model.Role{model.RoleAdmin}}
+	tt := []struct {
+		name        string
+		method      string
+		body        string
+		accessErr   error
+		wantStatus  int
+		wantResBody string
+		wantLevel   model.Level
+	}{
+		{name: "get", method: "GET", wantStatus: http.StatusOK, wantResBody: `{"success":true,"data":{"level":"INFO"}}`, wantLevel: model.LevelInfo},
+		{name: "set", method: "POST", body: `{"level":"debug"}`, wantStatus: http.StatusOK, wantResBody: `{"success":true,"data":{"level":"DEBUG"}}`, wantLevel: model.LevelDebug},
+		{name: "unknown level", method: "POST", body: `{"level":"verbose"}`, wantStatus: http.StatusBadRequest, wantResBody: `{"success":false,"error":[{"code":50002300,"msg":"Wrong request"}]}`, wantLevel: model.LevelInfo},
+		{name: "not admin", method: "POST", body: `{"level":"debug"}`, accessErr: errors.New("operation admin is not allowed"), wantStatus: http.StatusForbidden, wantResBody: `{"success":false,"error":[{"code":50002100,"msg":"Unauthorized"}]}`, wantLevel: model.LevelInfo},
+		{name: "wrong method", method: "PUT", body: `{"level":"debug"}`, wantStatus: http.StatusMethodNotAllowed, wantResBody: `{"success":false,"error":[{"code":50002300,"msg":"Wrong request"}]}`, wantLevel: model.LevelInfo},
+		{name: "delete", method: "DELETE", wantStatus: http.StatusMethodNotAllowed, wantResBody: `{"success":false,"error":[{"code":50002300,"msg":"Wrong request"}]}`, wantLevel: model.LevelInfo},
+		{name: "head", method: "HEAD", wantStatus: http.StatusMethodNotAllowed, wantLevel: model.LevelInfo},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			ma := &mockApp{log: logger.NewLogger(&recSaver{}, model.LevelInfo)}
+			ma.On("AuthUser").Return(admin, nilError)
+			ma.On("AuthAccess").Return(v.accessErr)
+			rcvr := NewReceiver(ma, nil, &sync.WaitGroup{}, &sync.WaitGroup{})
+
+			rec := httptest.NewRecorder()
+			rcvr.Routes().ServeHTTP(rec, httptest.NewRequest(v.method, "http://localhost:8080/api/v1/admin/loglevel", bytes.NewReader([]byte(v.body))))
+
+			s.Equal(v.wantStatus, rec.Code)
+			if v.method != "HEAD" {
+				s.Equal(v.wantResBody, rec.Body.String())
+			}
+			if v.wantStatus == http.StatusMethodNotAllowed {
+				s.Equal("GET, POST", rec.Header().Get("Allow"))
+				ma.AssertNotCalled(s.T(), "AuthUser")
+			}
+			s.Equal(v.wantLevel, ma.log.Level())
+		})
+	}
+}
+
+type recSaver struct {
+	logs []model.WrappedLog
+}
+
+func (r *recSaver) Save(wl model.WrappedLog) error {
+	r.logs = append(r.logs, wl)
+	return nil
+}
+
+func (s *receiverSuite) TestRedactions() {
+	admin := model.Principal{Subject: "2593ede0-2301-4480-a452-752f03dcfab0", Roles: []model.Role{model.RoleAdmin}}
+	tt := []struct {
+		name        string
+		method      string
+		accessErr   error
+		wantStatus  int
+		wantResBody string
+	}{
+		{name: "admin", method: "GET", wantStatus: http.StatusOK, wantResBody: `{"success":true,"data":{"all":{"email":2,"user":1},"sinks":{"email":2}}}`},
+		{name: "not admin", method: "GET", accessErr: errors.New("operation admin is not allowed"), wantStatus: http.StatusForbidden, wantResBody: `{"success":false,"error":[{"code":50002100,"msg":"Unauthorized"}]}`},
+		{name: "wrong method", method: "POST", wantStatus: http.StatusMethodNotAllowed, wantResBody: `{"success":false,"error":[{"code":50002300,"msg":"Wrong request"}]}`},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			ma := &mockApp{}
+			ma.On("AuthUser").Return(admin, nilError)
+			ma.On("AuthAccess").Return(v.accessErr)
+			ma.On("Redactions").Return(map[string]map[string]uint64{"all": {"email": 2, "user": 1}, "sinks": {"email": 2}})
+			rcvr := NewReceiver(ma, nil, &sync.WaitGroup{}, &sync.WaitGroup{})
+
+			rec := httptest.NewRecorder()
+			rcvr.Routes().ServeHTTP(rec, httptest.NewRequest(v.method, "http://localhost:8080/api/v1/admin/redactions", nil))
+
+			s.Equal(v.wantStatus, rec.Code)
+			s.Equal(v.wantResBody, rec.Body.String())
+		})
+	}
+}
+
+func (s *receiverSuite) TestAccessLog() {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tt := []struct {
+		name      string
+		handler   http.HandlerFunc
+		latency   time.Duration
+		wantLevel string
+		wantMsg   string
+		wantEntry model.AccessEntry
+	}{
+		{
+			name: "created",
+			handler: func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"success":true}`))
+			},
+			latency:   20 * time.Millisecond,
+			wantLevel: "",
+			wantMsg:   "request",
+			wantEntry: model.AccessEntry{Method: "POST", Path: "/api/v1/admin/apps", Status: http.StatusCreated, Bytes: 16, Latency: 20 * time.Millisecond, UserAgent: "curl/8.0", IP: "192.0.2.1"},
+		},
+		{
+			name:      "nothing written",
+			handler:   func(w http.ResponseWriter, req *http.Request) {},
+			wantLevel: "",
+			wantMsg:   "request",
+			wantEntry: model.AccessEntry{Method: "POST", Path: "/api/v1/admin/apps", Status: http.StatusOK, UserAgent: "curl/8.0", IP: "192.0.2.1"},
+		},
+		{
+			name: "slow",
+			handler: func(w http.ResponseWriter, req *http.Request) {
+				w.Write([]byte(`ok`))
+			},
+			latency:   1500 * time.Millisecond,
+			wantLevel: "WARN",
+			wantMsg:   "slow request",
+			wantEntry: model.AccessEntry{Method: "POST", Path: "/api/v1/admin/apps", Status: http.StatusOK, Bytes: 2, Latency: 1500 * time.Millisecond, UserAgent: "curl/8.0", IP: "192.0.2.1", Slow: true},
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			rs := &recSaver{}
+			ma := &mockApp{log: logger.NewLogger(rs, model.LevelInfo)}
+			rcvr := NewReceiver(ma, nil, &sync.WaitGroup{}, &sync.WaitGroup{})
+			calls := 0
+			rcvr.now = func() time.Time {
+				calls++
+				if calls == 1 {
+					return start
+				}
+				return start.Add(v.latency)
+			}
+			var ctxUUID uuid.UUID
+			h := rcvr.AccessLog(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				ctxUUID, _ = model.RequestUUID(req.Context())
+				v.handler(w, req)
+			}))
+
+			req := httptest.NewRequest("POST", "http://localhost:8080/api/v1/admin/apps", nil)
+			req.Header.Set("User-Agent", "curl/8.0")
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			s.Len(rs.logs, 1)
+			s.Equal(v.wantLevel, rs.logs[0].UW.Str)
+			s.Equal(v.wantMsg, rs.logs[0].L)
+			s.NotEqual(uuid.Nil, ctxUUID)
+			s.Equal(ctxUUID, rs.logs[0].UW.UUID)
+			v.wantEntry.UUID = ctxUUID
+			s.Equal(v.wantEntry.Fields(), rs.logs[0].F)
+		})
+	}
+}
+
+func (s *receiverSuite) TestAccessLogUUID() {
+	rs := &recSaver{}
+	ma := &mockApp{log: logger.NewLogger(rs, model.LevelInfo)}
+	rcvr := NewReceiver(ma, nil, &sync.WaitGroup{}, &sync.WaitGroup{})
+
+	rec := httptest.NewRecorder()
+	rcvr.AccessLog(rcvr.Routes()).ServeHTTP(rec, httptest.NewRequest("GET", "http://localhost:8080/api/v1/notifications/count?user_uuid=wrong", nil))
+
+	s.Equal(http.StatusBadRequest, rec.Code)
+	s.Len(rs.logs, 2)
+	s.Equal("ERROR", rs.logs[0].UW.Str)
+	s.Equal("in receiver.HandleCount", rs.logs[0].L)
+	s.Equal("", rs.logs[1].UW.Str)
+	s.Contains(rs.logs[1].F, model.Field{Key: "status", Value: http.StatusBadRequest})
+	s.Equal(rs.logs[0].UW.UUID, rs.logs[1].UW.UUID)
+}
@@ -0,0 +1,178 @@
+package auditor
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+// Append-only, each entry holds hash of previous one
+type Auditor interface {
+	Record(...model.AuditEntry) error
+	Verify() error
+	Close() error
+}
+
+// Auditor implementation
+
+// ChainError is first broken entry of audit log, Line starts from 1
+type ChainError struct {
+	Line   int
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("in auditor.Verify line %d: %s", e.Line, e.Reason)
+}
+
+type fileAuditor struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	seq  uint64
+	last string
+	now  func() time.Time
+	sync func(*os.File) error
+}
+
+// NewFileAuditor returns Auditor appending JSON lines to file at path.
+// Existing file is verified first, chain is continued only if it is not broken.
+func NewFileAuditor(path string) (*fileAuditor, error) {
+	n, last, err := VerifyFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("in auditor.NewFileAuditor %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("in auditor.NewFileAuditor unable to open file: %w", err)
+	}
+	return &fileAuditor{
+		path: path,
+		f:    f,
+		seq:  uint64(n),
+		last: last,
+		now:  time.Now,
+		sync: (*os.File).Sync,
+	}, nil
+}
+
+// Record sets sequence numbers, time if it is zero, and hashes of entries, then appends them to file and syncs it once
+func (a *fileAuditor) Record(es ...model.AuditEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	seq, last := a.seq, a.last
+	buf := bytes.Buffer{}
+	for _, e := range es {
+		if e.Time.IsZero() {
+			e.Time = a.now()
+		}
+		e.Time = e.Time.UTC()
+		e.Seq = seq + 1
+		e.Prev = last
+		h, err := hash(e)
+		if err != nil {
+			return fmt.Errorf("in auditor.Record %w", err)
+		}
+		e.Hash = h
+		b, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("in auditor.Record unable to marshal entry: %w", err)
+		}
+		buf.Write(append(b, '\n'))
+		seq, last = e.Seq, e.Hash
+	}
+	_, err := a.f.Write(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("in auditor.Record unable to write entry: %w", err)
+	}
+	err = a.sync(a.f)
+	if err != nil {
+		return fmt.Errorf("in auditor.Record unable to sync file: %w", err)
+	}
+	a.seq, a.last = seq, last
+	return nil
+}
+
+// Verify checks whole chain of file, *ChainError points to first broken entry
+func (a *fileAuditor) Verify() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, _, err := VerifyFile(a.path)
+	return err
+}
+
+func (a *fileAuditor) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.f.Close()
+}
+
+// VerifyFile checks chain of audit log at path and returns number of entries and hash of the last one.
+// Changed, removed, inserted or reordered entries break the chain, *ChainError points to the first broken one.
+func VerifyFile(path string) (int, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	n, last := 0, ""
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) == 0 && errors.Is(err, io.EOF) {
+			return n, last, nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return n, last, fmt.Errorf("in auditor.Verify unable to read file: %w", err)
+		}
+		if err != nil {
+			return n, last, &ChainError{Line: n + 1, Reason: "incomplete line"}
+		}
+		e := model.AuditEntry{}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		if dec.Decode(&e) != nil {
+			return n, last, &ChainError{Line: n + 1, Reason: "invalid entry"}
+		}
+		if e.Seq != uint64(n+1) {
+			return n, last, &ChainError{Line: n + 1, Reason: fmt.Sprintf("sequence number %d, want %d", e.Seq, n+1)}
+		}
+		if e.Prev != last {
+			return n, last, &ChainError{Line: n + 1, Reason: "previous hash does not match"}
+		}
+		h, err := hash(e)
+		if err != nil {
+			return n, last, fmt.Errorf("in auditor.Verify %w", err)
+		}
+		if h != e.Hash {
+			return n, last, &ChainError{Line: n + 1, Reason: "hash does not match"}
+		}
+		n++
+		last = e.Hash
+	}
+}
+
+// hash returns hex SHA-256 of JSON of e without its own hash, Prev links it to previous entry
+func hash(e model.AuditEntry) (string, error) {
+	e.Hash = ""
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal entry: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
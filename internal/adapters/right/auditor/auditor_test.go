@@ -0,0 +1,178 @@
+package auditor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+type auditorSuite struct {
+	suite.Suite
+}
+
+func TestAuditorSuite(t *testing.T) {
+	suite.Run(t, new(auditorSuite))
+}
+
+// newLog returns path of audit log with three entries and its lines
+func newLog(s *auditorSuite) (string, [][]byte) {
+	path := filepath.Join(s.T().TempDir(), "audit.log")
+	a, err := NewFileAuditor(path)
+	s.NoError(err)
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.FixedZone("MSK", 3*60*60))
+	a.now = func() time.Time { return now }
+	s.NoError(a.Record(model.AuditEntry{Request: uuid.New(), Actor: "crm", ActorKind: "app", Action: model.AuditSave, Targets: []string{uuid.NewString()}, Outcome: model.AuditSuccess}))
+	s.NoError(a.Record(model.AuditEntry{Request: uuid.New(), Actor: "2593ede0-2301-4480-a452-752f03dcfab0", ActorKind: "user", Action: model.AuditDelete, User: "2593ede0-2301-4480-a452-752f03dcfab0", Targets: []string{uuid.NewString()}, Outcome: model.AuditSuccess}))
+	s.NoError(a.Record(model.AuditEntry{Request: uuid.New(), Actor: "2593ede0-2301-4480-a452-752f03dcfab0", ActorKind: "user", Action: model.AuditAppRevoke, Targets: []string{"crm"}, Outcome: model.AuditFailure, Error: "app is revoked"}))
+	s.NoError(a.Verify())
+	s.NoError(a.Close())
+
+	b, err := os.ReadFile(path)
+	s.NoError(err)
+	return path, bytes.SplitAfter(b, []byte("\n"))[:3]
+}
+
+func (s *auditorSuite) TestRecord() {
+	path, lines := newLog(s)
+	s.Contains(string(lines[0]), `"seq":1,"time":"2024-05-01T07:00:00Z"`)
+	s.Contains(string(lines[0]), `"prev":""`)
+
+	n, last, err := VerifyFile(path)
+	s.NoError(err)
+	s.Equal(3, n)
+	s.Len(last, 64)
+
+	// reopened auditor continues chain
+	a, err := NewFileAuditor(path)
+	s.NoError(err)
+	s.NoError(a.Record(model.AuditEntry{Actor: "crm", ActorKind: "app", Action: model.AuditSave, Outcome: model.AuditSuccess}))
+	s.NoError(a.Verify())
+
+	// several entries are chained in order
+	s.NoError(a.Record(
+		model.AuditEntry{Actor: "crm", ActorKind: "app", Action: model.AuditBroadcast, User: "2593ede0-2301-4480-a452-752f03dcfab0", Outcome: model.AuditSuccess},
+		model.AuditEntry{Actor: "crm", ActorKind: "app", Action: model.AuditBroadcast, User: "f593ede0-2301-4480-a452-752f03dcfab0", Outcome: model.AuditSuccess},
+	))
+	s.NoError(a.Close())
+	n, _, err = VerifyFile(path)
+	s.NoError(err)
+	s.Equal(6, n)
+	b, err := os.ReadFile(path)
+	s.NoError(err)
+	s.Contains(string(bytes.SplitAfter(b, []byte("\n"))[5]), `"seq":6`)
+
+	// sync failure is reported
+	a, err = NewFileAuditor(path)
+	s.NoError(err)
+	a.sync = func(*os.File) error { return errors.New("input/output error") }
+	s.ErrorContains(a.Record(model.AuditEntry{Actor: "crm"}), "unable to sync file")
+	s.NoError(a.Close())
+}
+
+func (s *auditorSuite) TestTamper() {
+	tt := []struct {
+		name       string
+		tamper     func([][]byte) [][]byte
+		wantLine   int
+		wantReason string
+	}{
+		{
+			name: "changed actor",
+			tamper: func(l [][]byte) [][]byte {
+				l[1] = bytes.Replace(l[1], []byte(`"actor":"2593ede0`), []byte(`"actor":"3593ede0`), 1)
+				return l
+			},
+			wantLine:   2,
+			wantReason: "hash does not match",
+		},
+		{
+			name: "changed outcome",
+			tamper: func(l [][]byte) [][]byte {
+				l[2] = bytes.Replace(l[2], []byte(`"outcome":"failure"`), []byte(`"outcome":"success"`), 1)
+				return l
+			},
+			wantLine:   3,
+			wantReason: "hash does not match",
+		},
+		{
+			name:       "removed entry",
+			tamper:     func(l [][]byte) [][]byte { return [][]byte{l[0], l[2]} },
+			wantLine:   2,
+			wantReason: "sequence number 3, want 2",
+		},
+		{
+			name:       "reordered entries",
+			tamper:     func(l [][]byte) [][]byte { return [][]byte{l[1], l[0], l[2]} },
+			wantLine:   1,
+			wantReason: "sequence number 2, want 1",
+		},
+		{
+			name: "rehashed entry",
+			tamper: func(l [][]byte) [][]byte {
+				e := decode(s, l[1])
+				e.Targets = []string{uuid.NewString()}
+				e.Hash, _ = hash(e)
+				l[1] = encode(s, e)
+				return l
+			},
+			wantLine:   3,
+			wantReason: "previous hash does not match",
+		},
+		{
+			name:       "incomplete line",
+			tamper:     func(l [][]byte) [][]byte { return [][]byte{l[0], l[1], l[2][:40]} },
+			wantLine:   3,
+			wantReason: "incomplete line",
+		},
+		{
+			name:       "inserted line",
+			tamper:     func(l [][]byte) [][]byte { return [][]byte{l[0], []byte("{\"seq\":2}\n"), l[1], l[2]} },
+			wantLine:   2,
+			wantReason: "previous hash does not match",
+		},
+		{
+			name: "unknown field",
+			tamper: func(l [][]byte) [][]byte {
+				l[0] = bytes.Replace(l[0], []byte(`{`), []byte(`{"admin":true,`), 1)
+				return l
+			},
+			wantLine:   1,
+			wantReason: "invalid entry",
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			path, lines := newLog(s)
+			s.NoError(os.WriteFile(path, bytes.Join(v.tamper(lines), nil), 0640))
+
+			_, _, err := VerifyFile(path)
+			ce := &ChainError{}
+			s.True(errors.As(err, &ce))
+			s.Equal(v.wantLine, ce.Line)
+			s.Equal(v.wantReason, ce.Reason)
+
+			_, err = NewFileAuditor(path)
+			s.ErrorAs(err, &ce)
+		})
+	}
+}
+
+func decode(s *auditorSuite, line []byte) model.AuditEntry {
+	e := model.AuditEntry{}
+	s.NoError(json.Unmarshal(line, &e))
+	return e
+}
+
+func encode(s *auditorSuite, e model.AuditEntry) []byte {
+	b, err := json.Marshal(e)
+	s.NoError(err)
+	return append(b, '\n')
+}
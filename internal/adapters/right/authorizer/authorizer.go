@@ -1,10 +1,400 @@
 package authorizer
 
-import "github.com/vynovikov/study/notifications_example/internal/pkg/model"
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
 
 type Authorizer interface {
-	Internal(model.WrappedReq) error
-	External(model.WrappedReq) error
+	Internal(model.WrappedReq) (model.AppIdentity, error)
+	External(model.WrappedReq) (model.AppIdentity, error)
+	User(model.WrappedReq) (model.Claims, error)
+	ClientAddr(model.WrappedReq) (netip.Addr, error)
+}
+
+// APPID -> shared secrets, remembers when app and its secret were last used
+type SecretRegistry interface {
+	Secrets(string) ([][]byte, error)
+	Touch(string, []byte, time.Time) error
+}
+
+// Remembers nonces within the allowed clock skew
+type NonceCache interface {
+	Seen(string, time.Time) bool
+}
+
+// JWKS file keys, reloaded when the file changes
+type KeySet interface {
+	Key(string) (crypto.PublicKey, error)
+	Reload() error
+}
+
+// Client certificate subject/SAN patterns -> app identity
+type IdentityMapper interface {
+	Identity(*x509.Certificate) (model.AppIdentity, error)
+}
+
+// APPID -> allowed categories, operations and users
+type ScopeRegistry interface {
+	Scope(string) (model.AppScope, error)
+}
+
+// Decides whether principal may perform operation on user's notifications
+type Policy interface {
+	Allow(model.Principal, model.Operation, uuid.UUID) error
+}
+
+// RFC 7662 token introspection with positive and negative result caching
+type Introspector interface {
+	Introspect(string) (model.TokenInfo, error)
+}
+
+// Route group CIDR allowlists and trusted proxies, Allow takes request path
+type NetworkPolicy interface {
+	ClientAddr(model.WrappedReq) (netip.Addr, error)
+	Allow(string, netip.Addr) error
 }
 
 // Authorizer implementation
+
+const (
+	HeaderAppID        = "APPID"
+	HeaderAppSignature = "APPSIGNATURE"
+	HeaderAppTimestamp = "APPTIMESTAMP"
+	HeaderAppNonce     = "APPNONCE"
+
+	DefaultSkew = 5 * time.Minute
+)
+
+// Config holds sources Authorizer checks requests against
+type Config struct {
+	Secrets SecretRegistry
+	Nonces  NonceCache
+	Keys    KeySet
+	// Identities maps verified client certificates of internal requests to apps
+	Identities IdentityMapper
+	// Scopes restrict apps, without Scopes apps are not restricted
+	Scopes ScopeRegistry
+	// Network restricts source addresses of internal requests, without Network they are not restricted
+	Network NetworkPolicy
+	// Introspector checks opaque user tokens, if set User uses it instead of Keys
+	Introspector Introspector
+	// Skew is allowed difference between request timestamp or token lifetime and server time
+	Skew time.Duration
+}
+
+type authorizer struct {
+	Config
+	now func() time.Time
+}
+
+// NewAuthorizer returns Authorizer. Missing Nonces is replaced by memory cache, missing Skew by DefaultSkew.
+func NewAuthorizer(c Config) *authorizer {
+	if c.Skew <= 0 {
+		c.Skew = DefaultSkew
+	}
+	if c.Nonces == nil {
+		c.Nonces = NewNonceCache(2 * c.Skew)
+	}
+	return &authorizer{
+		Config: c,
+		now:    time.Now,
+	}
+}
+
+// ClientAddr returns address of client, forwarding headers of trusted proxies are followed if Network is set
+func (a *authorizer) ClientAddr(wr model.WrappedReq) (netip.Addr, error) {
+	if a.Network != nil {
+		addr, err := a.Network.ClientAddr(wr)
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("in authorizer.ClientAddr %w", err)
+		}
+		return addr, nil
+	}
+	ap, err := netip.ParseAddrPort(wr.Req.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("in authorizer.ClientAddr unable to parse remote address %q: %w", wr.Req.RemoteAddr, err)
+	}
+	return ap.Addr().Unmap(), nil
+}
+
+// Internal returns identity of app whose client certificate was verified by Tps
+func (a *authorizer) Internal(wr model.WrappedReq) (model.AppIdentity, error) {
+	if wr.Req.TLS == nil || len(wr.Req.TLS.VerifiedChains) == 0 {
+		return model.AppIdentity{}, errors.New("in authorizer.Internal request has no verified client certificate")
+	}
+	if a.Network != nil {
+		addr, err := a.Network.ClientAddr(wr)
+		if err != nil {
+			return model.AppIdentity{}, fmt.Errorf("in authorizer.Internal %w", err)
+		}
+		err = a.Network.Allow(wr.Req.URL.Path, addr)
+		if err != nil {
+			return model.AppIdentity{}, fmt.Errorf("in authorizer.Internal %w", err)
+		}
+	}
+	if a.Identities == nil {
+		return model.AppIdentity{}, errors.New("in authorizer.Internal no identity mapper configured")
+	}
+	id, err := a.Identities.Identity(wr.Req.TLS.VerifiedChains[0][0])
+	if err != nil {
+		return model.AppIdentity{}, fmt.Errorf("in authorizer.Internal %w", err)
+	}
+	err = a.scope(wr, id.AppID)
+	if err != nil {
+		return id, err
+	}
+	return id, nil
+}
+
+// External checks HMAC signature of request made by app given in APPID header.
+// Timestamp must be within Skew from server time, nonce must not be used before.
+// Time of authorized request is recorded as last use of app and of secret request is signed with.
+func (a *authorizer) External(wr model.WrappedReq) (model.AppIdentity, error) {
+	h := wr.Req.Header
+	appID, sig, ts, nonce := h.Get(HeaderAppID), h.Get(HeaderAppSignature), h.Get(HeaderAppTimestamp), h.Get(HeaderAppNonce)
+	if appID == "" || sig == "" || ts == "" || nonce == "" {
+		return model.AppIdentity{}, errors.New("in authorizer.External request has empty signature headers")
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return model.AppIdentity{}, fmt.Errorf("in authorizer.External request has invalid timestamp %q", ts)
+	}
+	t, now := time.Unix(sec, 0), a.now()
+	if t.Before(now.Add(-a.Skew)) || t.After(now.Add(a.Skew)) {
+		return model.AppIdentity{}, fmt.Errorf("in authorizer.External request timestamp %s is out of allowed skew", t.UTC())
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return model.AppIdentity{}, errors.New("in authorizer.External request has invalid signature encoding")
+	}
+	secrets, err := a.Secrets.Secrets(appID)
+	if err != nil {
+		return model.AppIdentity{}, fmt.Errorf("in authorizer.External %w", err)
+	}
+	var used []byte
+	for _, v := range secrets {
+		want := mac(v, wr.Req.Method, wr.Req.URL.Path, wr.Body, ts, nonce)
+		if hmac.Equal(got, want) {
+			used = v
+		}
+	}
+	if used == nil {
+		return model.AppIdentity{}, fmt.Errorf("in authorizer.External request of app %q has wrong signature", appID)
+	}
+	if a.Nonces.Seen(appID+":"+nonce, now) {
+		return model.AppIdentity{}, fmt.Errorf("in authorizer.External request of app %q reuses nonce %q", appID, nonce)
+	}
+	id := model.AppIdentity{AppID: appID, Subject: appID}
+	err = a.scope(wr, appID)
+	if err != nil {
+		return id, err
+	}
+	err = a.Secrets.Touch(appID, used, now)
+	if err != nil {
+		return model.AppIdentity{}, fmt.Errorf("in authorizer.External %w", err)
+	}
+	return id, nil
+}
+
+// scope checks that app may perform request operation on every item of request body.
+// Denied operation wraps model.ErrForbidden, items app may not touch are returned as model.ItemAuthErrors.
+func (a *authorizer) scope(wr model.WrappedReq, appID string) error {
+	if a.Scopes == nil {
+		return nil
+	}
+	sc, err := a.Scopes.Scope(appID)
+	if err != nil {
+		return fmt.Errorf("in authorizer.scope %w", err)
+	}
+	if !sc.AllowsOperation(wr.Op) {
+		return fmt.Errorf("in authorizer.scope app %q may not perform %q: %w", appID, wr.Op, model.ErrForbidden)
+	}
+	res := model.ItemAuthErrors{}
+	switch wr.Op {
+	case model.OperationWrite:
+		items := make([]model.NotificationDataStructured, 0)
+		if json.Unmarshal(wr.Body, &items) != nil {
+			// malformed body is rejected by Application
+			return nil
+		}
+		for i, v := range items {
+			res = append(res, itemErrors(sc, i, v.UUID, v.Category, v.UserUUID)...)
+		}
+	case model.OperationBroadcast:
+		b := model.Broadcast{}
+		if json.Unmarshal(wr.Body, &b) != nil {
+			return nil
+		}
+		if !sc.AllowsCategory(b.Category) {
+			res = append(res, model.ItemAuthError{Index: 0, Reason: fmt.Sprintf("category %q is not allowed", b.Category)})
+		}
+		if b.Segment != "" && len(sc.Users) > 0 {
+			res = append(res, model.ItemAuthError{Index: 0, Reason: "segment broadcast is not allowed to app restricted by users"})
+		}
+		for i, v := range b.Users {
+			if !sc.AllowsUser(v) {
+				res = append(res, model.ItemAuthError{Index: i, UUID: v, Reason: fmt.Sprintf("user %s is not allowed", v)})
+			}
+		}
+	}
+	if len(res) > 0 {
+		return res
+	}
+	return nil
+}
+
+func itemErrors(sc model.AppScope, i int, u uuid.UUID, category string, user uuid.UUID) []model.ItemAuthError {
+	res := make([]model.ItemAuthError, 0)
+	if !sc.AllowsCategory(category) {
+		res = append(res, model.ItemAuthError{Index: i, UUID: u, Reason: fmt.Sprintf("category %q is not allowed", category)})
+	}
+	if !sc.AllowsUser(user) {
+		res = append(res, model.ItemAuthError{Index: i, UUID: u, Reason: fmt.Sprintf("user %s is not allowed", user)})
+	}
+	return res
+}
+
+// Sign returns hex encoded HMAC-SHA256 signature producers put in APPSIGNATURE header
+func Sign(secret []byte, method, path string, body []byte, timestamp, nonce string) string {
+	return hex.EncodeToString(mac(secret, method, path, body, timestamp, nonce))
+}
+
+// mac signs method, path, body hash, timestamp and nonce separated by new lines
+func mac(secret []byte, method, path string, body []byte, timestamp, nonce string) []byte {
+	bodyHash := sha256.Sum256(body)
+	m := hmac.New(sha256.New, secret)
+	fmt.Fprintf(m, "%s\n%s\n%s\n%s\n%s", method, path, hex.EncodeToString(bodyHash[:]), timestamp, nonce)
+	return m.Sum(nil)
+}
+
+// StaticSecrets is SecretRegistry with fixed secrets
+type StaticSecrets map[string][][]byte
+
+func (s StaticSecrets) Secrets(appID string) ([][]byte, error) {
+	v, ok := s[appID]
+	if !ok || len(v) == 0 {
+		return nil, fmt.Errorf("unknown app %q", appID)
+	}
+	return v, nil
+}
+
+// IdentityPattern maps certificate names matching Pattern (path.Match syntax) to AppID
+type IdentityPattern struct {
+	Pattern string
+	AppID   string
+}
+
+// PatternMapper is IdentityMapper checking subject common name, then DNS and URI SANs against patterns in order
+type PatternMapper []IdentityPattern
+
+func (p PatternMapper) Identity(c *x509.Certificate) (model.AppIdentity, error) {
+	names := make([]string, 0, 1+len(c.DNSNames)+len(c.URIs))
+	if c.Subject.CommonName != "" {
+		names = append(names, c.Subject.CommonName)
+	}
+	names = append(names, c.DNSNames...)
+	for _, v := range c.URIs {
+		names = append(names, v.String())
+	}
+	for _, v := range p {
+		for _, n := range names {
+			ok, err := path.Match(v.Pattern, n)
+			if err != nil {
+				return model.AppIdentity{}, fmt.Errorf("invalid identity pattern %q: %w", v.Pattern, err)
+			}
+			if ok {
+				return model.AppIdentity{AppID: v.AppID, Subject: n}, nil
+			}
+		}
+	}
+	return model.AppIdentity{}, fmt.Errorf("certificate %q matches no identity pattern", c.Subject.CommonName)
+}
+
+func (s StaticSecrets) Touch(string, []byte, time.Time) error {
+	return nil
+}
+
+// StaticScopes is ScopeRegistry with fixed scopes
+type StaticScopes map[string]model.AppScope
+
+func (s StaticScopes) Scope(appID string) (model.AppScope, error) {
+	v, ok := s[appID]
+	if !ok {
+		return model.AppScope{}, fmt.Errorf("app %q has no scope", appID)
+	}
+	return v, nil
+}
+
+// RolePolicy is Policy by roles: user may do anything with own notifications,
+// support may read notifications of any user, auditor may only read notifications of any user, admin may do anything
+type RolePolicy struct{}
+
+func (RolePolicy) Allow(p model.Principal, op model.Operation, u uuid.UUID) error {
+	switch {
+	case p.Has(model.RoleAdmin):
+		return nil
+	case op == model.OperationAdmin:
+	case p.Has(model.RoleAuditor):
+		if op == model.OperationRead {
+			return nil
+		}
+	case p.Subject == u.String():
+		return nil
+	case op == model.OperationRead && p.Has(model.RoleSupport):
+		return nil
+	}
+	return fmt.Errorf("%s with roles %v may not perform %q on notifications of user %s", p.Subject, p.Roles, op, u)
+}
+
+// NonceCache implementation
+
+type nonceCache struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	seen   map[string]time.Time
+	pruned time.Time
+}
+
+// NewNonceCache returns NonceCache remembering nonces for ttl
+func NewNonceCache(ttl time.Duration) *nonceCache {
+	return &nonceCache{
+		ttl:  ttl,
+		seen: make(map[string]time.Time),
+	}
+}
+
+// Seen reports whether nonce was seen within ttl before t and remembers it
+func (n *nonceCache) Seen(nonce string, t time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if t.Sub(n.pruned) > n.ttl {
+		for i, v := range n.seen {
+			if t.Sub(v) > n.ttl {
+				delete(n.seen, i)
+			}
+		}
+		n.pruned = t
+	}
+	v, ok := n.seen[nonce]
+	if ok && t.Sub(v) <= n.ttl {
+		return true
+	}
+	n.seen[nonce] = t
+	return false
+}
@@ -0,0 +1,274 @@
+package authorizer
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	"github.com/vynovikov/study/notifications_example/internal/adapters/right/credentials"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+type authorizerSuite struct {
+	suite.Suite
+}
+
+func TestAuthorizerSuite(t *testing.T) {
+	suite.Run(t, new(authorizerSuite))
+}
+
+var testNow = time.Date(2022, 10, 2, 12, 0, 0, 0, time.UTC)
+
+func newTestAuthorizer() *authorizer {
+	a := NewAuthorizer(Config{
+		Secrets: StaticSecrets{
+			"crm":    {[]byte("crm-secret")},
+			"mailer": {[]byte("old-secret"), []byte("new-secret")},
+		},
+	})
+	a.now = func() time.Time { return testNow }
+	return a
+}
+
+func signed(appID string, secret []byte, body string, t time.Time, nonce string) model.WrappedReq {
+	req := httptest.NewRequest("PUT", "/api/v1/notifications/batch", nil)
+	ts := strconv.FormatInt(t.Unix(), 10)
+	req.Header.Set(HeaderAppID, appID)
+	req.Header.Set(HeaderAppTimestamp, ts)
+	req.Header.Set(HeaderAppNonce, nonce)
+	req.Header.Set(HeaderAppSignature, Sign(secret, req.Method, req.URL.Path, []byte(body), ts, nonce))
+	return model.WrappedReq{UUID: uuid.New(), Req: req, Body: []byte(body)}
+}
+
+func (s *authorizerSuite) TestExternal() {
+	body := `[{"user_uuid":"2593ede0-2301-4480-a452-752f03dcfab0"}]`
+
+	tampered := signed("crm", []byte("crm-secret"), body, testNow, "n-4")
+	tampered.Body = []byte(`[]`)
+
+	noHeaders := signed("crm", []byte("crm-secret"), body, testNow, "n-5")
+	noHeaders.Req.Header.Del(HeaderAppNonce)
+
+	tt := []struct {
+		name    string
+		wr      model.WrappedReq
+		wantApp string
+		wantErr bool
+	}{
+		{
+			name:    "good",
+			wr:      signed("crm", []byte("crm-secret"), body, testNow, "n-1"),
+			wantApp: "crm",
+		},
+		{
+			name:    "second active secret",
+			wr:      signed("mailer", []byte("new-secret"), body, testNow, "n-1"),
+			wantApp: "mailer",
+		},
+		{
+			name:    "within skew",
+			wr:      signed("crm", []byte("crm-secret"), body, testNow.Add(-4*time.Minute), "n-2"),
+			wantApp: "crm",
+		},
+		{
+			name:    "bad secret",
+			wr:      signed("crm", []byte("wrong"), body, testNow, "n-3"),
+			wantErr: true,
+		},
+		{
+			name:    "unknown app",
+			wr:      signed("shop", []byte("crm-secret"), body, testNow, "n-3"),
+			wantErr: true,
+		},
+		{
+			name:    "tampered body",
+			wr:      tampered,
+			wantErr: true,
+		},
+		{
+			name:    "missing nonce",
+			wr:      noHeaders,
+			wantErr: true,
+		},
+		{
+			name:    "stale",
+			wr:      signed("crm", []byte("crm-secret"), body, testNow.Add(-6*time.Minute), "n-6"),
+			wantErr: true,
+		},
+		{
+			name:    "from future",
+			wr:      signed("crm", []byte("crm-secret"), body, testNow.Add(6*time.Minute), "n-7"),
+			wantErr: true,
+		},
+		{
+			name:    "replayed",
+			wr:      signed("crm", []byte("crm-secret"), body, testNow, "n-1"),
+			wantErr: true,
+		},
+	}
+	a := newTestAuthorizer()
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			id, err := a.External(v.wr)
+			if v.wantErr {
+				s.Error(err)
+				return
+			}
+			s.NoError(err)
+			s.Equal(v.wantApp, id.AppID)
+		})
+	}
+}
+
+func (s *authorizerSuite) TestNonceCache() {
+	n := NewNonceCache(time.Minute)
+
+	s.False(n.Seen("a", testNow))
+	s.True(n.Seen("a", testNow.Add(30*time.Second)))
+	s.False(n.Seen("b", testNow.Add(30*time.Second)))
+	s.False(n.Seen("a", testNow.Add(2*time.Minute)))
+	s.Len(n.seen, 1)
+}
+
+func (s *authorizerSuite) TestScope() {
+	u1 := uuid.MustParse("2593ede0-2301-4480-a452-752f03dcfab0")
+	u2 := uuid.MustParse("f593ede0-2301-4480-a452-752f03dcfab0")
+
+	a := newTestAuthorizer()
+	a.Scopes = StaticScopes{
+		"crm": {
+			Categories: []string{"new_rank", "invite"},
+			Operations: []model.Operation{model.OperationWrite, model.OperationBroadcast},
+			Users:      []model.UserRange{{From: uuid.MustParse("00000000-0000-0000-0000-000000000000"), To: uuid.MustParse("7fffffff-ffff-ffff-ffff-ffffffffffff")}},
+		},
+		"mailer": {
+			Operations: []model.Operation{model.OperationWrite},
+		},
+	}
+	item := func(u uuid.UUID, category string) string {
+		return `{"user_uuid":"` + u.String() + `","uuid":"75359b90-a0de-4e50-bbcf-ba400d17033f","category":"` + category + `"}`
+	}
+
+	tt := []struct {
+		name      string
+		app       string
+		op        model.Operation
+		body      string
+		wantItems []int
+		wantErr   bool
+	}{
+		{
+			name: "allowed batch",
+			app:  "crm",
+			op:   model.OperationWrite,
+			body: "[" + item(u1, "new_rank") + "," + item(u1, "invite") + "]",
+		},
+		{
+			name:      "category of second item denied",
+			app:       "crm",
+			op:        model.OperationWrite,
+			body:      "[" + item(u1, "new_rank") + "," + item(u1, "billing") + "]",
+			wantItems: []int{1},
+			wantErr:   true,
+		},
+		{
+			name:      "user out of range",
+			app:       "crm",
+			op:        model.OperationWrite,
+			body:      "[" + item(u2, "new_rank") + "," + item(u1, "new_rank") + "]",
+			wantItems: []int{0},
+			wantErr:   true,
+		},
+		{
+			name: "unrestricted categories and users",
+			app:  "mailer",
+			op:   model.OperationWrite,
+			body: "[" + item(u2, "billing") + "]",
+		},
+		{
+			name:    "operation denied",
+			app:     "mailer",
+			op:      model.OperationBroadcast,
+			body:    `{"users":["` + u1.String() + `"],"category":"news"}`,
+			wantErr: true,
+		},
+		{
+			name:      "broadcast to user out of range",
+			app:       "crm",
+			op:        model.OperationBroadcast,
+			body:      `{"users":["` + u1.String() + `","` + u2.String() + `"],"category":"invite"}`,
+			wantItems: []int{1},
+			wantErr:   true,
+		},
+		{
+			name:      "segment broadcast by app restricted by users",
+			app:       "crm",
+			op:        model.OperationBroadcast,
+			body:      `{"segment":"beta","category":"invite"}`,
+			wantItems: []int{0},
+			wantErr:   true,
+		},
+	}
+	for i, v := range tt {
+		s.Run(v.name, func() {
+			secret := []byte("crm-secret")
+			if v.app == "mailer" {
+				secret = []byte("new-secret")
+			}
+			wr := signed(v.app, secret, v.body, testNow, "scope-"+strconv.Itoa(i))
+			wr.Op = v.op
+
+			_, err := a.External(wr)
+			if !v.wantErr {
+				s.NoError(err)
+				return
+			}
+			s.ErrorIs(err, model.ErrForbidden)
+			items := model.ItemAuthErrors{}
+			if len(v.wantItems) == 0 {
+				s.False(errors.As(err, &items))
+				return
+			}
+			s.True(errors.As(err, &items))
+			got := make([]int, 0, len(items))
+			for _, w := range items {
+				got = append(got, w.Index)
+			}
+			s.Equal(v.wantItems, got)
+		})
+	}
+}
+
+func (s *authorizerSuite) TestExternalTouchesCredentials() {
+	c := credentials.NewMemCredentials()
+	_, err := c.Create(model.App{ID: "crm", Scope: model.AppScope{Operations: []model.Operation{model.OperationWrite}}})
+	s.NoError(err)
+	sec, err := c.Issue("crm")
+	s.NoError(err)
+
+	a := NewAuthorizer(Config{Secrets: c, Scopes: c})
+	a.now = func() time.Time { return testNow }
+
+	_, err = a.External(signed("crm", []byte(sec.Secret), `[]`, testNow, "touch-1"))
+	s.Error(err)
+	app, err := c.App("crm")
+	s.NoError(err)
+	s.True(app.LastUsedAt.IsZero())
+
+	wr := signed("crm", []byte(sec.Secret), `[]`, testNow, "touch-2")
+	wr.Op = model.OperationWrite
+	_, err = a.External(wr)
+	s.NoError(err)
+	app, err = c.App("crm")
+	s.NoError(err)
+	s.Equal(testNow, app.LastUsedAt)
+	s.Equal(testNow, app.Secrets[0].LastUsedAt)
+
+	s.NoError(c.Revoke("crm"))
+	_, err = a.External(signed("crm", []byte(sec.Secret), `[]`, testNow, "touch-3"))
+	s.Error(err)
+}
@@ -0,0 +1,86 @@
+package authorizer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+func withCert(c *x509.Certificate, verified bool) model.WrappedReq {
+	req := httptest.NewRequest("PUT", "https://localhost/api/v1/notifications/batch", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{c}}
+	if verified {
+		req.TLS.VerifiedChains = [][]*x509.Certificate{{c}}
+	}
+	return model.WrappedReq{UUID: uuid.New(), Req: req}
+}
+
+func (s *authorizerSuite) TestInternal() {
+	spiffe, _ := url.Parse("spiffe://corp/billing")
+	a := newTestAuthorizer()
+	a.Identities = PatternMapper{
+		{Pattern: "crm.internal", AppID: "crm"},
+		{Pattern: "*.mailer.internal", AppID: "mailer"},
+		{Pattern: "spiffe://corp/*", AppID: "corp"},
+	}
+	noTLS := withCert(&x509.Certificate{}, false)
+	noTLS.Req.TLS = nil
+
+	tt := []struct {
+		name        string
+		wr          model.WrappedReq
+		wantApp     string
+		wantSubject string
+		wantErr     bool
+	}{
+		{
+			name:        "common name",
+			wr:          withCert(&x509.Certificate{Subject: pkix.Name{CommonName: "crm.internal"}}, true),
+			wantApp:     "crm",
+			wantSubject: "crm.internal",
+		},
+		{
+			name:        "DNS SAN",
+			wr:          withCert(&x509.Certificate{Subject: pkix.Name{CommonName: "worker"}, DNSNames: []string{"eu.mailer.internal"}}, true),
+			wantApp:     "mailer",
+			wantSubject: "eu.mailer.internal",
+		},
+		{
+			name:        "URI SAN",
+			wr:          withCert(&x509.Certificate{URIs: []*url.URL{spiffe}}, true),
+			wantApp:     "corp",
+			wantSubject: "spiffe://corp/billing",
+		},
+		{
+			name:    "no pattern matches",
+			wr:      withCert(&x509.Certificate{Subject: pkix.Name{CommonName: "shop.internal"}}, true),
+			wantErr: true,
+		},
+		{
+			name:    "certificate not verified",
+			wr:      withCert(&x509.Certificate{Subject: pkix.Name{CommonName: "crm.internal"}}, false),
+			wantErr: true,
+		},
+		{
+			name:    "no TLS",
+			wr:      noTLS,
+			wantErr: true,
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			id, err := a.Internal(v.wr)
+			if v.wantErr {
+				s.Error(err)
+				return
+			}
+			s.NoError(err)
+			s.Equal(model.AppIdentity{AppID: v.wantApp, Subject: v.wantSubject}, id)
+		})
+	}
+}
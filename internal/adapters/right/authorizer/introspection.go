@@ -0,0 +1,165 @@
+package authorizer
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+// Introspector implementation
+
+const (
+	DefaultNegativeTTL = 30 * time.Second
+	DefaultMaxTTL      = 5 * time.Minute
+
+	// maxCached is number of cached results after which expired ones are pruned
+	maxCached = 10000
+)
+
+var (
+	ErrInactiveToken       = errors.New("token is not active")
+	ErrProviderUnavailable = errors.New("introspection provider is unavailable")
+)
+
+// IntrospectionConfig holds RFC 7662 endpoint and credentials of the service at identity provider
+type IntrospectionConfig struct {
+	URL          string
+	ClientID     string
+	ClientSecret string
+	// Client is used for requests to URL, http.Client with 5s timeout if not set
+	Client *http.Client
+	// NegativeTTL is how long inactive result is cached, DefaultNegativeTTL if not set
+	NegativeTTL time.Duration
+	// MaxTTL limits caching of active result which expires later, DefaultMaxTTL if not set
+	MaxTTL time.Duration
+}
+
+type cachedToken struct {
+	info    model.TokenInfo
+	expires time.Time
+}
+
+type introspector struct {
+	IntrospectionConfig
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]cachedToken
+	now   func() time.Time
+}
+
+// NewIntrospector returns Introspector caching active results until they expire, but no longer than MaxTTL,
+// and inactive results for NegativeTTL. Failures of provider are not cached, so while provider is down
+// only tokens with cached result are answered.
+func NewIntrospector(c IntrospectionConfig) *introspector {
+	if c.Client == nil {
+		c.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+	if c.NegativeTTL <= 0 {
+		c.NegativeTTL = DefaultNegativeTTL
+	}
+	if c.MaxTTL <= 0 {
+		c.MaxTTL = DefaultMaxTTL
+	}
+	return &introspector{
+		IntrospectionConfig: c,
+		cache:               make(map[[sha256.Size]byte]cachedToken),
+		now:                 time.Now,
+	}
+}
+
+// Introspect returns cached or freshly requested information about token
+func (i *introspector) Introspect(token string) (model.TokenInfo, error) {
+	key := sha256.Sum256([]byte(token))
+	now := i.now()
+
+	i.mu.Lock()
+	c, ok := i.cache[key]
+	i.mu.Unlock()
+	if ok && now.Before(c.expires) {
+		return c.info, nil
+	}
+
+	info, err := i.request(token)
+	if err != nil {
+		return model.TokenInfo{}, err
+	}
+	if info.Active && info.ExpiresAt != 0 && !now.Before(time.Unix(info.ExpiresAt, 0)) {
+		info = model.TokenInfo{}
+	}
+
+	expires := now.Add(i.NegativeTTL)
+	if info.Active {
+		expires = now.Add(i.MaxTTL)
+		if info.ExpiresAt != 0 && time.Unix(info.ExpiresAt, 0).Before(expires) {
+			expires = time.Unix(info.ExpiresAt, 0)
+		}
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if len(i.cache) >= maxCached {
+		for j, v := range i.cache {
+			if !now.Before(v.expires) {
+				delete(i.cache, j)
+			}
+		}
+	}
+	i.cache[key] = cachedToken{info: info, expires: expires}
+	return info, nil
+}
+
+func (i *introspector) request(token string) (model.TokenInfo, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequest(http.MethodPost, i.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return model.TokenInfo{}, fmt.Errorf("unable to create introspection request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(i.ClientID), url.QueryEscape(i.ClientSecret))
+	}
+
+	res, err := i.Client.Do(req)
+	if err != nil {
+		return model.TokenInfo{}, fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, res.Body)
+		return model.TokenInfo{}, fmt.Errorf("%w: status %d", ErrProviderUnavailable, res.StatusCode)
+	}
+	info := model.TokenInfo{}
+	err = json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&info)
+	if err != nil {
+		return model.TokenInfo{}, fmt.Errorf("%w: malformed response: %v", ErrProviderUnavailable, err)
+	}
+	return info, nil
+}
+
+// introspected returns claims of opaque token checked by Introspector
+func (a *authorizer) introspected(token string) (model.Claims, error) {
+	info, err := a.Introspector.Introspect(token)
+	if err != nil {
+		return model.Claims{}, fmt.Errorf("in authorizer.User %w", err)
+	}
+	if !info.Active {
+		return model.Claims{}, fmt.Errorf("in authorizer.User %w", ErrInactiveToken)
+	}
+	if info.Subject == "" {
+		return model.Claims{}, errors.New("in authorizer.User token has empty subject")
+	}
+	c := model.Claims{Subject: info.Subject, Roles: info.Roles}
+	if info.ExpiresAt != 0 {
+		c.ExpiresAt = time.Unix(info.ExpiresAt, 0)
+	}
+	return c, nil
+}
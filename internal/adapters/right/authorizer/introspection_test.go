@@ -0,0 +1,139 @@
+package authorizer
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+type introspectionServer struct {
+	mu     sync.Mutex
+	calls  map[string]int
+	tokens map[string]model.TokenInfo
+	down   bool
+}
+
+func (i *introspectionServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	id, secret, ok := req.BasicAuth()
+	if !ok || id != "notifications" || secret != "s3cret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	token := req.PostFormValue("token")
+	i.calls[token]++
+	if i.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	json.NewEncoder(w).Encode(i.tokens[token])
+}
+
+func (i *introspectionServer) called(token string) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.calls[token]
+}
+
+func (i *introspectionServer) setDown(down bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.down = down
+}
+
+func (s *authorizerSuite) TestIntrospector() {
+	is := &introspectionServer{
+		calls: make(map[string]int),
+		tokens: map[string]model.TokenInfo{
+			"good":    {Active: true, Subject: subject, Roles: []model.Role{model.RoleUser}, ExpiresAt: testNow.Add(time.Hour).Unix()},
+			"short":   {Active: true, Subject: subject, ExpiresAt: testNow.Add(12 * time.Minute).Unix()},
+			"stale":   {Active: true, Subject: subject, ExpiresAt: testNow.Add(-time.Minute).Unix()},
+			"revoked": {Active: false},
+		},
+	}
+	srv := httptest.NewServer(is)
+	defer srv.Close()
+
+	clock := testNow
+	i := NewIntrospector(IntrospectionConfig{URL: srv.URL, ClientID: "notifications", ClientSecret: "s3cret", NegativeTTL: 30 * time.Second, MaxTTL: 10 * time.Minute})
+	i.now = func() time.Time { return clock }
+
+	tt := []struct {
+		name       string
+		token      string
+		after      time.Duration
+		down       bool
+		wantActive bool
+		wantCalls  int
+		wantErr    error
+	}{
+		{name: "active", token: "good", wantActive: true, wantCalls: 1},
+		{name: "active cached", token: "good", after: 5 * time.Minute, wantActive: true, wantCalls: 1},
+		{name: "active cached no longer than max ttl", token: "good", after: 6 * time.Minute, wantActive: true, wantCalls: 2},
+		{name: "inactive", token: "revoked", wantCalls: 1},
+		{name: "inactive cached", token: "revoked", after: 20 * time.Second, wantCalls: 1},
+		{name: "inactive cached for negative ttl", token: "revoked", after: 20 * time.Second, wantCalls: 2},
+		{name: "expired", token: "stale", wantCalls: 1},
+		{name: "short", token: "short", wantActive: true, wantCalls: 1},
+		{name: "provider down, cached active", token: "good", down: true, wantActive: true, wantCalls: 2},
+		{name: "provider down, not cached", token: "unknown", down: true, wantCalls: 1, wantErr: ErrProviderUnavailable},
+		{name: "provider down is not cached", token: "unknown", down: true, wantCalls: 2, wantErr: ErrProviderUnavailable},
+		{name: "provider down, active cached until exp", token: "short", after: 20 * time.Second, down: true, wantCalls: 2, wantErr: ErrProviderUnavailable},
+		{name: "provider back", token: "unknown", wantCalls: 3},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			clock = clock.Add(v.after)
+			is.setDown(v.down)
+
+			info, err := i.Introspect(v.token)
+			s.Equal(v.wantCalls, is.called(v.token))
+			if v.wantErr != nil {
+				s.True(errors.Is(err, v.wantErr))
+				return
+			}
+			s.NoError(err)
+			s.Equal(v.wantActive, info.Active)
+		})
+	}
+
+	bad := NewIntrospector(IntrospectionConfig{URL: srv.URL, ClientID: "notifications", ClientSecret: "wrong"})
+	_, err := bad.Introspect("good")
+	s.True(errors.Is(err, ErrProviderUnavailable))
+}
+
+func (s *authorizerSuite) TestUserIntrospected() {
+	is := &introspectionServer{
+		calls: make(map[string]int),
+		tokens: map[string]model.TokenInfo{
+			"good":       {Active: true, Subject: subject, Roles: []model.Role{model.RoleSupport}, ExpiresAt: time.Now().Add(time.Hour).Unix()},
+			"revoked":    {Active: false},
+			"no subject": {Active: true},
+		},
+	}
+	srv := httptest.NewServer(is)
+	defer srv.Close()
+
+	a := NewAuthorizer(Config{Introspector: NewIntrospector(IntrospectionConfig{URL: srv.URL, ClientID: "notifications", ClientSecret: "s3cret"})})
+
+	c, err := a.User(bearer("good"))
+	s.NoError(err)
+	s.Equal(subject, c.Subject)
+	s.Equal([]model.Role{model.RoleSupport}, c.Roles)
+
+	_, err = a.User(bearer("revoked"))
+	s.True(errors.Is(err, ErrInactiveToken))
+
+	_, err = a.User(bearer("no subject"))
+	s.Error(err)
+
+	is.setDown(true)
+	_, err = a.User(bearer("other"))
+	s.True(errors.Is(err, ErrProviderUnavailable))
+}
@@ -0,0 +1,247 @@
+package authorizer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+// User verifies RS256 or ES256 JWT from Authorization header and returns its claims.
+// Opaque tokens are checked by Introspector when it is configured.
+func (a *authorizer) User(wr model.WrappedReq) (model.Claims, error) {
+	token, ok := strings.CutPrefix(wr.Req.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return model.Claims{}, errors.New("in authorizer.User request has no bearer token")
+	}
+	if a.Introspector != nil {
+		return a.introspected(token)
+	}
+	if a.Keys == nil {
+		return model.Claims{}, errors.New("in authorizer.User no key set configured")
+	}
+	c, err := verifyJWT(token, a.Keys, a.now(), a.Skew)
+	if err != nil {
+		return model.Claims{}, fmt.Errorf("in authorizer.User %w", err)
+	}
+	return c, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Sub   string       `json:"sub"`
+	Exp   int64        `json:"exp"`
+	Nbf   int64        `json:"nbf"`
+	Roles []model.Role `json:"roles"`
+}
+
+// verifyJWT checks signature, exp and nbf of compact JWS token, leeway is allowed clock difference
+func verifyJWT(token string, keys KeySet, now time.Time, leeway time.Duration) (model.Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return model.Claims{}, errors.New("malformed token")
+	}
+	h := jwtHeader{}
+	err := decodeSegment(parts[0], &h)
+	if err != nil {
+		return model.Claims{}, fmt.Errorf("malformed token header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return model.Claims{}, fmt.Errorf("malformed token signature: %w", err)
+	}
+	key, err := keys.Key(h.Kid)
+	if err != nil {
+		return model.Claims{}, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	switch h.Alg {
+	case "RS256":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return model.Claims{}, fmt.Errorf("key %q is not RSA key", h.Kid)
+		}
+		err = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig)
+		if err != nil {
+			return model.Claims{}, errors.New("wrong token signature")
+		}
+	case "ES256":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok || k.Curve != elliptic.P256() {
+			return model.Claims{}, fmt.Errorf("key %q is not P-256 key", h.Kid)
+		}
+		if len(sig) != 64 {
+			return model.Claims{}, errors.New("wrong token signature")
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(k, digest[:], r, s) {
+			return model.Claims{}, errors.New("wrong token signature")
+		}
+	default:
+		return model.Claims{}, fmt.Errorf("unsupported token algorithm %q", h.Alg)
+	}
+
+	c := jwtClaims{}
+	err = decodeSegment(parts[1], &c)
+	if err != nil {
+		return model.Claims{}, fmt.Errorf("malformed token claims: %w", err)
+	}
+	if c.Sub == "" {
+		return model.Claims{}, errors.New("token has empty subject")
+	}
+	if c.Exp == 0 || now.After(time.Unix(c.Exp, 0).Add(leeway)) {
+		return model.Claims{}, errors.New("token is expired")
+	}
+	if c.Nbf != 0 && now.Before(time.Unix(c.Nbf, 0).Add(-leeway)) {
+		return model.Claims{}, errors.New("token is not valid yet")
+	}
+	return model.Claims{
+		Subject:   c.Sub,
+		Roles:     c.Roles,
+		ExpiresAt: time.Unix(c.Exp, 0),
+	}, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// KeySet implementation
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwksFile struct {
+	mu      sync.RWMutex
+	path    string
+	modTime time.Time
+	keys    map[string]crypto.PublicKey
+}
+
+// NewJWKSFile returns KeySet reading JWKS from file at path.
+// File is read again when its modification time changes.
+func NewJWKSFile(path string) (*jwksFile, error) {
+	k := &jwksFile{path: path}
+	err := k.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Key returns public key by its kid, reloading file if it has changed
+func (k *jwksFile) Key(kid string) (crypto.PublicKey, error) {
+	fi, err := os.Stat(k.path)
+	if err == nil {
+		k.mu.RLock()
+		changed := !fi.ModTime().Equal(k.modTime)
+		k.mu.RUnlock()
+		if changed {
+			err = k.Reload()
+		}
+	}
+	if err != nil {
+		// keeping keys read before
+		err = fmt.Errorf("in authorizer.Key unable to reload %s: %w", k.path, err)
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, errors.Join(fmt.Errorf("unknown key %q", kid), err)
+	}
+	return key, nil
+}
+
+// Reload reads file, keys are replaced only if whole file is valid
+func (k *jwksFile) Reload() error {
+	fi, err := os.Stat(k.path)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(k.path)
+	if err != nil {
+		return err
+	}
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	err = json.Unmarshal(b, &set)
+	if err != nil {
+		return fmt.Errorf("in authorizer.Reload unable to parse %s: %w", k.path, err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, v := range set.Keys {
+		key, err := v.publicKey()
+		if err != nil {
+			return fmt.Errorf("in authorizer.Reload key %q: %w", v.Kid, err)
+		}
+		keys[v.Kid] = key
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+	k.modTime = fi.ModTime()
+	return nil
+}
+
+func (j jwk) publicKey() (crypto.PublicKey, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if j.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		k := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !k.Curve.IsOnCurve(k.X, k.Y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return k, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+}
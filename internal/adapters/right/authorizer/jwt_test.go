@@ -0,0 +1,180 @@
+package authorizer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+const subject = "2593ede0-2301-4480-a452-752f03dcfab0"
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func token(alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	h, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	c, _ := json.Marshal(claims)
+	signing := b64(h) + "." + b64(c)
+	digest := sha256.Sum256([]byte(signing))
+
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, _ := ecdsa.Sign(rand.Reader, k, digest[:])
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signing + "." + b64(sig)
+}
+
+func rsaJWK(kid string, k *rsa.PublicKey) map[string]string {
+	return map[string]string{"kty": "RSA", "kid": kid, "n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes())}
+}
+
+func ecJWK(kid string, k *ecdsa.PublicKey) map[string]string {
+	return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(k.X.FillBytes(make([]byte, 32))), "y": b64(k.Y.FillBytes(make([]byte, 32)))}
+}
+
+func writeJWKS(path string, keys ...map[string]string) error {
+	b, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	return os.WriteFile(path, b, 0644)
+}
+
+func bearer(t string) model.WrappedReq {
+	req := httptest.NewRequest("GET", "/api/v1/notifications?user_uuid="+subject, nil)
+	req.Header.Set("Authorization", "Bearer "+t)
+	return model.WrappedReq{UUID: uuid.New(), Req: req}
+}
+
+func (s *authorizerSuite) TestUser() {
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	s.NoError(err)
+	ek, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.NoError(err)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	s.NoError(err)
+
+	path := filepath.Join(s.T().TempDir(), "jwks.json")
+	s.NoError(writeJWKS(path, rsaJWK("rsa-1", &rk.PublicKey), ecJWK("ec-1", &ek.PublicKey)))
+	keys, err := NewJWKSFile(path)
+	s.NoError(err)
+
+	a := newTestAuthorizer()
+	a.Keys = keys
+
+	valid := map[string]interface{}{"sub": subject, "exp": testNow.Add(time.Hour).Unix(), "roles": []string{"support"}}
+	noBearer := bearer("")
+	noBearer.Req.Header.Del("Authorization")
+
+	tt := []struct {
+		name    string
+		wr      model.WrappedReq
+		wantErr bool
+	}{
+		{
+			name: "RS256",
+			wr:   bearer(token("RS256", "rsa-1", rk, valid)),
+		},
+		{
+			name: "ES256",
+			wr:   bearer(token("ES256", "ec-1", ek, valid)),
+		},
+		{
+			name:    "no token",
+			wr:      noBearer,
+			wantErr: true,
+		},
+		{
+			name:    "wrong key",
+			wr:      bearer(token("RS256", "rsa-1", other, valid)),
+			wantErr: true,
+		},
+		{
+			name:    "unknown kid",
+			wr:      bearer(token("RS256", "rsa-2", rk, valid)),
+			wantErr: true,
+		},
+		{
+			name:    "algorithm mismatch",
+			wr:      bearer(token("ES256", "rsa-1", ek, valid)),
+			wantErr: true,
+		},
+		{
+			name:    "expired",
+			wr:      bearer(token("RS256", "rsa-1", rk, map[string]interface{}{"sub": subject, "exp": testNow.Add(-time.Hour).Unix()})),
+			wantErr: true,
+		},
+		{
+			name:    "not valid yet",
+			wr:      bearer(token("RS256", "rsa-1", rk, map[string]interface{}{"sub": subject, "exp": testNow.Add(2 * time.Hour).Unix(), "nbf": testNow.Add(time.Hour).Unix()})),
+			wantErr: true,
+		},
+		{
+			name:    "empty subject",
+			wr:      bearer(token("RS256", "rsa-1", rk, map[string]interface{}{"exp": testNow.Add(time.Hour).Unix()})),
+			wantErr: true,
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			c, err := a.User(v.wr)
+			if v.wantErr {
+				s.Error(err)
+				return
+			}
+			s.NoError(err)
+			s.Equal(subject, c.Subject)
+			s.Equal([]model.Role{model.RoleSupport}, c.Roles)
+		})
+	}
+}
+
+func (s *authorizerSuite) TestJWKSReload() {
+	k1, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.NoError(err)
+	k2, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.NoError(err)
+
+	path := filepath.Join(s.T().TempDir(), "jwks.json")
+	s.NoError(writeJWKS(path, ecJWK("k1", &k1.PublicKey)))
+	keys, err := NewJWKSFile(path)
+	s.NoError(err)
+	a := newTestAuthorizer()
+	a.Keys = keys
+
+	claims := map[string]interface{}{"sub": subject, "exp": testNow.Add(time.Hour).Unix()}
+	_, err = a.User(bearer(token("ES256", "k2", k2, claims)))
+	s.Error(err)
+
+	// key rotated: k1 removed, k2 added
+	s.NoError(writeJWKS(path, ecJWK("k2", &k2.PublicKey)))
+	s.NoError(os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+
+	_, err = a.User(bearer(token("ES256", "k2", k2, claims)))
+	s.NoError(err)
+	_, err = a.User(bearer(token("ES256", "k1", k1, claims)))
+	s.Error(err)
+
+	// broken file keeps keys read before
+	s.NoError(os.WriteFile(path, []byte("{"), 0644))
+	s.NoError(os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second)))
+	_, err = a.User(bearer(token("ES256", "k2", k2, claims)))
+	s.NoError(err)
+}
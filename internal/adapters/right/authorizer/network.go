@@ -0,0 +1,138 @@
+package authorizer
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+// NetworkPolicy implementation
+
+// ErrNetworkDenied is returned when client address is outside networks of route group
+var ErrNetworkDenied = errors.New("client network is not allowed")
+
+// RouteGroup allows requests with path starting with Prefix only from Networks
+type RouteGroup struct {
+	Name     string
+	Prefix   string
+	Networks []netip.Prefix
+}
+
+// NetworkConfig holds allowlists of route groups and proxies whose forwarding headers are trusted
+type NetworkConfig struct {
+	Groups         []RouteGroup
+	TrustedProxies []netip.Prefix
+}
+
+type networkPolicy struct {
+	NetworkConfig
+}
+
+// NewNetworkPolicy returns NetworkPolicy. Paths not covered by any group are not restricted.
+func NewNetworkPolicy(c NetworkConfig) *networkPolicy {
+	return &networkPolicy{NetworkConfig: c}
+}
+
+// ClientAddr returns address of client. Forwarded or X-Forwarded-For headers are followed from the right
+// only while the hop they come from is a trusted proxy, so client cannot spoof its address.
+// Hop hidden by proxy (for=unknown or obfuscated identifier) is not trusted, client address is then invalid netip.Addr.
+func (n *networkPolicy) ClientAddr(wr model.WrappedReq) (netip.Addr, error) {
+	ap, err := netip.ParseAddrPort(wr.Req.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("unable to parse remote address %q: %w", wr.Req.RemoteAddr, err)
+	}
+	addr := ap.Addr().Unmap()
+	if !n.trusted(addr) {
+		return addr, nil
+	}
+
+	var hops []string
+	if v := wr.Req.Header.Values("Forwarded"); len(v) > 0 {
+		hops = forwardedFor(v)
+	} else {
+		for _, w := range wr.Req.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(w, ",")...)
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := parseHop(hops[i])
+		if err != nil {
+			return netip.Addr{}, err
+		}
+		addr = hop
+		if !addr.IsValid() || !n.trusted(addr) {
+			break
+		}
+	}
+	return addr, nil
+}
+
+// Allow returns ErrNetworkDenied if addr is outside networks of the group path belongs to.
+// The group with the longest matching prefix is used.
+func (n *networkPolicy) Allow(path string, addr netip.Addr) error {
+	g, ok := n.group(path)
+	if !ok {
+		return nil
+	}
+	for _, v := range g.Networks {
+		if v.Contains(addr) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s to route group %q", ErrNetworkDenied, addr, g.Name)
+}
+
+func (n *networkPolicy) group(path string) (RouteGroup, bool) {
+	found, ok := RouteGroup{}, false
+	for _, v := range n.Groups {
+		if strings.HasPrefix(path, v.Prefix) && (!ok || len(v.Prefix) > len(found.Prefix)) {
+			found, ok = v, true
+		}
+	}
+	return found, ok
+}
+
+func (n *networkPolicy) trusted(addr netip.Addr) bool {
+	for _, v := range n.TrustedProxies {
+		if v.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns for= parameters of RFC 7239 Forwarded header values in order
+func forwardedFor(values []string) []string {
+	res := make([]string, 0)
+	for _, v := range values {
+		for _, elem := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				k, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(k, "for") {
+					res = append(res, strings.Trim(val, `"`))
+				}
+			}
+		}
+	}
+	return res
+}
+
+// parseHop parses address of hop which may have port and brackets around IPv6.
+// Unknown and obfuscated (RFC 7239 section 6) hops are returned as invalid netip.Addr.
+func parseHop(s string) (netip.Addr, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "unknown") || strings.HasPrefix(s, "_") {
+		return netip.Addr{}, nil
+	}
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap.Addr().Unmap(), nil
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("unable to parse forwarded address %q", s)
+	}
+	return addr.Unmap(), nil
+}
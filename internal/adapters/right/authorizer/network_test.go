@@ -0,0 +1,191 @@
+package authorizer
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http/httptest"
+	"net/netip"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+func fromAddr(remote string, header ...string) model.WrappedReq {
+	req := httptest.NewRequest("PUT", "https://localhost/api/v1/notifications/batch", nil)
+	req.RemoteAddr = remote
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Add(header[i], header[i+1])
+	}
+	return model.WrappedReq{UUID: uuid.New(), Req: req}
+}
+
+func (s *authorizerSuite) TestClientAddr() {
+	n := NewNetworkPolicy(NetworkConfig{
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24"), netip.MustParsePrefix("fd00::/8")},
+	})
+
+	tt := []struct {
+		name     string
+		wr       model.WrappedReq
+		wantAddr string
+		wantErr  bool
+	}{
+		{
+			name:     "direct",
+			wr:       fromAddr("192.0.2.10:4000"),
+			wantAddr: "192.0.2.10",
+		},
+		{
+			name:     "direct client headers are ignored",
+			wr:       fromAddr("192.0.2.10:4000", "X-Forwarded-For", "10.0.0.9"),
+			wantAddr: "192.0.2.10",
+		},
+		{
+			name:     "X-Forwarded-For through trusted proxy",
+			wr:       fromAddr("10.0.0.1:4000", "X-Forwarded-For", "192.0.2.10"),
+			wantAddr: "192.0.2.10",
+		},
+		{
+			name:     "spoofed leftmost X-Forwarded-For",
+			wr:       fromAddr("10.0.0.1:4000", "X-Forwarded-For", "10.0.0.9, 198.51.100.7, 10.0.0.2"),
+			wantAddr: "198.51.100.7",
+		},
+		{
+			name:     "X-Forwarded-For in several headers",
+			wr:       fromAddr("10.0.0.1:4000", "X-Forwarded-For", "198.51.100.7", "X-Forwarded-For", "10.0.0.2"),
+			wantAddr: "198.51.100.7",
+		},
+		{
+			name:     "Forwarded",
+			wr:       fromAddr("10.0.0.1:4000", "Forwarded", `for=192.0.2.43;proto=https, for="[2001:db8::1]:4711";by=10.0.0.1`),
+			wantAddr: "2001:db8::1",
+		},
+		{
+			name:     "Forwarded wins over X-Forwarded-For",
+			wr:       fromAddr("[fd00::1]:4000", "Forwarded", "for=192.0.2.43", "X-Forwarded-For", "198.51.100.7"),
+			wantAddr: "192.0.2.43",
+		},
+		{
+			name:     "only trusted hops",
+			wr:       fromAddr("10.0.0.1:4000", "X-Forwarded-For", "10.0.0.3, 10.0.0.2"),
+			wantAddr: "10.0.0.3",
+		},
+		{
+			name: "obfuscated hop",
+			wr:   fromAddr("10.0.0.1:4000", "Forwarded", "for=_hidden"),
+		},
+		{
+			name: "unknown hop",
+			wr:   fromAddr("10.0.0.1:4000", "Forwarded", "for=unknown"),
+		},
+		{
+			name:     "unknown hop behind client",
+			wr:       fromAddr("10.0.0.1:4000", "Forwarded", "for=unknown, for=198.51.100.7"),
+			wantAddr: "198.51.100.7",
+		},
+		{
+			name:    "malformed hop",
+			wr:      fromAddr("10.0.0.1:4000", "X-Forwarded-For", "not-an-address"),
+			wantErr: true,
+		},
+		{
+			name:    "bad remote address",
+			wr:      fromAddr("pipe"),
+			wantErr: true,
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			addr, err := n.ClientAddr(v.wr)
+			if v.wantErr {
+				s.Error(err)
+				return
+			}
+			s.NoError(err)
+			if v.wantAddr == "" {
+				s.False(addr.IsValid())
+				return
+			}
+			s.Equal(netip.MustParseAddr(v.wantAddr), addr)
+		})
+	}
+}
+
+func (s *authorizerSuite) TestNetworkAllow() {
+	n := NewNetworkPolicy(NetworkConfig{
+		Groups: []RouteGroup{
+			{Name: "notifications", Prefix: "/api/v1/notifications", Networks: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24"), netip.MustParsePrefix("2001:db8::/32")}},
+			{Name: "broadcast", Prefix: "/api/v1/notifications/broadcast", Networks: []netip.Prefix{netip.MustParsePrefix("192.0.2.128/25")}},
+		},
+	})
+
+	tt := []struct {
+		name    string
+		path    string
+		addr    string
+		wantErr bool
+	}{
+		{name: "allowed", path: "/api/v1/notifications/batch", addr: "192.0.2.10"},
+		{name: "allowed IPv6", path: "/api/v1/notifications/batch", addr: "2001:db8::5"},
+		{name: "denied", path: "/api/v1/notifications/batch", addr: "198.51.100.7", wantErr: true},
+		{name: "longest prefix group", path: "/api/v1/notifications/broadcast", addr: "192.0.2.10", wantErr: true},
+		{name: "longest prefix group allowed", path: "/api/v1/notifications/broadcast", addr: "192.0.2.200"},
+		{name: "not restricted", path: "/api/v1/admin/apps", addr: "198.51.100.7"},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			err := n.Allow(v.path, netip.MustParseAddr(v.addr))
+			if v.wantErr {
+				s.True(errors.Is(err, ErrNetworkDenied))
+				return
+			}
+			s.NoError(err)
+		})
+	}
+}
+
+func (s *authorizerSuite) TestInternalNetwork() {
+	a := newTestAuthorizer()
+	a.Identities = PatternMapper{{Pattern: "crm.internal", AppID: "crm"}}
+	a.Network = NewNetworkPolicy(NetworkConfig{
+		Groups:         []RouteGroup{{Name: "notifications", Prefix: "/api/v1/notifications", Networks: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}}},
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24")},
+	})
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "crm.internal"}}
+
+	wr := withCert(cert, true)
+	wr.Req.RemoteAddr = "10.0.0.1:4000"
+	wr.Req.Header.Set("X-Forwarded-For", "192.0.2.10")
+	id, err := a.Internal(wr)
+	s.NoError(err)
+	s.Equal("crm", id.AppID)
+
+	wr = withCert(cert, true)
+	wr.Req.RemoteAddr = "198.51.100.7:4000"
+	wr.Req.Header.Set("X-Forwarded-For", "192.0.2.10")
+	_, err = a.Internal(wr)
+	s.True(errors.Is(err, ErrNetworkDenied))
+
+	wr = withCert(cert, true)
+	wr.Req.RemoteAddr = "10.0.0.1:4000"
+	wr.Req.Header.Set("Forwarded", "for=unknown")
+	_, err = a.Internal(wr)
+	s.True(errors.Is(err, ErrNetworkDenied))
+}
+
+func (s *authorizerSuite) TestAuthorizerClientAddr() {
+	a := newTestAuthorizer()
+	wr := fromAddr("10.0.0.1:4000", "X-Forwarded-For", "192.0.2.10")
+	addr, err := a.ClientAddr(wr)
+	s.NoError(err)
+	s.Equal(netip.MustParseAddr("10.0.0.1"), addr)
+
+	a.Network = NewNetworkPolicy(NetworkConfig{TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24")}})
+	addr, err = a.ClientAddr(wr)
+	s.NoError(err)
+	s.Equal(netip.MustParseAddr("192.0.2.10"), addr)
+
+	_, err = a.ClientAddr(fromAddr("pipe"))
+	s.Error(err)
+}
@@ -0,0 +1,229 @@
+package credentials
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+type Credentials interface {
+	Create(model.App) (model.App, error)
+	Issue(string) (model.AppSecret, error)
+	Revoke(string) error
+	RevokeSecret(string, uuid.UUID) error
+	Secrets(string) ([][]byte, error)
+	Scope(string) (model.AppScope, error)
+	Touch(string, []byte, time.Time) error
+	App(string) (model.App, error)
+	Close() error
+}
+
+// Credentials implementation
+
+// MaxActiveSecrets is number of secrets app may have at once, so secret can be rotated without downtime
+const MaxActiveSecrets = 2
+
+var (
+	ErrUnknownApp     = errors.New("unknown app")
+	ErrRevokedApp     = errors.New("app is revoked")
+	ErrTooManySecrets = errors.New("app has maximum number of active secrets")
+)
+
+type secret struct {
+	meta  model.AppSecret
+	value []byte
+}
+
+type entry struct {
+	app     model.App
+	secrets []secret
+}
+
+type memCredentials struct {
+	mu   sync.RWMutex
+	apps map[string]*entry
+	now  func() time.Time
+}
+
+// NewMemCredentials returns Credentials kept in memory
+func NewMemCredentials() *memCredentials {
+	return &memCredentials{
+		apps: make(map[string]*entry),
+		now:  time.Now,
+	}
+}
+
+// Create adds app with unique ID
+func (c *memCredentials) Create(a model.App) (model.App, error) {
+	if a.ID == "" {
+		return model.App{}, errors.New("in credentials.Create app has empty id")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.apps[a.ID]; ok {
+		return model.App{}, fmt.Errorf("in credentials.Create app %q already exists", a.ID)
+	}
+	a.CreatedAt = c.now().UTC()
+	a.LastUsedAt = time.Time{}
+	a.Revoked = false
+	c.apps[a.ID] = &entry{app: a}
+	return a, nil
+}
+
+// Issue generates new secret of app. Returned AppSecret is the only place secret value is shown.
+func (c *memCredentials) Issue(appID string) (model.AppSecret, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, err := c.active(appID)
+	if err != nil {
+		return model.AppSecret{}, fmt.Errorf("in credentials.Issue %w", err)
+	}
+	if len(e.secrets) >= MaxActiveSecrets {
+		return model.AppSecret{}, fmt.Errorf("in credentials.Issue app %q: %w", appID, ErrTooManySecrets)
+	}
+	v := make([]byte, 32)
+	_, err = rand.Read(v)
+	if err != nil {
+		return model.AppSecret{}, fmt.Errorf("in credentials.Issue unable to generate secret: %w", err)
+	}
+	s := secret{
+		meta: model.AppSecret{
+			UUID:      uuid.New(),
+			AppID:     appID,
+			CreatedAt: c.now().UTC(),
+		},
+		value: []byte(hex.EncodeToString(v)),
+	}
+	e.secrets = append(e.secrets, s)
+
+	res := s.meta
+	res.Secret = string(s.value)
+	return res, nil
+}
+
+// Revoke revokes app with all its secrets
+func (c *memCredentials) Revoke(appID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, err := c.active(appID)
+	if err != nil {
+		return fmt.Errorf("in credentials.Revoke %w", err)
+	}
+	e.app.Revoked = true
+	e.secrets = nil
+	return nil
+}
+
+func (c *memCredentials) RevokeSecret(appID string, u uuid.UUID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, err := c.active(appID)
+	if err != nil {
+		return fmt.Errorf("in credentials.RevokeSecret %w", err)
+	}
+	for i, v := range e.secrets {
+		if v.meta.UUID == u {
+			e.secrets = append(e.secrets[:i], e.secrets[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("in credentials.RevokeSecret app %q has no secret %s", appID, u)
+}
+
+// Secrets returns active secret values of app
+func (c *memCredentials) Secrets(appID string) ([][]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	e, err := c.active(appID)
+	if err != nil {
+		return nil, fmt.Errorf("in credentials.Secrets %w", err)
+	}
+	if len(e.secrets) == 0 {
+		return nil, fmt.Errorf("in credentials.Secrets app %q has no active secrets", appID)
+	}
+	res := make([][]byte, 0, len(e.secrets))
+	for _, v := range e.secrets {
+		res = append(res, v.value)
+	}
+	return res, nil
+}
+
+func (c *memCredentials) Scope(appID string) (model.AppScope, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	e, err := c.active(appID)
+	if err != nil {
+		return model.AppScope{}, fmt.Errorf("in credentials.Scope %w", err)
+	}
+	return e.app.Scope, nil
+}
+
+// Touch records time app and its secret with value were last used at
+func (c *memCredentials) Touch(appID string, value []byte, t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, err := c.active(appID)
+	if err != nil {
+		return fmt.Errorf("in credentials.Touch %w", err)
+	}
+	for i, v := range e.secrets {
+		if subtle.ConstantTimeCompare(v.value, value) != 1 {
+			continue
+		}
+		t = t.UTC()
+		if t.After(e.secrets[i].meta.LastUsedAt) {
+			e.secrets[i].meta.LastUsedAt = t
+		}
+		if t.After(e.app.LastUsedAt) {
+			e.app.LastUsedAt = t
+		}
+		return nil
+	}
+	return fmt.Errorf("in credentials.Touch app %q has no such secret", appID)
+}
+
+// App returns app with its active secrets, secret values are not included
+func (c *memCredentials) App(appID string) (model.App, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	e, ok := c.apps[appID]
+	if !ok {
+		return model.App{}, fmt.Errorf("in credentials.App %w %q", ErrUnknownApp, appID)
+	}
+	res := e.app
+	res.Secrets = make([]model.AppSecret, 0, len(e.secrets))
+	for _, v := range e.secrets {
+		res.Secrets = append(res.Secrets, v.meta)
+	}
+	return res, nil
+}
+
+func (c *memCredentials) Close() error {
+	return nil
+}
+
+func (c *memCredentials) active(appID string) (*entry, error) {
+	e, ok := c.apps[appID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownApp, appID)
+	}
+	if e.app.Revoked {
+		return nil, fmt.Errorf("%w %q", ErrRevokedApp, appID)
+	}
+	return e, nil
+}
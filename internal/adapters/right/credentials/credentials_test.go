@@ -0,0 +1,98 @@
+package credentials
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+type credentialsSuite struct {
+	suite.Suite
+}
+
+func TestCredentialsSuite(t *testing.T) {
+	suite.Run(t, new(credentialsSuite))
+}
+
+func (s *credentialsSuite) TestRotation() {
+	c := NewMemCredentials()
+	_, err := c.Create(model.App{ID: "crm", Name: "CRM", Scope: model.AppScope{Operations: []model.Operation{model.OperationWrite}}})
+	s.NoError(err)
+	_, err = c.Create(model.App{ID: "crm"})
+	s.Error(err)
+	_, err = c.Create(model.App{})
+	s.Error(err)
+
+	_, err = c.Secrets("crm")
+	s.Error(err)
+
+	first, err := c.Issue("crm")
+	s.NoError(err)
+	s.Len(first.Secret, 64)
+	second, err := c.Issue("crm")
+	s.NoError(err)
+	s.NotEqual(first.Secret, second.Secret)
+
+	_, err = c.Issue("crm")
+	s.ErrorIs(err, ErrTooManySecrets)
+
+	secrets, err := c.Secrets("crm")
+	s.NoError(err)
+	s.Equal([][]byte{[]byte(first.Secret), []byte(second.Secret)}, secrets)
+
+	s.NoError(c.RevokeSecret("crm", first.UUID))
+	s.Error(c.RevokeSecret("crm", first.UUID))
+	s.Error(c.RevokeSecret("crm", uuid.New()))
+	secrets, err = c.Secrets("crm")
+	s.NoError(err)
+	s.Equal([][]byte{[]byte(second.Secret)}, secrets)
+
+	_, err = c.Issue("crm")
+	s.NoError(err)
+}
+
+func (s *credentialsSuite) TestRevokeAndTouch() {
+	c := NewMemCredentials()
+	_, err := c.Create(model.App{ID: "crm", Scope: model.AppScope{Categories: []string{"invite"}}})
+	s.NoError(err)
+	first, err := c.Issue("crm")
+	s.NoError(err)
+	second, err := c.Issue("crm")
+	s.NoError(err)
+
+	t := time.Date(2022, 10, 2, 12, 0, 0, 0, time.UTC)
+	s.NoError(c.Touch("crm", []byte(first.Secret), t))
+	s.NoError(c.Touch("crm", []byte(first.Secret), t.Add(-time.Hour)))
+	s.Error(c.Touch("crm", []byte("unknown"), t))
+	a, err := c.App("crm")
+	s.NoError(err)
+	s.Equal(t, a.LastUsedAt)
+	s.Require().Len(a.Secrets, 2)
+	s.Equal(first.UUID, a.Secrets[0].UUID)
+	s.Equal(t, a.Secrets[0].LastUsedAt)
+	s.Empty(a.Secrets[0].Secret)
+	s.True(a.Secrets[1].LastUsedAt.IsZero())
+
+	s.NoError(c.Touch("crm", []byte(second.Secret), t.Add(time.Hour)))
+	a, err = c.App("crm")
+	s.NoError(err)
+	s.Equal(t.Add(time.Hour), a.LastUsedAt)
+	s.Equal(t, a.Secrets[0].LastUsedAt)
+	s.Equal(t.Add(time.Hour), a.Secrets[1].LastUsedAt)
+
+	sc, err := c.Scope("crm")
+	s.NoError(err)
+	s.Equal([]string{"invite"}, sc.Categories)
+
+	s.NoError(c.Revoke("crm"))
+	_, err = c.Secrets("crm")
+	s.ErrorIs(err, ErrRevokedApp)
+	_, err = c.Issue("crm")
+	s.ErrorIs(err, ErrRevokedApp)
+	_, err = c.Scope("crm")
+	s.Error(err)
+	s.ErrorIs(c.Touch("unknown", []byte(first.Secret), t), ErrUnknownApp)
+}
@@ -0,0 +1,190 @@
+package saver
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+// Asynchronous Saver implementation
+
+const (
+	DefaultQueueSize = 1024
+	DefaultBatchSize = 64
+)
+
+var ErrClosed = errors.New("saver is closed")
+
+// AsyncConfig holds queue size, max number of records written at once and what to do when queue is full
+type AsyncConfig struct {
+	QueueSize int
+	BatchSize int
+	// Overflow is model.OverflowBlock if not set
+	Overflow model.OverflowPolicy
+}
+
+// batchSaver writes several records at once
+type batchSaver interface {
+	SaveBatch([]model.WrappedLog) error
+}
+
+type asyncSaver struct {
+	AsyncConfig
+	next Saver
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []model.WrappedLog
+	writing bool
+	closed  bool
+	dropped uint64
+	// reported is number of dropped records already reported in log
+	reported uint64
+	done     chan struct{}
+}
+
+// NewAsyncSaver returns Saver putting records into bounded queue, single goroutine writes them to next in batches
+func NewAsyncSaver(next Saver, c AsyncConfig) *asyncSaver {
+	if c.QueueSize <= 0 {
+		c.QueueSize = DefaultQueueSize
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if c.Overflow == "" {
+		c.Overflow = model.OverflowBlock
+	}
+	a := &asyncSaver{
+		AsyncConfig: c,
+		next:        next,
+		queue:       make([]model.WrappedLog, 0, c.QueueSize),
+		done:        make(chan struct{}),
+	}
+	a.cond = sync.NewCond(&a.mu)
+	go a.run()
+	return a
+}
+
+// Save queues wl. If queue is full, Save waits (block), drops the oldest record (drop_oldest) or drops wl (drop).
+func (a *asyncSaver) Save(wl model.WrappedLog) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for !a.closed && len(a.queue) >= a.QueueSize {
+		switch a.Overflow {
+		case model.OverflowDropOldest:
+			a.queue = a.queue[1:]
+			a.dropped++
+		case model.OverflowDrop:
+			a.dropped++
+			return nil
+		default:
+			a.cond.Wait()
+		}
+	}
+	if a.closed {
+		return ErrClosed
+	}
+	a.queue = append(a.queue, wl)
+	a.cond.Broadcast()
+	return nil
+}
+
+// Dropped returns number of records dropped because queue was full
+func (a *asyncSaver) Dropped() uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.dropped
+}
+
+// Redactions returns redaction counters of next Saver, nil if it has none
+func (a *asyncSaver) Redactions() map[string]map[string]uint64 {
+	if r, ok := a.next.(RedactionCounter); ok {
+		return r.Redactions()
+	}
+	return nil
+}
+
+// Flush waits until queued records are written and flushes next Saver
+func (a *asyncSaver) Flush() error {
+	a.mu.Lock()
+	for len(a.queue) > 0 || a.writing {
+		a.cond.Wait()
+	}
+	a.mu.Unlock()
+	return a.next.Flush()
+}
+
+// Close writes all queued records and closes next Saver, records saved after Close are rejected
+func (a *asyncSaver) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return ErrClosed
+	}
+	a.closed = true
+	a.cond.Broadcast()
+	a.mu.Unlock()
+
+	<-a.done
+	return errors.Join(a.next.Flush(), a.next.Close())
+}
+
+func (a *asyncSaver) run() {
+	defer close(a.done)
+	for {
+		a.mu.Lock()
+		for len(a.queue) == 0 && !a.closed {
+			a.cond.Wait()
+		}
+		if len(a.queue) == 0 {
+			a.mu.Unlock()
+			return
+		}
+		n := min(len(a.queue), a.BatchSize)
+		batch := make([]model.WrappedLog, n, n+1)
+		copy(batch, a.queue)
+		a.queue = a.queue[n:]
+		if a.dropped > a.reported {
+			batch = append(batch, model.WrappedLog{
+				T:  time.Now(),
+				UW: model.UUIDWrapper{Str: model.LevelWarn.String()},
+				L:  fmt.Sprintf("%d log records dropped, queue is full", a.dropped-a.reported),
+				F:  []model.Field{{Key: "dropped", Value: a.dropped}},
+			})
+			a.reported = a.dropped
+		}
+		a.writing = true
+		// there is room in queue for blocked Save
+		a.cond.Broadcast()
+		a.mu.Unlock()
+
+		err := a.write(batch)
+		if err != nil {
+			log.Printf("in saver.run unable to write %d records: %v", len(batch), err)
+		}
+
+		a.mu.Lock()
+		a.writing = false
+		a.cond.Broadcast()
+		a.mu.Unlock()
+	}
+}
+
+func (a *asyncSaver) write(batch []model.WrappedLog) error {
+	if b, ok := a.next.(batchSaver); ok {
+		return b.SaveBatch(batch)
+	}
+	errs := make([]error, 0)
+	for _, v := range batch {
+		err := a.next.Save(v)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
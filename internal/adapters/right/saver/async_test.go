@@ -0,0 +1,137 @@
+package saver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/runtimeops"
+)
+
+// slowSaver records what it gets, Save waits until release is closed
+type slowSaver struct {
+	mu      sync.Mutex
+	release chan struct{}
+	got     []string
+	batches int
+	closed  bool
+}
+
+func (m *slowSaver) Save(wl model.WrappedLog) error {
+	return m.SaveBatch([]model.WrappedLog{wl})
+}
+
+func (m *slowSaver) SaveBatch(wls []model.WrappedLog) error {
+	<-m.release
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batches++
+	for _, v := range wls {
+		m.got = append(m.got, v.L)
+	}
+	return nil
+}
+
+func (m *slowSaver) Flush() error { return nil }
+
+func (m *slowSaver) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+func logs(msgs ...string) []model.WrappedLog {
+	res := make([]model.WrappedLog, 0, len(msgs))
+	for _, v := range msgs {
+		res = append(res, model.WrappedLog{T: time.Now(), L: v})
+	}
+	return res
+}
+
+func (s *saverSuite) TestAsyncOverflow() {
+	tt := []struct {
+		name        string
+		overflow    model.OverflowPolicy
+		wantGot     []string
+		wantDropped uint64
+	}{
+		{
+			name:     "block",
+			overflow: model.OverflowBlock,
+			wantGot:  []string{"1", "2", "3", "4", "5"},
+		},
+		{
+			name:        "drop oldest",
+			overflow:    model.OverflowDropOldest,
+			wantGot:     []string{"1", "4", "5", "2 log records dropped, queue is full"},
+			wantDropped: 2,
+		},
+		{
+			name:        "drop",
+			overflow:    model.OverflowDrop,
+			wantGot:     []string{"1", "2", "3", "2 log records dropped, queue is full"},
+			wantDropped: 2,
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			next := &slowSaver{release: make(chan struct{})}
+			a := NewAsyncSaver(next, AsyncConfig{QueueSize: 2, BatchSize: 10, Overflow: v.overflow})
+
+			// writer takes "1" and waits, queue holds two more records
+			s.NoError(a.Save(logs("1")[0]))
+			s.Eventually(func() bool {
+				a.mu.Lock()
+				defer a.mu.Unlock()
+				return a.writing
+			}, time.Second, time.Millisecond)
+
+			saved := make(chan struct{})
+			go func() {
+				for _, w := range logs("2", "3", "4", "5") {
+					s.NoError(a.Save(w))
+				}
+				close(saved)
+			}()
+			if v.overflow == model.OverflowBlock {
+				select {
+				case <-saved:
+					s.Fail("Save did not block")
+				case <-time.After(50 * time.Millisecond):
+				}
+			} else {
+				<-saved
+			}
+			close(next.release)
+			<-saved
+
+			s.NoError(a.Close())
+			s.Equal(v.wantGot, next.got)
+			s.Equal(v.wantDropped, a.Dropped())
+			s.True(next.closed)
+			s.True(errors.Is(a.Save(logs("6")[0]), ErrClosed))
+		})
+	}
+}
+
+func (s *saverSuite) TestAsyncFlush() {
+	sep := runtimeops.GetSep()
+	folder := s.T().TempDir()
+	a := NewAsyncSaver(NewSaverWithConfig(Config{Folder: folder, Sep: sep, Limit: 1 << 20}), AsyncConfig{BatchSize: 16})
+
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		s.NoError(a.Save(model.WrappedLog{T: now, UW: model.UUIDWrapper{UUID: uuid.New()}, L: "logloglog"}))
+	}
+	s.NoError(a.Flush())
+	b, err := os.ReadFile(filepath.Join(folder, now.Format(dateLayout)+"_all.log"))
+	s.NoError(err)
+	s.Equal(100, strings.Count(string(b), "\r\n"))
+	s.NoError(a.Close())
+}
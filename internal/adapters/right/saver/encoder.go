@@ -0,0 +1,97 @@
+package saver
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+// Encoder implementation
+
+// TextEncoder writes "timestamp: [LEVEL] uuid message key=value ..." lines, it is default Encoder
+type TextEncoder struct{}
+
+func (TextEncoder) Encode(wl model.WrappedLog) ([]byte, error) {
+	b := strings.Builder{}
+	b.WriteString(wl.T.Format(logTimeLayout))
+	b.WriteString(": ")
+	switch wl.UW.Str {
+	case "":
+		b.WriteString(wl.UW.UUID.String())
+	case "SIGNAL":
+		b.WriteString(wl.UW.Str)
+	default:
+		b.WriteString(wl.UW.Str + " " + wl.UW.UUID.String())
+	}
+	b.WriteString(" " + wl.L)
+	for _, v := range wl.F {
+		b.WriteString(" " + v.Key + "=" + textValue(v.Value))
+	}
+	b.WriteString("\r\n")
+	return []byte(b.String()), nil
+}
+
+// textValue quotes value if it would break key=value pairs apart
+func textValue(v interface{}) string {
+	s := fmt.Sprint(fieldValue(v))
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// JSONEncoder writes one JSON object per line
+type JSONEncoder struct{}
+
+type jsonLine struct {
+	Time   string                 `json:"time"`
+	Level  string                 `json:"level"`
+	UUID   string                 `json:"uuid,omitempty"`
+	Msg    string                 `json:"msg"`
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+func (JSONEncoder) Encode(wl model.WrappedLog) ([]byte, error) {
+	l := jsonLine{
+		Time:  wl.T.Format(time.RFC3339Nano),
+		Level: levelName(wl.UW.Str),
+		Msg:   wl.L,
+	}
+	if wl.UW.Str != "SIGNAL" {
+		l.UUID = wl.UW.UUID.String()
+	}
+	if len(wl.F) > 0 {
+		l.Fields = make(map[string]interface{}, len(wl.F))
+		for _, v := range wl.F {
+			l.Fields[v.Key] = fieldValue(v.Value)
+		}
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return nil, fmt.Errorf("in saver.Encode unable to marshal log: %w", err)
+	}
+	return append(b, '\n'), nil
+}
+
+// fieldValue returns errors and durations as strings, other values as they are
+func fieldValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case error:
+		return t.Error()
+	case time.Duration:
+		return t.String()
+	}
+	return v
+}
+
+// levelName returns level of UUIDWrapper.Str, empty string is INFO
+func levelName(s string) string {
+	if s == "" {
+		return "INFO"
+	}
+	return s
+}
@@ -0,0 +1,87 @@
+package saver
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/runtimeops"
+)
+
+func (s *saverSuite) TestEncode() {
+	t := time.Date(2023, 11, 23, 12, 30, 0, 0, time.UTC)
+	u := uuid.MustParse("2593ede0-2301-4480-a452-752f03dcfab0")
+
+	tt := []struct {
+		name     string
+		wl       model.WrappedLog
+		wantText string
+		wantJSON string
+	}{
+		{
+			name:     "info",
+			wl:       model.WrappedLog{T: t, UW: model.UUIDWrapper{UUID: u}, L: "saved"},
+			wantText: "2023-11-23 12:30:00: 2593ede0-2301-4480-a452-752f03dcfab0 saved\r\n",
+			wantJSON: `{"time":"2023-11-23T12:30:00Z","level":"INFO","uuid":"2593ede0-2301-4480-a452-752f03dcfab0","msg":"saved"}` + "\n",
+		},
+		{
+			name:     "error with fields",
+			wl:       model.WrappedLog{T: t, UW: model.UUIDWrapper{Str: "ERROR", UUID: u}, L: "unable to save", F: []model.Field{{Key: "app_id", Value: "crm"}, {Key: "items", Value: 2}, {Key: "err", Value: errors.New("no space left")}, {Key: "took", Value: 1500 * time.Millisecond}}},
+			wantText: "2023-11-23 12:30:00: ERROR 2593ede0-2301-4480-a452-752f03dcfab0 unable to save app_id=crm items=2 err=\"no space left\" took=1.5s\r\n",
+			wantJSON: `{"time":"2023-11-23T12:30:00Z","level":"ERROR","uuid":"2593ede0-2301-4480-a452-752f03dcfab0","msg":"unable to save","fields":{"app_id":"crm","err":"no space left","items":2,"took":"1.5s"}}` + "\n",
+		},
+		{
+			name:     "signal",
+			wl:       model.WrappedLog{T: t, UW: model.UUIDWrapper{Str: "SIGNAL"}, L: "application started"},
+			wantText: "2023-11-23 12:30:00: SIGNAL application started\r\n",
+			wantJSON: `{"time":"2023-11-23T12:30:00Z","level":"SIGNAL","msg":"application started"}` + "\n",
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			b, err := TextEncoder{}.Encode(v.wl)
+			s.NoError(err)
+			s.Equal(v.wantText, string(b))
+
+			b, err = JSONEncoder{}.Encode(v.wl)
+			s.NoError(err)
+			s.Equal(v.wantJSON, string(b))
+		})
+	}
+}
+
+func (s *saverSuite) TestSaveJSON() {
+	sep := runtimeops.GetSep()
+	folder := s.T().TempDir()
+	now := time.Now()
+	u := uuid.New()
+
+	sv := NewSaverWithConfig(Config{Folder: folder, Sep: sep, Limit: 300, Encoder: JSONEncoder{}})
+	s.NoError(sv.Save(model.WrappedLog{T: now, UW: model.UUIDWrapper{UUID: u}, L: "first"}))
+	s.NoError(sv.Save(model.WrappedLog{T: now, UW: model.UUIDWrapper{Str: "ERROR", UUID: u}, L: "second", F: []model.Field{{Key: "code", Value: 50002300}}}))
+	s.NoError(sv.Save(model.WrappedLog{T: now, UW: model.UUIDWrapper{Str: "SIGNAL"}, L: "third"}))
+
+	// every line is valid JSON, rotation by size still happens
+	lines := map[string][]string{}
+	entries, err := os.ReadDir(folder)
+	s.NoError(err)
+	for _, v := range entries {
+		b, err := os.ReadFile(filepath.Join(folder, v.Name()))
+		s.NoError(err)
+		stream := strings.TrimSuffix(v.Name()[strings.LastIndex(v.Name(), "_")+1:], ".log")
+		for _, w := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+			m := map[string]interface{}{}
+			s.NoError(json.Unmarshal([]byte(w), &m), w)
+			lines[stream] = append(lines[stream], m["msg"].(string))
+		}
+	}
+	s.ElementsMatch([]string{"first", "second", "third"}, lines["all"])
+	s.Equal([]string{"second"}, lines["err"])
+	s.Equal([]string{"third"}, lines["sig"])
+	s.Greater(len(entries), 3)
+}
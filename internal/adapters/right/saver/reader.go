@@ -0,0 +1,394 @@
+package saver
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+// Reader implementation
+
+var (
+	errBadLine = errors.New("not a log record")
+	// renamedRe matches names of files renamed by size rotation without Config.Rotation
+	renamedRe = regexp.MustCompile(`^\d{2}\.\d{2}\.\d{2}T`)
+)
+
+const (
+	// maxLineLen limits line length, longer lines are skipped
+	maxLineLen = 1 << 20
+	// defaultPoll is interval Follow checks current file for new lines
+	defaultPoll = 500 * time.Millisecond
+)
+
+type reader struct {
+	folder   string
+	sep      string
+	prefixes map[string]string
+	poll     time.Duration
+}
+
+// NewReader returns Reader of folder written by Saver with streams, DefaultStreams included.
+// Unknown stream name is used as file prefix.
+func NewReader(folder, sep string, streams []model.LogStream) *reader {
+	r := &reader{
+		folder:   folder,
+		sep:      sep,
+		prefixes: make(map[string]string),
+		poll:     defaultPoll,
+	}
+	for _, v := range append(append([]model.LogStream{}, DefaultStreams...), streams...) {
+		r.prefixes[v.Name] = v.Prefix
+		if v.Prefix == "" {
+			r.prefixes[v.Name] = v.Name
+		}
+	}
+	return r
+}
+
+// Find calls fn for every record matching q and line it is stored as, oldest file first. Error of fn stops Find and is returned.
+func (r *reader) Find(q model.LogQuery, fn func(model.WrappedLog, string) error) error {
+	files, err := r.files(q.Stream)
+	if err != nil {
+		return err
+	}
+	for _, v := range files {
+		err = r.readFile(v.path, q, fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Follow works as Find and then waits for new records like tail -f, until ctx is done.
+// When current file is rotated, the rest of it and all files written after it are read before the new current file is followed.
+func (r *reader) Follow(ctx context.Context, q model.LogQuery, fn func(model.WrappedLog, string) error) error {
+	var (
+		cur *follower
+		// done holds files read till the end, mark is the latest modification time of them
+		done []os.FileInfo
+		mark time.Time
+	)
+	defer func() {
+		if cur != nil {
+			cur.f.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(r.poll)
+	defer ticker.Stop()
+	for {
+		if cur != nil {
+			err := cur.read(q, fn)
+			if err != nil {
+				return err
+			}
+		}
+		next, err := r.newer(q.Stream, cur, done, mark)
+		if err != nil {
+			return err
+		}
+		if len(next) > 0 {
+			if cur != nil {
+				err = cur.read(q, fn)
+				if fi, serr := cur.f.Stat(); serr == nil {
+					done, mark = markDone(done, mark, fi)
+				}
+				cur.f.Close()
+				cur = nil
+				if err != nil {
+					return err
+				}
+			}
+			for i, v := range next {
+				if i == len(next)-1 && !strings.HasSuffix(v.path, gzExt) {
+					cur, err = newFollower(v.path)
+					if err != nil {
+						return err
+					}
+					break
+				}
+				err = r.readFile(v.path, q, fn)
+				if err != nil {
+					return err
+				}
+				done, mark = markDone(done, mark, v.info)
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// markDone adds fi to files read, files older than the latest one are forgotten
+func markDone(done []os.FileInfo, mark time.Time, fi os.FileInfo) ([]os.FileInfo, time.Time) {
+	if fi.ModTime().After(mark) {
+		mark = fi.ModTime()
+	}
+	res := make([]os.FileInfo, 0, len(done)+1)
+	for _, v := range append(done, fi) {
+		if !v.ModTime().Before(mark) {
+			res = append(res, v)
+		}
+	}
+	return res, mark
+}
+
+// files returns files of stream, oldest first by modification time
+func (r *reader) files(stream string) ([]logFile, error) {
+	if stream == "" {
+		stream = "all"
+	}
+	prefix, ok := r.prefixes[stream]
+	if !ok {
+		prefix = stream
+	}
+	entries, err := os.ReadDir(r.folder)
+	if err != nil {
+		return nil, fmt.Errorf("in saver.Find unable to read %s: %w", r.folder, err)
+	}
+	re := streamFileRe(prefix)
+	files := make([]logFile, 0)
+	for _, v := range entries {
+		if v.IsDir() || !re.MatchString(v.Name()) {
+			continue
+		}
+		fi, err := v.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, logFile{path: r.folder + r.sep + v.Name(), size: fi.Size(), mod: fi.ModTime(), info: fi})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].mod.Equal(files[j].mod) {
+			return files[i].mod.Before(files[j].mod)
+		}
+		// renamed by size rotation goes before current file of its date
+		ri, rj := renamedRe.MatchString(files[i].info.Name()), renamedRe.MatchString(files[j].info.Name())
+		if ri != rj {
+			return ri
+		}
+		return files[i].path < files[j].path
+	})
+	return files, nil
+}
+
+// newer returns files of stream which are neither read nor followed and are not older than mark.
+// Compressed file of mark time is copy of file already read.
+func (r *reader) newer(stream string, cur *follower, done []os.FileInfo, mark time.Time) ([]logFile, error) {
+	files, err := r.files(stream)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]logFile, 0)
+	for _, v := range files {
+		if v.mod.Before(mark) || (cur != nil && cur.is(v.info)) || seen(done, v.info) ||
+			(strings.HasSuffix(v.path, gzExt) && v.mod.Equal(mark)) {
+			continue
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+func seen(done []os.FileInfo, fi os.FileInfo) bool {
+	for _, v := range done {
+		if os.SameFile(v, fi) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *reader) readFile(path string, q model.LogQuery, fn func(model.WrappedLog, string) error) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// removed by retention meanwhile
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("in saver.Find unable to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var rd io.Reader = f
+	if strings.HasSuffix(path, gzExt) {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("in saver.Find unable to read %s: %w", path, err)
+		}
+		defer zr.Close()
+		rd = zr
+	}
+	err = scan(rd, q, fn)
+	if err != nil {
+		return fmt.Errorf("in saver.Find %s: %w", path, err)
+	}
+	return nil
+}
+
+// scan calls fn for every line of rd matching q with the line as is, lines which are not records are skipped
+func scan(rd io.Reader, q model.LogQuery, fn func(model.WrappedLog, string) error) error {
+	sc := bufio.NewScanner(rd)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLineLen)
+	for sc.Scan() {
+		wl, err := parseLine(sc.Text())
+		if err != nil || !matches(q, wl) {
+			continue
+		}
+		err = fn(wl, sc.Text())
+		if err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// follower reads file being written, incomplete last line is kept until it is complete
+type follower struct {
+	f       *os.File
+	pending []byte
+}
+
+func newFollower(path string) (*follower, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("in saver.Follow unable to open %s: %w", path, err)
+	}
+	return &follower{f: f}, nil
+}
+
+func (fl *follower) read(q model.LogQuery, fn func(model.WrappedLog, string) error) error {
+	b, err := io.ReadAll(fl.f)
+	if err != nil {
+		return fmt.Errorf("in saver.Follow unable to read %s: %w", fl.f.Name(), err)
+	}
+	data := append(fl.pending, b...)
+	i := bytes.LastIndexByte(data, '\n')
+	fl.pending = append([]byte{}, data[i+1:]...)
+	return scan(bytes.NewReader(data[:i+1]), q, fn)
+}
+
+// is tells if fi is the file being read, file renamed by rotation is not replaced by new file of its name
+func (fl *follower) is(fi os.FileInfo) bool {
+	ffi, err := fl.f.Stat()
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ffi, fi)
+}
+
+// parseLine parses line written by TextEncoder or JSONEncoder.
+// Message and fields of text line can not be told apart, so they are both returned as message.
+func parseLine(s string) (model.WrappedLog, error) {
+	s = strings.TrimSuffix(s, "\r")
+	if strings.HasPrefix(s, "{") {
+		return parseJSON(s)
+	}
+	return parseText(s)
+}
+
+func parseText(s string) (model.WrappedLog, error) {
+	wl := model.WrappedLog{}
+	n := len(logTimeLayout)
+	if len(s) < n+2 || s[n:n+2] != ": " {
+		return wl, errBadLine
+	}
+	t, err := time.ParseInLocation(logTimeLayout, s[:n], time.Local)
+	if err != nil {
+		return wl, errBadLine
+	}
+	wl.T = t
+	word, rest, _ := strings.Cut(s[n+2:], " ")
+	if word == "SIGNAL" {
+		wl.UW.Str = word
+		wl.L = rest
+		return wl, nil
+	}
+	id, err := uuid.Parse(word)
+	if err != nil {
+		wl.UW.Str = word
+		word, rest, _ = strings.Cut(rest, " ")
+		id, err = uuid.Parse(word)
+		if err != nil {
+			return wl, errBadLine
+		}
+	}
+	wl.UW.UUID = id
+	wl.L = rest
+	return wl, nil
+}
+
+func parseJSON(s string) (model.WrappedLog, error) {
+	wl := model.WrappedLog{}
+	l := jsonLine{}
+	d := json.NewDecoder(strings.NewReader(s))
+	d.UseNumber()
+	err := d.Decode(&l)
+	if err != nil {
+		return wl, errBadLine
+	}
+	wl.T, err = time.Parse(time.RFC3339Nano, l.Time)
+	if err != nil {
+		return wl, errBadLine
+	}
+	if l.Level != "INFO" {
+		wl.UW.Str = l.Level
+	}
+	if l.UUID != "" {
+		wl.UW.UUID, err = uuid.Parse(l.UUID)
+		if err != nil {
+			return wl, errBadLine
+		}
+	}
+	wl.L = l.Msg
+	keys := make([]string, 0, len(l.Fields))
+	for i := range l.Fields {
+		keys = append(keys, i)
+	}
+	sort.Strings(keys)
+	for _, v := range keys {
+		wl.F = append(wl.F, model.Field{Key: v, Value: l.Fields[v]})
+	}
+	return wl, nil
+}
+
+func matches(q model.LogQuery, wl model.WrappedLog) bool {
+	if q.UUID != uuid.Nil && wl.UW.UUID != q.UUID {
+		return false
+	}
+	if !q.From.IsZero() && wl.T.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !wl.T.Before(q.To) {
+		return false
+	}
+	if len(q.Levels) == 0 {
+		return true
+	}
+	l := model.ParseLevel(wl.UW.Str)
+	for _, v := range q.Levels {
+		if v == l {
+			return true
+		}
+	}
+	return false
+}
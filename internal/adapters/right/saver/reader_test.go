@@ -0,0 +1,197 @@
+package saver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/runtimeops"
+)
+
+func (s *saverSuite) TestParseLine() {
+	id := uuid.MustParse("6f0c2a3e-8f6b-4f52-9a57-3b1c8d9e1f20")
+	t := time.Date(2023, 11, 23, 10, 0, 1, 0, time.Local)
+	tt := []struct {
+		name    string
+		wl      model.WrappedLog
+		enc     Encoder
+		line    string
+		wantErr bool
+	}{
+		{name: "text info", enc: TextEncoder{}, wl: model.WrappedLog{T: t, UW: model.UUIDWrapper{UUID: id}, L: "saved 2 notifications"}},
+		{name: "text error", enc: TextEncoder{}, wl: model.WrappedLog{T: t, UW: model.UUIDWrapper{UUID: id, Str: "ERROR"}, L: "failed"}},
+		{name: "text signal", enc: TextEncoder{}, wl: model.WrappedLog{T: t, UW: model.UUIDWrapper{Str: "SIGNAL"}, L: "stopping"}},
+		{name: "text fields are message", enc: TextEncoder{}, wl: model.WrappedLog{T: t, UW: model.UUIDWrapper{UUID: id, Str: "WARN"}, L: `slow path="/api/v1/get"`}},
+		{name: "json", enc: JSONEncoder{}, wl: model.WrappedLog{T: t, UW: model.UUIDWrapper{UUID: id, Str: "ERROR"}, L: "failed", F: []model.Field{{Key: "a", Value: json.Number("1")}, {Key: "b", Value: "x"}}}},
+		{name: "json signal", enc: JSONEncoder{}, wl: model.WrappedLog{T: t, UW: model.UUIDWrapper{Str: "SIGNAL"}, L: "stopping"}},
+		{name: "partial line", line: "2023-11-23 10:00:01: 6f0c2a3e-8f6b", wantErr: true},
+		{name: "no time", line: "panic: runtime error", wantErr: true},
+		{name: "broken json", line: `{"time":"2023-11-23T10:00:01+03:00","level":"ERR`, wantErr: true},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			line := v.line
+			if v.enc != nil {
+				b, err := v.enc.Encode(v.wl)
+				s.NoError(err)
+				line = string(b[:len(b)-1])
+			}
+			wl, err := parseLine(line)
+			if v.wantErr {
+				s.ErrorIs(err, errBadLine)
+				return
+			}
+			s.NoError(err)
+			s.True(v.wl.T.Equal(wl.T))
+			wl.T = v.wl.T
+			s.Equal(v.wl, wl)
+		})
+	}
+}
+
+func (s *saverSuite) TestFind() {
+	sep := runtimeops.GetSep()
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	start := time.Date(2023, 11, 23, 10, 0, 0, 0, time.Local)
+	wls := make([]model.WrappedLog, 0, 30)
+	for i := 0; i < 30; i++ {
+		wl := model.WrappedLog{T: start.Add(time.Duration(i) * time.Minute), UW: model.UUIDWrapper{UUID: ids[i%3]}, L: fmt.Sprintf("log %d", i)}
+		switch {
+		case i == 7:
+			wl.UW = model.UUIDWrapper{Str: "SIGNAL"}
+		case i%5 == 0:
+			wl.UW.Str = "ERROR"
+		}
+		wls = append(wls, wl)
+	}
+	filter := func(f func(int, model.WrappedLog) bool) []string {
+		res := make([]string, 0)
+		for i, v := range wls {
+			if f(i, v) {
+				res = append(res, v.L)
+			}
+		}
+		return res
+	}
+
+	tt := []struct {
+		name  string
+		query model.LogQuery
+		want  []string
+	}{
+		{name: "all", query: model.LogQuery{}, want: filter(func(int, model.WrappedLog) bool { return true })},
+		{name: "uuid", query: model.LogQuery{UUID: ids[1]}, want: filter(func(i int, wl model.WrappedLog) bool { return wl.UW.UUID == ids[1] })},
+		{name: "time", query: model.LogQuery{From: start.Add(10 * time.Minute), To: start.Add(20 * time.Minute)}, want: filter(func(i int, _ model.WrappedLog) bool { return i >= 10 && i < 20 })},
+		{name: "levels", query: model.LogQuery{Levels: []model.Level{model.LevelError, model.LevelSignal}}, want: filter(func(i int, wl model.WrappedLog) bool { return wl.UW.Str != "" })},
+		{name: "stream", query: model.LogQuery{Stream: "err", UUID: ids[0]}, want: filter(func(i int, wl model.WrappedLog) bool { return wl.UW.Str == "ERROR" && wl.UW.UUID == ids[0] })},
+		{name: "nothing", query: model.LogQuery{UUID: uuid.New()}, want: []string{}},
+	}
+	for _, enc := range []Encoder{TextEncoder{}, JSONEncoder{}} {
+		folder := s.T().TempDir()
+		sv := NewSaverWithConfig(Config{
+			Folder:    folder,
+			Sep:       sep,
+			Limit:     400,
+			Encoder:   enc,
+			Retention: map[string]model.RetentionPolicy{"all": {Compress: true}},
+		})
+		for _, v := range wls {
+			s.NoError(sv.Save(v))
+		}
+		s.NoError(sv.Close())
+		compressed := 0
+		for _, v := range dirNames(s, folder) {
+			if strings.HasSuffix(v, "_all.log.gz") {
+				compressed++
+			}
+		}
+		s.Greater(compressed, 1)
+
+		r := NewReader(folder, sep, nil)
+		for _, v := range tt {
+			s.Run(fmt.Sprintf("%T %s", enc, v.name), func() {
+				got := make([]string, 0)
+				err := r.Find(v.query, func(wl model.WrappedLog, line string) error {
+					got = append(got, wl.L)
+					parsed, err := parseLine(line)
+					s.NoError(err)
+					s.Equal(wl, parsed)
+					s.NotContains(line, "\n")
+					return nil
+				})
+				s.NoError(err)
+				s.Equal(v.want, got)
+			})
+		}
+	}
+}
+
+func (s *saverSuite) TestFollow() {
+	sep := runtimeops.GetSep()
+	folder := s.T().TempDir()
+	sv := NewSaverWithConfig(Config{
+		Folder:   folder,
+		Sep:      sep,
+		Limit:    300,
+		Rotation: model.RotationPolicy{Interval: model.RotateHourly, Location: time.Local},
+	})
+	start := time.Date(2023, 11, 23, 10, 50, 0, 0, time.Local)
+	wl := func(i int) model.WrappedLog {
+		return model.WrappedLog{T: start.Add(time.Duration(i) * time.Minute), UW: model.UUIDWrapper{UUID: uuid.New()}, L: fmt.Sprintf("log %d", i)}
+	}
+	for i := 0; i < 5; i++ {
+		s.NoError(sv.Save(wl(i)))
+	}
+
+	r := NewReader(folder, sep, nil)
+	r.poll = 5 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	got := make(chan string, 100)
+	done := make(chan error)
+	go func() {
+		done <- r.Follow(ctx, model.LogQuery{}, func(wl model.WrappedLog, _ string) error {
+			got <- wl.L
+			return nil
+		})
+	}()
+	receive := func(from, to int) {
+		for i := from; i < to; i++ {
+			select {
+			case l := <-got:
+				s.Equal(fmt.Sprintf("log %d", i), l)
+			case <-time.After(time.Second):
+				s.Fail("no record", "log %d", i)
+				return
+			}
+		}
+	}
+	receive(0, 5)
+
+	// files are rotated by size and hour while following
+	for i := 5; i < 20; i++ {
+		s.NoError(sv.Save(wl(i)))
+	}
+	receive(5, 20)
+
+	// partial line is not read until it is complete
+	line, err := TextEncoder{}.Encode(wl(20))
+	s.NoError(err)
+	f, err := os.OpenFile(sv.PathMap["all"], os.O_APPEND|os.O_WRONLY, 0666)
+	s.NoError(err)
+	_, err = f.Write(line[:20])
+	s.NoError(err)
+	time.Sleep(20 * r.poll)
+	s.Len(got, 0)
+	_, err = f.Write(line[20:])
+	s.NoError(err)
+	f.Close()
+	receive(20, 21)
+
+	cancel()
+	s.NoError(<-done)
+}
@@ -0,0 +1,253 @@
+package saver
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+// Redactor implementation
+
+const (
+	// RedactedField lists rules fired on record
+	RedactedField = "redacted"
+	redactedValue = "[redacted]"
+)
+
+// UUIDPattern matches uuid in canonical form
+const UUIDPattern = `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`
+
+// DefaultRedactionRules mask emails and phone numbers, hash user uuids, uuids in errors and client address and agent of access records,
+// mask notification names and drop descriptions
+var DefaultRedactionRules = []model.RedactionRule{
+	{Name: "email", Pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`, Action: model.RedactMask},
+	{Name: "phone", Pattern: `(?:\+\d{1,3}|8)[ -]?\(?\d{3}\)?[ -]?\d{3}[ -]?\d{2}[ -]?\d{2}`, Action: model.RedactMask},
+	{Name: "user", Field: "user", Action: model.RedactHash},
+	{Name: "user_uuid", Field: "user_uuid", Action: model.RedactHash},
+	{Name: "subject", Field: "subject", Action: model.RedactHash},
+	{Name: "error_uuid", Field: "error", Pattern: UUIDPattern, Action: model.RedactHash},
+	{Name: "name", Field: "name", Action: model.RedactMask},
+	{Name: "description", Field: "description", Action: model.RedactDrop},
+	{Name: "ip", Field: "ip", Action: model.RedactHash},
+	{Name: "user_agent", Field: "user_agent", Action: model.RedactHash},
+}
+
+// DefaultRedaction redacts streams all and access
+var DefaultRedaction = map[string][]model.RedactionRule{
+	"all":    DefaultRedactionRules,
+	"access": DefaultRedactionRules,
+}
+
+type redactionRule struct {
+	model.RedactionRule
+	re *regexp.Regexp
+}
+
+type redactor struct {
+	rules map[string][]redactionRule
+	key   []byte
+
+	mu    sync.Mutex
+	fired map[string]map[string]uint64
+}
+
+// newRedactor returns Redactor of rules by stream, values are hashed by HMAC with key.
+// Rules with invalid pattern or action are skipped. Random key is used if key is empty,
+// so hashes can be compared within one run only.
+func newRedactor(rules map[string][]model.RedactionRule, key []byte) *redactor {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	r := &redactor{
+		rules: make(map[string][]redactionRule, len(rules)),
+		key:   key,
+		fired: make(map[string]map[string]uint64),
+	}
+	for stream, v := range rules {
+		for _, w := range v {
+			rule, err := compileRule(w)
+			if err != nil {
+				log.Printf("in saver.NewSaver redaction rule of stream %s: %v", stream, err)
+				continue
+			}
+			r.rules[stream] = append(r.rules[stream], rule)
+		}
+	}
+	return r
+}
+
+func compileRule(rule model.RedactionRule) (redactionRule, error) {
+	res := redactionRule{RedactionRule: rule}
+	switch rule.Action {
+	case model.RedactHash, model.RedactMask, model.RedactDrop:
+	default:
+		return res, fmt.Errorf("rule %q has unknown action %q", rule.Name, rule.Action)
+	}
+	if rule.Field == "" && rule.Pattern == "" {
+		return res, fmt.Errorf("rule %q has neither field nor pattern", rule.Name)
+	}
+	if rule.Pattern != "" {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return res, fmt.Errorf("rule %q has invalid pattern: %w", rule.Name, err)
+		}
+		res.re = re
+	}
+	if res.Name == "" {
+		res.Name = rule.Field + rule.Pattern
+	}
+	return res, nil
+}
+
+// Redact returns wl changed by rules of stream and names of rules fired.
+// Names are added to record as RedactedField.
+func (r *redactor) Redact(stream string, wl model.WrappedLog) (model.WrappedLog, []string) {
+	return r.redact(stream, stream, wl)
+}
+
+// redact applies rules of stream and counts fired ones as fired on counter
+func (r *redactor) redact(stream, counter string, wl model.WrappedLog) (model.WrappedLog, []string) {
+	rules := r.rules[stream]
+	if len(rules) == 0 {
+		return wl, nil
+	}
+	fired := make([]string, 0)
+	res := wl
+	res.F = make([]model.Field, 0, len(wl.F)+1)
+	for _, v := range rules {
+		if v.Field != "" || v.re == nil {
+			continue
+		}
+		var ok bool
+		res.L, ok = r.replace(v, res.L)
+		if ok {
+			fired = appendName(fired, v.Name)
+		}
+	}
+	for _, f := range wl.F {
+		drop := false
+		for _, v := range rules {
+			if v.Field != "" && v.Field != f.Key {
+				continue
+			}
+			s, isString := fieldValue(f.Value).(string)
+			switch {
+			case v.re == nil && v.Action == model.RedactDrop:
+				drop = true
+			case v.re == nil:
+				f.Value = r.apply(v.Action, fmt.Sprint(fieldValue(f.Value)))
+			case isString:
+				var ok bool
+				f.Value, ok = r.replace(v, s)
+				if !ok {
+					continue
+				}
+			default:
+				continue
+			}
+			fired = appendName(fired, v.Name)
+			if drop {
+				break
+			}
+		}
+		if !drop {
+			res.F = append(res.F, f)
+		}
+	}
+	if len(fired) == 0 {
+		return wl, nil
+	}
+	res.F = append(res.F, model.Field{Key: RedactedField, Value: strings.Join(fired, ",")})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fired[counter] == nil {
+		r.fired[counter] = make(map[string]uint64)
+	}
+	for _, v := range fired {
+		r.fired[counter][v]++
+	}
+	return res, fired
+}
+
+// Fired returns number of records every rule fired on by stream, records of sinks are counted as stream sinks
+func (r *redactor) Fired() map[string]map[string]uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make(map[string]map[string]uint64, len(r.fired))
+	for i, v := range r.fired {
+		res[i] = make(map[string]uint64, len(v))
+		for j, w := range v {
+			res[i][j] = w
+		}
+	}
+	return res
+}
+
+// replace applies rule to every match of its pattern in s which is not part of longer word, uuid for example
+func (r *redactor) replace(rule redactionRule, s string) (string, bool) {
+	b := strings.Builder{}
+	last, changed := 0, false
+	for _, v := range rule.re.FindAllStringIndex(s, -1) {
+		if v[0] > 0 && isWordByte(s[v[0]-1]) || v[1] < len(s) && isWordByte(s[v[1]]) {
+			continue
+		}
+		b.WriteString(s[last:v[0]])
+		if rule.Action == model.RedactDrop {
+			b.WriteString(redactedValue)
+		} else {
+			b.WriteString(r.apply(rule.Action, s[v[0]:v[1]]))
+		}
+		last, changed = v[1], true
+	}
+	if !changed {
+		return s, false
+	}
+	b.WriteString(s[last:])
+	return b.String(), true
+}
+
+func (r *redactor) apply(action model.RedactionAction, s string) string {
+	switch action {
+	case model.RedactHash:
+		m := hmac.New(sha256.New, r.key)
+		m.Write([]byte(s))
+		return "hash:" + hex.EncodeToString(m.Sum(nil))[:16]
+	case model.RedactMask:
+		return mask(s)
+	}
+	return redactedValue
+}
+
+// mask keeps first and two last characters of s, short s is masked entirely
+func mask(s string) string {
+	n := utf8.RuneCountInString(s)
+	if n <= 4 {
+		return strings.Repeat("*", n)
+	}
+	rs := []rune(s)
+	return string(rs[:1]) + "****" + string(rs[n-2:])
+}
+
+func isWordByte(b byte) bool {
+	return b == '-' || b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+func appendName(names []string, name string) []string {
+	for _, v := range names {
+		if v == name {
+			return names
+		}
+	}
+	return append(names, name)
+}
@@ -0,0 +1,157 @@
+package saver
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/runtimeops"
+)
+
+func (s *saverSuite) TestRedact() {
+	key := []byte("key")
+	r := newRedactor(map[string][]model.RedactionRule{
+		"access": DefaultRedactionRules,
+		"all": append(append([]model.RedactionRule{}, DefaultRedactionRules...),
+			model.RedactionRule{Name: "token", Field: "query", Pattern: `token=\w+`, Action: model.RedactDrop},
+			model.RedactionRule{Name: "bad pattern", Pattern: `(`, Action: model.RedactMask},
+			model.RedactionRule{Name: "bad action", Field: "x", Action: "encrypt"},
+		),
+	}, key)
+	user := "2593ede0-2301-4480-a452-752f03dcfab0"
+	userHash := r.apply(model.RedactHash, user)
+	s.Regexp(`^hash:[0-9a-f]{16}$`, userHash)
+	s.Equal(userHash, newRedactor(nil, key).apply(model.RedactHash, user))
+	s.NotEqual(userHash, newRedactor(nil, nil).apply(model.RedactHash, user))
+
+	tt := []struct {
+		name      string
+		stream    string
+		wl        model.WrappedLog
+		wantL     string
+		wantF     []model.Field
+		wantFired []string
+	}{
+		{
+			name:      "email and phone in message",
+			stream:    "all",
+			wl:        model.WrappedLog{L: "sent to john.smith@example.com and +7 (916) 123-45-67, 8 916 123 45 67"},
+			wantL:     "sent to j****om and +****67, 8****67",
+			wantF:     []model.Field{{Key: RedactedField, Value: "email,phone"}},
+			wantFired: []string{"email", "phone"},
+		},
+		{
+			name:   "uuids and times are not phones",
+			stream: "all",
+			wl:     model.WrappedLog{L: "request 8123-4567-8901-23456789 at 2023-11-23 10:00:00 of 82593ede-2301-4480-a452-752f03dcfab0"},
+			wantL:  "request 8123-4567-8901-23456789 at 2023-11-23 10:00:00 of 82593ede-2301-4480-a452-752f03dcfab0",
+		},
+		{
+			name:   "fields",
+			stream: "all",
+			wl: model.WrappedLog{L: "saved", F: []model.Field{
+				{Key: "user", Value: user}, {Key: "name", Value: "Birthday party"}, {Key: "description", Value: "at home"},
+				{Key: "count", Value: 2}, {Key: "error", Value: errors.New("no user ann@example.com")},
+				{Key: "query", Value: "page=1&token=abc&email=bob@example.org"},
+			}},
+			wantL: "saved",
+			wantF: []model.Field{
+				{Key: "user", Value: userHash}, {Key: "name", Value: "B****ty"},
+				{Key: "count", Value: 2}, {Key: "error", Value: "no user a****om"},
+				{Key: "query", Value: "page=1&[redacted]&email=b****rg"},
+				{Key: RedactedField, Value: "user,name,description,email,token"},
+			},
+			wantFired: []string{"user", "name", "description", "email", "token"},
+		},
+		{
+			name:   "user uuid in error",
+			stream: "all",
+			wl: model.WrappedLog{L: "request failed", F: []model.Field{
+				{Key: "error", Value: errors.New("in store.Get no rows for user " + user)},
+				{Key: "broadcast", Value: "0c8e0a57-8a25-4b0e-9c0a-54a1b1a2c7a1"},
+			}},
+			wantL: "request failed",
+			wantF: []model.Field{
+				{Key: "error", Value: "in store.Get no rows for user " + userHash},
+				{Key: "broadcast", Value: "0c8e0a57-8a25-4b0e-9c0a-54a1b1a2c7a1"},
+				{Key: RedactedField, Value: "error_uuid"},
+			},
+			wantFired: []string{"error_uuid"},
+		},
+		{
+			name:   "access record",
+			stream: "access",
+			wl: model.WrappedLog{L: "request", F: model.AccessEntry{
+				Method: "GET", Path: "/api/v1/notifications", Status: 200, UserAgent: "Mozilla/5.0", IP: "192.0.2.10",
+			}.Fields()},
+			wantL: "request",
+			wantF: []model.Field{
+				{Key: model.AccessStreamField, Value: "access"}, {Key: "method", Value: "GET"}, {Key: "path", Value: "/api/v1/notifications"},
+				{Key: "status", Value: 200}, {Key: "bytes", Value: int64(0)}, {Key: "latency", Value: "0s"},
+				{Key: "user_agent", Value: r.apply(model.RedactHash, "Mozilla/5.0")}, {Key: "ip", Value: r.apply(model.RedactHash, "192.0.2.10")},
+				{Key: "slow", Value: false},
+				{Key: RedactedField, Value: "user_agent,ip"},
+			},
+			wantFired: []string{"user_agent", "ip"},
+		},
+		{
+			name:   "stream without rules",
+			stream: "err",
+			wl:     model.WrappedLog{L: "sent to john@example.com", F: []model.Field{{Key: "user", Value: user}}},
+			wantL:  "sent to john@example.com",
+			wantF:  []model.Field{{Key: "user", Value: user}},
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			wl, fired := r.Redact(v.stream, v.wl)
+			s.Equal(v.wantL, wl.L)
+			s.Equal(v.wantF, wl.F)
+			s.Equal(v.wantFired, fired)
+		})
+	}
+	s.Equal(map[string]map[string]uint64{
+		"all":    {"email": 2, "phone": 1, "user": 1, "name": 1, "description": 1, "token": 1, "error_uuid": 1},
+		"access": {"ip": 1, "user_agent": 1},
+	}, r.Fired())
+}
+
+func (s *saverSuite) TestSaveRedaction() {
+	sep := runtimeops.GetSep()
+	t := time.Date(2023, 11, 23, 10, 0, 0, 0, time.UTC)
+	wl := model.WrappedLog{T: t, UW: model.UUIDWrapper{UUID: uuid.New(), Str: "ERROR"}, L: "unable to notify john@example.com"}
+
+	// by default stream all is redacted, err is not
+	folder := s.T().TempDir()
+	b := &bytes.Buffer{}
+	sv := NewSaverWithConfig(Config{Folder: folder, Sep: sep, Limit: 1000, Sinks: []Sink{NewConsoleSink(b, false)}})
+	s.NoError(sv.Save(wl))
+	s.NoError(sv.Close())
+	all, err := os.ReadFile(filepath.Join(folder, "2023-11-23_all.log"))
+	s.NoError(err)
+	s.Contains(string(all), "unable to notify j****om redacted=email\r\n")
+	errs, err := os.ReadFile(filepath.Join(folder, "2023-11-23_err.log"))
+	s.NoError(err)
+	s.Contains(string(errs), "unable to notify john@example.com\r\n")
+	s.Contains(b.String(), "unable to notify j****om redacted=email\n")
+	s.Equal(map[string]map[string]uint64{"all": {"email": 1}, "sinks": {"email": 1}}, sv.Redactions())
+
+	// empty map turns redaction off
+	folder = s.T().TempDir()
+	sv = NewSaverWithConfig(Config{Folder: folder, Sep: sep, Limit: 1000, Redaction: map[string][]model.RedactionRule{}})
+	s.NoError(sv.Save(wl))
+	all, err = os.ReadFile(filepath.Join(folder, "2023-11-23_all.log"))
+	s.NoError(err)
+	s.Contains(string(all), "unable to notify john@example.com\r\n")
+	s.Empty(sv.Redactions())
+
+	// asynchronous Saver reports counters of its Saver
+	a := NewAsyncSaver(NewSaverWithConfig(Config{Folder: s.T().TempDir(), Sep: sep, Limit: 1000}), AsyncConfig{})
+	s.NoError(a.Save(wl))
+	s.NoError(a.Close())
+	s.Equal(map[string]map[string]uint64{"all": {"email": 1}}, a.Redactions())
+}
@@ -0,0 +1,57 @@
+package saver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// Repairer implementation
+
+// truncatedMark ends partial line left by crash, so that next record starts on its own line
+const truncatedMark = " [truncated]"
+
+type repairer struct {
+	mark []byte
+}
+
+// newRepairer returns Repairer ending partial lines with truncatedMark and lineEnd
+func newRepairer(lineEnd []byte) *repairer {
+	return &repairer{mark: append([]byte(truncatedMark), lineEnd...)}
+}
+
+// Repair marks last line of file as truncated if it has no line end. Missing, empty and not regular files are left as they are.
+func (r *repairer) Repair(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("in saver.Repair unable to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("in saver.Repair unable to stat %s: %w", path, err)
+	}
+	if !fi.Mode().IsRegular() || fi.Size() == 0 {
+		return nil
+	}
+	b := make([]byte, 1)
+	_, err = f.ReadAt(b, fi.Size()-1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("in saver.Repair unable to read %s: %w", path, err)
+	}
+	if b[0] == '\n' {
+		return nil
+	}
+	_, err = f.Write(r.mark)
+	if err != nil {
+		return fmt.Errorf("in saver.Repair unable to mark partial line of %s: %w", path, err)
+	}
+	log.Printf("in saver.Repair partial last line of %s is marked as truncated", path)
+	return nil
+}
@@ -0,0 +1,75 @@
+package saver
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/runtimeops"
+)
+
+func (s *saverSuite) TestRepair() {
+	folder := s.T().TempDir()
+	tt := []struct {
+		name    string
+		lineEnd string
+		content *string
+		want    string
+	}{
+		{name: "no file", lineEnd: "\r\n"},
+		{name: "empty", lineEnd: "\r\n", content: ptr(""), want: ""},
+		{name: "complete", lineEnd: "\r\n", content: ptr("a\r\nb\r\n"), want: "a\r\nb\r\n"},
+		{name: "partial text", lineEnd: "\r\n", content: ptr("a\r\nb"), want: "a\r\nb [truncated]\r\n"},
+		{name: "partial line end", lineEnd: "\r\n", content: ptr("a\r\nb\r"), want: "a\r\nb\r [truncated]\r\n"},
+		{name: "partial json", lineEnd: "\n", content: ptr("{}\n{\"ti"), want: "{}\n{\"ti [truncated]\n"},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			path := filepath.Join(folder, v.name+".log")
+			if v.content != nil {
+				s.NoError(os.WriteFile(path, []byte(*v.content), 0666))
+			}
+			s.NoError(newRepairer([]byte(v.lineEnd)).Repair(path))
+			b, err := os.ReadFile(path)
+			if v.content == nil {
+				s.ErrorIs(err, os.ErrNotExist)
+				return
+			}
+			s.NoError(err)
+			s.Equal(v.want, string(b))
+		})
+	}
+}
+
+func (s *saverSuite) TestSaveRepairs() {
+	sep := runtimeops.GetSep()
+	folder := s.T().TempDir()
+	t := time.Date(2023, 11, 23, 10, 0, 0, 0, time.Local)
+	id := uuid.New()
+	line, err := TextEncoder{}.Encode(model.WrappedLog{T: t, UW: model.UUIDWrapper{UUID: id}, L: "before crash"})
+	s.NoError(err)
+	current := filepath.Join(folder, "2023-11-23_all.log")
+	s.NoError(os.WriteFile(current, append(line, line[:30]...), 0666))
+
+	sv := NewSaverWithConfig(Config{Folder: folder, Sep: sep, Limit: 1000})
+	s.NoError(sv.Save(model.WrappedLog{T: t, UW: model.UUIDWrapper{UUID: id}, L: "after restart"}))
+	s.NoError(sv.Save(model.WrappedLog{T: t, UW: model.UUIDWrapper{UUID: id}, L: "next"}))
+	s.NoError(sv.Close())
+
+	got := make([]string, 0)
+	s.NoError(NewReader(folder, sep, nil).Find(model.LogQuery{}, func(wl model.WrappedLog, _ string) error {
+		got = append(got, wl.L)
+		return nil
+	}))
+	// partial line lost its message, it is not parsed as record
+	s.Equal([]string{"before crash", "after restart", "next"}, got)
+	b, err := os.ReadFile(current)
+	s.NoError(err)
+	s.Contains(string(b), string(line[:30])+" [truncated]\r\n")
+}
+
+func ptr(s string) *string {
+	return &s
+}
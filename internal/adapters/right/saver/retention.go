@@ -0,0 +1,173 @@
+package saver
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+// Retainer implementation
+
+const (
+	gzExt  = ".gz"
+	tmpExt = ".tmp"
+)
+
+type retainer struct {
+	folder  string
+	sep     string
+	current func(string) string
+	prefix  func(string) string
+	now     func() time.Time
+}
+
+// newRetainer returns Retainer of files in folder, current returns file of stream being written,
+// prefix returns file prefix of stream
+func newRetainer(folder, sep string, current, prefix func(string) string) *retainer {
+	return &retainer{
+		folder:  folder,
+		sep:     sep,
+		current: current,
+		prefix:  prefix,
+		now:     time.Now,
+	}
+}
+
+// Compress replaces file with its gzipped copy, file is removed only after copy is complete
+func (r *retainer) Compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("in saver.Compress unable to open %s: %w", path, err)
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("in saver.Compress unable to stat %s: %w", path, err)
+	}
+
+	tmp := path + gzExt + tmpExt
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("in saver.Compress unable to create %s: %w", tmp, err)
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("in saver.Compress unable to write %s: %w", tmp, err)
+	}
+	err = os.Rename(tmp, path+gzExt)
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("in saver.Compress unable to rename %s: %w", tmp, err)
+	}
+	// compressed file keeps modification time, files are ordered by it
+	err = os.Chtimes(path+gzExt, fi.ModTime(), fi.ModTime())
+	if err != nil {
+		return fmt.Errorf("in saver.Compress unable to set time of %s: %w", path+gzExt, err)
+	}
+	src.Close()
+	return os.Remove(path)
+}
+
+// Enforce compresses rotated files of stream if p says so and removes the oldest ones exceeding p.
+// Current file of stream is neither compressed nor counted.
+func (r *retainer) Enforce(stream string, p model.RetentionPolicy) error {
+	files, err := r.rotated(stream)
+	if err != nil {
+		return err
+	}
+	errs := make([]error, 0)
+	if p.Compress {
+		for i, v := range files {
+			if strings.HasSuffix(v.path, gzExt) {
+				continue
+			}
+			err = r.Compress(v.path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			fi, err := os.Stat(v.path + gzExt)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			files[i] = logFile{path: v.path + gzExt, size: fi.Size(), mod: v.mod}
+		}
+	}
+
+	// newest first
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].mod.Equal(files[j].mod) {
+			return files[i].mod.After(files[j].mod)
+		}
+		return files[i].path > files[j].path
+	})
+	var total int64
+	now := r.now()
+	for i, v := range files {
+		total += v.size
+		if (p.MaxFiles > 0 && i >= p.MaxFiles) ||
+			(p.MaxBytes > 0 && total > p.MaxBytes) ||
+			(p.MaxAge > 0 && now.Sub(v.mod) > p.MaxAge) {
+			err = os.Remove(v.path)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("in saver.Enforce unable to remove %s: %w", v.path, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type logFile struct {
+	path string
+	size int64
+	mod  time.Time
+	info os.FileInfo
+}
+
+// rotated returns files of stream except the current one
+func (r *retainer) rotated(stream string) ([]logFile, error) {
+	entries, err := os.ReadDir(r.folder)
+	if err != nil {
+		return nil, fmt.Errorf("in saver.Enforce unable to read %s: %w", r.folder, err)
+	}
+	re := streamFileRe(r.prefix(stream))
+	current := r.current(stream)
+	files := make([]logFile, 0)
+	for _, v := range entries {
+		path := r.folder + r.sep + v.Name()
+		if v.IsDir() || !re.MatchString(v.Name()) || path == current {
+			continue
+		}
+		fi, err := v.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, logFile{path: path, size: fi.Size(), mod: fi.ModTime()})
+	}
+	return files, nil
+}
+
+// streamFileRe matches current, rotated and compressed file names of stream prefix
+func streamFileRe(prefix string) *regexp.Regexp {
+	return regexp.MustCompile(`^.+_` + regexp.QuoteMeta(prefix) + `(\.\d+)?\.log(\.gz)?$`)
+}
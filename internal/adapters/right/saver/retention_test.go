@@ -0,0 +1,142 @@
+package saver
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/runtimeops"
+)
+
+func (s *saverSuite) TestEnforce() {
+	sep := runtimeops.GetSep()
+	now := time.Date(2023, 11, 23, 12, 0, 0, 0, time.UTC)
+	files := []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{"2023-11-23_all.log", 10, 0},
+		{"23.11.23T11.00.00.000_all.log", 10, time.Hour},
+		{"23.11.23T10.00.00.000_all.log.gz", 10, 2 * time.Hour},
+		{"23.11.23T09.00.00.000_all.log", 10, 3 * time.Hour},
+		{"23.11.22T09.00.00.000_all.log", 10, 27 * time.Hour},
+		{"23.11.22T09.00.00.000_err.log", 10, 27 * time.Hour},
+	}
+
+	tt := []struct {
+		name      string
+		policy    model.RetentionPolicy
+		wantFiles []string
+	}{
+		{
+			name:   "not limited",
+			policy: model.RetentionPolicy{},
+			wantFiles: []string{
+				"2023-11-23_all.log", "23.11.22T09.00.00.000_all.log", "23.11.22T09.00.00.000_err.log",
+				"23.11.23T09.00.00.000_all.log", "23.11.23T10.00.00.000_all.log.gz", "23.11.23T11.00.00.000_all.log",
+			},
+		},
+		{
+			name:      "max files",
+			policy:    model.RetentionPolicy{MaxFiles: 2},
+			wantFiles: []string{"2023-11-23_all.log", "23.11.22T09.00.00.000_err.log", "23.11.23T10.00.00.000_all.log.gz", "23.11.23T11.00.00.000_all.log"},
+		},
+		{
+			name:      "max bytes",
+			policy:    model.RetentionPolicy{MaxBytes: 35},
+			wantFiles: []string{"2023-11-23_all.log", "23.11.22T09.00.00.000_err.log", "23.11.23T09.00.00.000_all.log", "23.11.23T10.00.00.000_all.log.gz", "23.11.23T11.00.00.000_all.log"},
+		},
+		{
+			name:      "max age",
+			policy:    model.RetentionPolicy{MaxAge: 24 * time.Hour},
+			wantFiles: []string{"2023-11-23_all.log", "23.11.22T09.00.00.000_err.log", "23.11.23T09.00.00.000_all.log", "23.11.23T10.00.00.000_all.log.gz", "23.11.23T11.00.00.000_all.log"},
+		},
+		{
+			name:   "compress",
+			policy: model.RetentionPolicy{Compress: true, MaxFiles: 3},
+			wantFiles: []string{
+				"2023-11-23_all.log", "23.11.22T09.00.00.000_err.log",
+				"23.11.23T09.00.00.000_all.log.gz", "23.11.23T10.00.00.000_all.log.gz", "23.11.23T11.00.00.000_all.log.gz",
+			},
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			folder := s.T().TempDir()
+			for _, w := range files {
+				path := filepath.Join(folder, w.name)
+				s.NoError(os.WriteFile(path, []byte(strings.Repeat("x", w.size)), 0666))
+				s.NoError(os.Chtimes(path, now.Add(-w.age), now.Add(-w.age)))
+			}
+			r := newRetainer(folder, sep, func(string) string { return folder + sep + "2023-11-23_all.log" }, func(s string) string { return s })
+			r.now = func() time.Time { return now }
+
+			s.NoError(r.Enforce("all", v.policy))
+			s.Equal(v.wantFiles, dirNames(s, folder))
+		})
+	}
+}
+
+func (s *saverSuite) TestCompress() {
+	folder := s.T().TempDir()
+	path := filepath.Join(folder, "23.11.23T11.00.00.000_all.log")
+	s.NoError(os.WriteFile(path, []byte("line 1\r\nline 2\r\n"), 0666))
+
+	s.NoError(newRetainer(folder, runtimeops.GetSep(), func(string) string { return "" }, func(s string) string { return s }).Compress(path))
+	s.Equal([]string{"23.11.23T11.00.00.000_all.log.gz"}, dirNames(s, folder))
+	s.Equal("line 1\r\nline 2\r\n", gunzip(s, path+".gz"))
+}
+
+func (s *saverSuite) TestSaveRetention() {
+	sep := runtimeops.GetSep()
+	folder := s.T().TempDir()
+	sv := NewSaverWithConfig(Config{
+		Folder:    folder,
+		Sep:       sep,
+		Limit:     200,
+		Retention: map[string]model.RetentionPolicy{"all": {MaxFiles: 2, Compress: true}},
+	})
+	now := time.Now()
+	for i := 0; i < 30; i++ {
+		s.NoError(sv.Save(model.WrappedLog{T: now, UW: model.UUIDWrapper{UUID: uuid.New()}, L: "logloglog"}))
+	}
+	s.NoError(sv.Close())
+
+	names := dirNames(s, folder)
+	s.Len(names, 3)
+	s.Contains(names, now.Format(dateLayout)+"_all.log")
+	for _, v := range names {
+		if v != now.Format(dateLayout)+"_all.log" {
+			s.True(strings.HasSuffix(v, ".gz"), v)
+		}
+	}
+}
+
+func dirNames(s *saverSuite, folder string) []string {
+	entries, err := os.ReadDir(folder)
+	s.NoError(err)
+	names := make([]string, 0, len(entries))
+	for _, v := range entries {
+		names = append(names, v.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func gunzip(s *saverSuite, path string) string {
+	f, err := os.Open(path)
+	s.NoError(err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	s.NoError(err)
+	b, err := io.ReadAll(zr)
+	s.NoError(err)
+	return string(b)
+}
@@ -0,0 +1,110 @@
+package saver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+// Rotator implementation
+
+const (
+	hourLayout = "2006-01-02T15"
+	// seqWidth keeps names sorted while there are less than 10000 files in period
+	seqWidth = 4
+)
+
+type period struct {
+	name string
+	seq  int
+}
+
+type rotator struct {
+	folder string
+	sep    string
+	layout string
+	loc    *time.Location
+	// current holds period and sequence number of file last returned for prefix
+	current map[string]period
+}
+
+// newRotator returns Rotator naming files "<period>_<prefix>.<seq>.log",
+// so that names sort in order files were written
+func newRotator(folder, sep string, p model.RotationPolicy) (*rotator, error) {
+	r := &rotator{
+		folder:  folder,
+		sep:     sep,
+		loc:     p.Location,
+		current: make(map[string]period),
+	}
+	switch p.Interval {
+	case model.RotateHourly:
+		r.layout = hourLayout
+	case model.RotateDaily:
+		r.layout = dateLayout
+	default:
+		return nil, fmt.Errorf("unknown rotation interval %q", p.Interval)
+	}
+	if r.loc == nil {
+		r.loc = time.Local
+	}
+	return r, nil
+}
+
+// Next returns file of prefix to write line of size at t into.
+// Next file of period is used if current one would exceed limit, limit <= 0 does not limit size.
+func (r *rotator) Next(prefix string, t time.Time, size, limit int64) (string, error) {
+	name := t.In(r.loc).Format(r.layout)
+	p, ok := r.current[prefix]
+	if !ok || p.name != name {
+		seq, err := r.lastSeq(prefix, name)
+		if err != nil {
+			return "", err
+		}
+		p = period{name: name, seq: seq}
+	}
+	path := r.path(prefix, p)
+	fi, err := os.Stat(path)
+	switch {
+	case err == nil && limit > 0 && fi.Size() > 0 && fi.Size()+size > limit:
+		p.seq++
+		path = r.path(prefix, p)
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		return "", fmt.Errorf("in saver.Next unable to stat %s: %w", path, err)
+	}
+	r.current[prefix] = p
+	return path, nil
+}
+
+func (r *rotator) path(prefix string, p period) string {
+	return fmt.Sprintf("%s%s%s_%s.%0*d.log", r.folder, r.sep, p.name, prefix, seqWidth, p.seq)
+}
+
+// lastSeq returns number of the last file of period, the next one if it is already compressed
+func (r *rotator) lastSeq(prefix, name string) (int, error) {
+	entries, err := os.ReadDir(r.folder)
+	if err != nil {
+		return 0, fmt.Errorf("in saver.Next unable to read %s: %w", r.folder, err)
+	}
+	re := regexp.MustCompile(`^` + regexp.QuoteMeta(name+"_"+prefix) + `\.(\d+)\.log(\.gz)?$`)
+	seq, compressed := 0, false
+	for _, v := range entries {
+		m := re.FindStringSubmatch(v.Name())
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		if n > seq || (n == seq && !compressed) {
+			seq, compressed = n, m[2] != ""
+		}
+	}
+	if compressed {
+		seq++
+	}
+	return seq, nil
+}
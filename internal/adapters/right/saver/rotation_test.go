@@ -0,0 +1,109 @@
+package saver
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/runtimeops"
+)
+
+func (s *saverSuite) TestRotatorNext() {
+	sep := runtimeops.GetSep()
+	folder := s.T().TempDir()
+	msk := time.FixedZone("MSK", 3*60*60)
+	t := time.Date(2023, 11, 23, 20, 30, 0, 0, time.UTC)
+
+	_, err := newRotator(folder, sep, model.RotationPolicy{Interval: "weekly"})
+	s.Error(err)
+
+	r, err := newRotator(folder, sep, model.RotationPolicy{Interval: model.RotateHourly, Location: msk})
+	s.NoError(err)
+
+	write := func(path string, n int) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+		s.NoError(err)
+		f.WriteString(strings.Repeat("x", n))
+		f.Close()
+	}
+	tt := []struct {
+		name     string
+		t        time.Time
+		size     int64
+		limit    int64
+		wantName string
+	}{
+		{name: "first file of period in time zone", t: t, size: 10, limit: 25, wantName: "2023-11-23T23_all.0000.log"},
+		{name: "same file", t: t.Add(time.Minute), size: 10, limit: 25, wantName: "2023-11-23T23_all.0000.log"},
+		{name: "size limit", t: t.Add(2 * time.Minute), size: 10, limit: 25, wantName: "2023-11-23T23_all.0001.log"},
+		{name: "next hour", t: t.Add(time.Hour), size: 10, limit: 25, wantName: "2023-11-24T00_all.0000.log"},
+		{name: "not limited", t: t.Add(time.Hour), size: 1000, limit: 0, wantName: "2023-11-24T00_all.0000.log"},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			path, err := r.Next("all", v.t, v.size, v.limit)
+			s.NoError(err)
+			s.Equal(filepath.Join(folder, v.wantName), path)
+			write(path, int(v.size))
+		})
+	}
+
+	// new rotator continues numbering, compressed file is not appended
+	s.NoError(newRetainer(folder, sep, nil, nil).Compress(filepath.Join(folder, "2023-11-24T00_all.0000.log")))
+	r, err = newRotator(folder, sep, model.RotationPolicy{Interval: model.RotateHourly, Location: msk})
+	s.NoError(err)
+	path, err := r.Next("all", t.Add(time.Hour), 10, 25)
+	s.NoError(err)
+	s.Equal(filepath.Join(folder, "2023-11-24T00_all.0001.log"), path)
+
+	r, err = newRotator(folder, sep, model.RotationPolicy{Interval: model.RotateDaily, Location: time.UTC})
+	s.NoError(err)
+	path, err = r.Next("err", t, 10, 25)
+	s.NoError(err)
+	s.Equal(filepath.Join(folder, "2023-11-23_err.0000.log"), path)
+}
+
+func (s *saverSuite) TestSaveRotation() {
+	sep := runtimeops.GetSep()
+	folder := s.T().TempDir()
+	sv := NewSaverWithConfig(Config{
+		Folder:   folder,
+		Sep:      sep,
+		Limit:    200,
+		Rotation: model.RotationPolicy{Interval: model.RotateHourly, Location: time.UTC},
+	})
+
+	start := time.Date(2023, 11, 23, 10, 50, 0, 0, time.UTC)
+	for i := 0; i < 40; i++ {
+		s.NoError(sv.Save(model.WrappedLog{T: start.Add(time.Duration(i) * time.Minute), UW: model.UUIDWrapper{UUID: uuid.New()}, L: "logloglog"}))
+	}
+	s.NoError(sv.Close())
+
+	// sorted names give lines in order they were written, the last one is current
+	names := dirNames(s, folder)
+	current := filepath.Join(folder, names[len(names)-1])
+	s.Equal(current, sv.PathMap["all"])
+	s.True(strings.HasPrefix(names[len(names)-1], "2023-11-23T11_all."))
+	s.Contains(names, "2023-11-23T10_all.0000.log")
+	s.Contains(names, "2023-11-23T10_all.0003.log")
+	s.Contains(names, "2023-11-23T11_all.0000.log")
+	s.True(sort.StringsAreSorted(names))
+	times := make([]string, 0, 40)
+	for _, v := range names {
+		b, err := os.ReadFile(filepath.Join(folder, v))
+		s.NoError(err)
+		for _, w := range strings.Split(strings.TrimSuffix(string(b), "\r\n"), "\r\n") {
+			times = append(times, w[:len(logTimeLayout)])
+		}
+	}
+	s.Len(times, 40)
+	s.True(sort.StringsAreSorted(times))
+
+	// current file is found on start
+	sv = NewSaverWithConfig(Config{Folder: folder, Sep: sep, Limit: 200, Rotation: model.RotationPolicy{Interval: model.RotateHourly, Location: time.UTC}})
+	s.Equal(current, sv.PathMap["all"])
+}
@@ -0,0 +1,54 @@
+package saver
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+// Router implementation
+
+// DefaultStreams are all records, errors and signals
+var DefaultStreams = []model.LogStream{
+	{Name: "all"},
+	{Name: "err", Levels: []model.Level{model.LevelError}},
+	{Name: "sig", Levels: []model.Level{model.LevelSignal}},
+}
+
+// AccessStream is stream of access log records written by Receiver.AccessLog
+var AccessStream = model.LogStream{Name: "access", Fields: map[string]string{model.AccessStreamField: "access"}}
+
+type streamRouter []model.LogStream
+
+// Streams returns names of streams wl is written to, in order of declaration
+func (r streamRouter) Streams(wl model.WrappedLog) []string {
+	level := model.ParseLevel(wl.UW.Str)
+	res := make([]string, 0, 2)
+	for _, v := range r {
+		if len(v.Levels) > 0 && !slices.Contains(v.Levels, level) {
+			continue
+		}
+		if !hasFields(wl, v.Fields) {
+			continue
+		}
+		res = append(res, v.Name)
+	}
+	return res
+}
+
+func hasFields(wl model.WrappedLog, fields map[string]string) bool {
+	for i, v := range fields {
+		found := false
+		for _, w := range wl.F {
+			if w.Key == i && fmt.Sprint(fieldValue(w.Value)) == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
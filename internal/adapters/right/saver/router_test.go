@@ -0,0 +1,96 @@
+package saver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/runtimeops"
+)
+
+func (s *saverSuite) TestStreams() {
+	r := streamRouter(append(append([]model.LogStream{}, DefaultStreams...),
+		model.LogStream{Name: "warn", Levels: []model.Level{model.LevelWarn, model.LevelError}},
+		AccessStream,
+		model.LogStream{Name: "slow", Fields: map[string]string{"stream": "access", "slow": "true"}},
+	))
+
+	tt := []struct {
+		name string
+		wl   model.WrappedLog
+		want []string
+	}{
+		{name: "info", wl: model.WrappedLog{}, want: []string{"all"}},
+		{name: "error", wl: model.WrappedLog{UW: model.UUIDWrapper{Str: "ERROR"}}, want: []string{"all", "err", "warn"}},
+		{name: "signal", wl: model.WrappedLog{UW: model.UUIDWrapper{Str: "SIGNAL"}}, want: []string{"all", "sig"}},
+		{name: "warn", wl: model.WrappedLog{UW: model.UUIDWrapper{Str: "WARN"}}, want: []string{"all", "warn"}},
+		{name: "access", wl: model.WrappedLog{F: []model.Field{{Key: "stream", Value: "access"}, {Key: "slow", Value: false}}}, want: []string{"all", "access"}},
+		{name: "slow access", wl: model.WrappedLog{F: []model.Field{{Key: "stream", Value: "access"}, {Key: "slow", Value: true}}}, want: []string{"all", "access", "slow"}},
+		{name: "access entry", wl: model.WrappedLog{F: model.AccessEntry{Status: 200, Slow: true}.Fields()}, want: []string{"all", "access", "slow"}},
+		{name: "other field value", wl: model.WrappedLog{F: []model.Field{{Key: "stream", Value: "audit"}}}, want: []string{"all"}},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			s.Equal(v.want, r.Streams(v.wl))
+		})
+	}
+}
+
+func (s *saverSuite) TestSaveStreams() {
+	sep := runtimeops.GetSep()
+	folder := s.T().TempDir()
+	now := time.Now()
+	date := now.Format(dateLayout)
+
+	// current file of declared stream is found on start
+	s.NoError(os.WriteFile(filepath.Join(folder, date+"_acc.log"), []byte("old\r\n"), 0666))
+
+	sv := NewSaverWithConfig(Config{
+		Folder: folder,
+		Sep:    sep,
+		Limit:  1 << 20,
+		Streams: []model.LogStream{
+			{Name: "warn", Levels: []model.Level{model.LevelWarn}},
+			{Name: "access", Prefix: "acc", Limit: 150, Fields: map[string]string{"stream": "access"}},
+			{Name: "err", Prefix: "errors", Levels: []model.Level{model.LevelError}},
+			{Name: "bad", Prefix: "a_b"},
+			{Name: "copy", Prefix: "acc"},
+		},
+	})
+	s.Equal(folder+sep+date+"_acc.log", sv.PathMap["access"])
+	s.NotContains(sv.PathMap, "bad")
+	s.NotContains(sv.PathMap, "copy")
+
+	u := uuid.New()
+	s.NoError(sv.Save(model.WrappedLog{T: now, UW: model.UUIDWrapper{Str: "WARN", UUID: u}, L: "cross-user access"}))
+	s.NoError(sv.Save(model.WrappedLog{T: now, UW: model.UUIDWrapper{Str: "ERROR", UUID: u}, L: "unable to save"}))
+	for i := 0; i < 3; i++ {
+		s.NoError(sv.Save(model.WrappedLog{T: now, UW: model.UUIDWrapper{UUID: u}, L: "GET /api/v1/notifications 200", F: []model.Field{{Key: "stream", Value: "access"}}}))
+	}
+	s.NoError(sv.Close())
+
+	read := func(name string) string {
+		b, err := os.ReadFile(filepath.Join(folder, name))
+		s.NoError(err)
+		return string(b)
+	}
+	s.Equal(5, strings.Count(read(date+"_all.log"), "\r\n"))
+	s.Contains(read(date+"_warn.log"), "cross-user access")
+	s.Equal(1, strings.Count(read(date+"_warn.log"), "\r\n"))
+	s.Contains(read(date+"_errors.log"), "unable to save")
+	s.NoFileExists(filepath.Join(folder, date+"_err.log"))
+
+	// access stream has its own limit, so it was rotated while all was not
+	names := dirNames(s, folder)
+	rotated := 0
+	for _, v := range names {
+		if strings.HasSuffix(v, "_acc.log") && v != date+"_acc.log" {
+			rotated++
+		}
+	}
+	s.Greater(rotated, 0)
+	s.Contains(names, date+"_acc.log")
+}
@@ -1,9 +1,515 @@
 package saver
 
-import "github.com/vynovikov/study/notifications_example/internal/pkg/model"
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
 
 type Saver interface {
 	Save(model.WrappedLog) error
+	Flush() error
+	Close() error
+}
+
+// Formats log line, plain text or JSON
+type Encoder interface {
+	Encode(model.WrappedLog) ([]byte, error)
+}
+
+// Log destination: file with rotation, stdout or syslog forwarder
+type Sink interface {
+	Write(model.WrappedLog, []byte) error
+	Close() error
+}
+
+// Applies field and pattern rules to log for stream, returns fired rule names
+type Redactor interface {
+	Redact(string, model.WrappedLog) (model.WrappedLog, []string)
+}
+
+// Picks configured streams for log by level and fields
+type Router interface {
+	Streams(model.WrappedLog) []string
+}
+
+// Returns path of file to write into by period and size
+type Rotator interface {
+	Next(string, time.Time, int64, int64) (string, error)
+}
+
+// Gzips rotated files and removes old ones per stream, never touching the current file
+type Retainer interface {
+	Compress(string) error
+	Enforce(string, model.RetentionPolicy) error
+}
+
+// Detects partial last line in file and repairs it before appending
+type Repairer interface {
+	Repair(string) error
+}
+
+// Returns number of records every redaction rule fired on by stream
+type RedactionCounter interface {
+	Redactions() map[string]map[string]uint64
+}
+
+// Reads Saver folder, gzipped rotations included. Callback gets record and line it is parsed from.
+type Reader interface {
+	Find(model.LogQuery, func(model.WrappedLog, string) error) error
+	Follow(context.Context, model.LogQuery, func(model.WrappedLog, string) error) error
 }
 
 // Saver implementation
+
+const (
+	dateLayout    = "2006-01-02"
+	rotatedLayout = "06.01.02T15.04.05.000"
+	logTimeLayout = "2006-01-02 15:04:05"
+)
+
+// prefixRe limits file prefixes of streams, so that date, prefix and sequence number in file name are not mixed up
+var prefixRe = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// Config holds folder of log files with its path separator, size limit of a file and line format
+type Config struct {
+	Folder string
+	Sep    string
+	Limit  int64
+	// Encoder formats lines, TextEncoder if not set
+	Encoder Encoder
+	// Retention holds policy of rotated files of stream, files of streams without policy are kept
+	Retention map[string]model.RetentionPolicy
+	// Streams are added to DefaultStreams, stream with name of default one replaces it
+	Streams []model.LogStream
+	// Rotation starts new file every hour or day. Without it current file has date in its name
+	// and is renamed to its rotation time name when it reaches limit.
+	Rotation model.RotationPolicy
+	// Sinks get every record besides files, no files are written if Folder is empty
+	Sinks []Sink
+	// Sync is fsync policy of files, model.SyncNever if not set.
+	// With model.SyncInterval files written are synced every SyncInterval, DefaultSyncInterval if zero.
+	Sync         model.SyncPolicy
+	SyncInterval time.Duration
+	// ErrorOutput gets write failures, os.Stderr if not set
+	ErrorOutput io.Writer
+	// Redaction holds rules by stream, DefaultRedaction if nil. Empty map turns redaction off.
+	// RedactionKey is HMAC key of hashed values, random if empty.
+	Redaction    map[string][]model.RedactionRule
+	RedactionKey []byte
+}
+
+type saver struct {
+	mu        sync.Mutex
+	Folder    string
+	Sep       string
+	PathMap   map[string]string
+	Limit     int64
+	Encoder   Encoder
+	Retention map[string]model.RetentionPolicy
+	streams   map[string]model.LogStream
+	router    Router
+	rotator   *rotator
+	retainer  Retainer
+	repairer  Repairer
+	redactor  *redactor
+	sinks     []Sink
+	// repaired holds file of stream checked by repairer
+	repaired   map[string]string
+	syncPolicy model.SyncPolicy
+	fsync      func(*os.File) error
+	// dirty holds files to sync with model.SyncInterval
+	dirty    map[string]bool
+	syncStop chan struct{}
+	syncDone chan struct{}
+	// errOut gets write failures, failure is error writing fails with, lost counts records lost meanwhile
+	errOut  io.Writer
+	failure error
+	lost    int
+	// rotated holds streams whose current file was changed by getFile
+	rotated map[string]bool
+	// maint serializes retention, bg counts its goroutines
+	maint sync.Mutex
+	bg    sync.WaitGroup
+}
+
+// NewSaver returns Saver writing text lines into folder, files are rotated when they reach limit
+func NewSaver(folder, sep string, limit int64) *saver {
+	return NewSaverWithConfig(Config{Folder: folder, Sep: sep, Limit: limit})
+}
+
+// NewSaverWithConfig creates folder if needed and finds current log files in it.
+// If folder looks like file path, its directory is used. If folder is empty, records go to sinks only.
+// PathMap holds current file of every stream, or folder if there is no file yet.
+func NewSaverWithConfig(c Config) *saver {
+	folder, sep := c.Folder, c.Sep
+	if filepath.Ext(folder) != "" {
+		folder = filepath.Dir(folder)
+	}
+	if c.Encoder == nil {
+		c.Encoder = TextEncoder{}
+	}
+	if c.Sync == "" {
+		c.Sync = model.SyncNever
+	}
+	if c.ErrorOutput == nil {
+		c.ErrorOutput = os.Stderr
+	}
+	s := &saver{
+		Folder:     folder,
+		Sep:        sep,
+		PathMap:    make(map[string]string),
+		Limit:      c.Limit,
+		Encoder:    c.Encoder,
+		Retention:  c.Retention,
+		streams:    make(map[string]model.LogStream),
+		rotated:    make(map[string]bool),
+		sinks:      c.Sinks,
+		repaired:   make(map[string]string),
+		syncPolicy: c.Sync,
+		fsync:      (*os.File).Sync,
+		dirty:      make(map[string]bool),
+		errOut:     c.ErrorOutput,
+	}
+	s.router = s.declare(append(append([]model.LogStream{}, DefaultStreams...), c.Streams...))
+	if c.Redaction == nil {
+		c.Redaction = DefaultRedaction
+	}
+	s.redactor = newRedactor(c.Redaction, c.RedactionKey)
+	if folder == "" {
+		return s
+	}
+	err := os.MkdirAll(folder, 0777)
+	if err != nil {
+		log.Printf("in saver.NewSaver unable to create folder %s: %v", folder, err)
+	}
+	s.repairer = newRepairer(lineEnd(c.Encoder))
+	if c.Sync == model.SyncInterval {
+		if c.SyncInterval <= 0 {
+			c.SyncInterval = DefaultSyncInterval
+		}
+		s.syncStop, s.syncDone = make(chan struct{}), make(chan struct{})
+		go s.syncLoop(c.SyncInterval, s.syncStop, s.syncDone)
+	}
+	if c.Rotation.Interval != "" {
+		s.rotator, err = newRotator(folder, sep, c.Rotation)
+		if err != nil {
+			log.Printf("in saver.NewSaver %v, files are rotated by size only", err)
+		}
+	}
+	s.retainer = newRetainer(folder, sep, func(stream string) string {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.PathMap[stream]
+	}, func(stream string) string {
+		return s.streams[stream].Prefix
+	})
+	defer func() {
+		for i := range s.Retention {
+			s.retain(i)
+		}
+	}()
+	prefixes := make([]string, 0, len(s.streams))
+	byPrefix := make(map[string]string, len(s.streams))
+	for i, v := range s.streams {
+		s.PathMap[i] = folder
+		prefixes = append(prefixes, regexp.QuoteMeta(v.Prefix))
+		byPrefix[v.Prefix] = i
+	}
+	currentFileRe := regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(T\d{2})?_(` + strings.Join(prefixes, "|") + `)(\.\d+)?\.log$`)
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		log.Printf("in saver.NewSaver unable to read folder %s: %v", folder, err)
+		return s
+	}
+	names := make([]string, 0, len(entries))
+	for _, v := range entries {
+		if !v.IsDir() && currentFileRe.MatchString(v.Name()) {
+			names = append(names, v.Name())
+		}
+	}
+	// latest date wins
+	sort.Strings(names)
+	for _, v := range names {
+		stream := byPrefix[currentFileRe.FindStringSubmatch(v)[2]]
+		s.PathMap[stream] = folder + sep + v
+	}
+	return s
+}
+
+// declare returns Router of valid streams, later stream with the same name replaces earlier one.
+// Streams with invalid or already used prefix are skipped.
+func (s *saver) declare(streams []model.LogStream) Router {
+	byName := make(map[string]int, len(streams))
+	r := make(streamRouter, 0, len(streams))
+	for _, v := range streams {
+		if v.Prefix == "" {
+			v.Prefix = v.Name
+		}
+		if !prefixRe.MatchString(v.Prefix) {
+			log.Printf("in saver.NewSaver stream %q has invalid prefix %q", v.Name, v.Prefix)
+			continue
+		}
+		if i, ok := byName[v.Name]; ok {
+			r[i] = v
+			continue
+		}
+		byName[v.Name] = len(r)
+		r = append(r, v)
+	}
+	used := make(map[string]bool, len(r))
+	res := make(streamRouter, 0, len(r))
+	for _, v := range r {
+		if used[v.Prefix] {
+			log.Printf("in saver.NewSaver stream %q has prefix %q of another stream", v.Name, v.Prefix)
+			continue
+		}
+		used[v.Prefix] = true
+		s.streams[v.Name] = v
+		res = append(res, v)
+	}
+	return res
+}
+
+// Save writes log line to files of streams it belongs to and to every sink
+func (s *saver) Save(wl model.WrappedLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.save(wl)
+}
+
+// SaveBatch writes records in order holding lock once
+func (s *saver) SaveBatch(wls []model.WrappedLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := make([]error, 0)
+	for _, v := range wls {
+		err := s.save(v)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *saver) save(wl model.WrappedLog) error {
+	errs := make([]error, 0)
+	if len(s.sinks) > 0 {
+		// sinks get record redacted as for stream all
+		swl, _ := s.redactor.redact("all", "sinks", wl)
+		line, err := s.Encoder.Encode(swl)
+		if err != nil {
+			return err
+		}
+		for _, v := range s.sinks {
+			err = v.Write(swl, line)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if s.Folder == "" {
+		return errors.Join(errs...)
+	}
+
+	lines, err := s.lines(wl)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	files, pathUpd, err := s.getFile(wl, lines, s.Limit)
+	defer func() {
+		for _, v := range files {
+			v.Close()
+		}
+	}()
+	if err != nil {
+		s.failed(s.Folder, err)
+		return errors.Join(append(errs, err)...)
+	}
+	for i, v := range files {
+		err = s.write(v, lines[i])
+		if err != nil {
+			s.failed(pathUpd[i], err)
+			return errors.Join(append(errs, fmt.Errorf("in saver.Save unable to write to %s: %w", pathUpd[i], err))...)
+		}
+	}
+	s.PathMap = pathUpd
+	for i := range s.rotated {
+		s.retain(i)
+		delete(s.rotated, i)
+	}
+	s.recovered()
+
+	return errors.Join(errs...)
+}
+
+// Flush syncs files written since last sync with model.SyncInterval
+func (s *saver) Flush() error {
+	if s.syncPolicy == model.SyncInterval {
+		s.syncDirty()
+	}
+	return nil
+}
+
+// Close waits for retention running in background, syncs files written since last sync and closes sinks
+func (s *saver) Close() error {
+	s.bg.Wait()
+	s.mu.Lock()
+	stop, done := s.syncStop, s.syncDone
+	s.syncStop = nil
+	s.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+		s.syncDirty()
+	}
+	errs := make([]error, 0)
+	for _, v := range s.sinks {
+		err := v.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Redactions returns number of records every redaction rule fired on by stream
+func (s *saver) Redactions() map[string]map[string]uint64 {
+	return s.redactor.Fired()
+}
+
+// retain enforces retention policy of stream in background, if stream has one
+func (s *saver) retain(stream string) {
+	p, ok := s.Retention[stream]
+	if !ok {
+		return
+	}
+	s.bg.Add(1)
+	go func() {
+		defer s.bg.Done()
+		s.maint.Lock()
+		defer s.maint.Unlock()
+
+		err := s.retainer.Enforce(stream, p)
+		if err != nil {
+			log.Printf("in saver.retain stream %s: %v", stream, err)
+		}
+	}()
+}
+
+// lines returns line of every stream wl belongs to, redacted by rules of stream
+func (s *saver) lines(wl model.WrappedLog) (map[string][]byte, error) {
+	res := make(map[string][]byte)
+	var plain []byte
+	for _, v := range s.router.Streams(wl) {
+		rwl, fired := s.redactor.Redact(v, wl)
+		if len(fired) > 0 {
+			line, err := s.Encoder.Encode(rwl)
+			if err != nil {
+				return nil, err
+			}
+			res[v] = line
+			continue
+		}
+		if plain == nil {
+			line, err := s.Encoder.Encode(wl)
+			if err != nil {
+				return nil, err
+			}
+			plain = line
+		}
+		res[v] = plain
+	}
+	return res, nil
+}
+
+// getFile opens current file of every stream wl belongs to.
+// File which would exceed limit after writing wl is renamed to its rotation time name
+// and new current file is created instead.
+func (s *saver) getFile(wl model.WrappedLog, lines map[string][]byte, limit int64) (map[string]*os.File, map[string]string, error) {
+	files := make(map[string]*os.File)
+	pathUpd := make(map[string]string, len(s.PathMap))
+	for i, v := range s.PathMap {
+		pathUpd[i] = v
+	}
+	var err error
+	for _, stream := range s.router.Streams(wl) {
+		st := s.streams[stream]
+		lineLen := int64(len(lines[stream]))
+		current := s.Folder + s.Sep + wl.T.Format(dateLayout) + "_" + st.Prefix + ".log"
+		streamLimit := limit
+		if st.Limit > 0 {
+			streamLimit = st.Limit
+		}
+
+		if s.rotator != nil {
+			current, err = s.rotator.Next(st.Prefix, wl.T, lineLen, streamLimit)
+			if err != nil {
+				return files, pathUpd, err
+			}
+		} else if fi, err := os.Stat(current); err == nil && fi.Size() > 0 && fi.Size()+lineLen > streamLimit {
+			err = os.Rename(current, s.rotatedName(st.Prefix, wl.T))
+			if err != nil {
+				return files, pathUpd, fmt.Errorf("in saver.getFile unable to rotate %s: %w", current, err)
+			}
+			s.rotated[stream] = true
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return files, pathUpd, fmt.Errorf("in saver.getFile unable to stat %s: %w", current, err)
+		}
+
+		if s.repaired[stream] != current {
+			err = s.repairer.Repair(current)
+			if err != nil {
+				return files, pathUpd, err
+			}
+			s.repaired[stream] = current
+		}
+
+		f, err := os.OpenFile(current, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+		if err != nil {
+			return files, pathUpd, fmt.Errorf("in saver.getFile unable to open %s: %w", current, err)
+		}
+		files[stream] = f
+		if pathUpd[stream] != current && pathUpd[stream] != s.Folder {
+			s.rotated[stream] = true
+		}
+		pathUpd[stream] = current
+	}
+
+	return files, pathUpd, nil
+}
+
+// lineEnd returns line end enc writes, "\r\n" or "\n"
+func lineEnd(enc Encoder) []byte {
+	b, err := enc.Encode(model.WrappedLog{})
+	if err == nil && bytes.HasSuffix(b, []byte("\r\n")) {
+		return []byte("\r\n")
+	}
+	return []byte("\n")
+}
+
+// rotatedName returns unused name for file of stream prefix rotated at t
+func (s *saver) rotatedName(prefix string, t time.Time) string {
+	base := s.Folder + s.Sep + t.Format(rotatedLayout) + "_" + prefix
+	name := base + ".log"
+	for i := 1; ; i++ {
+		if _, err := os.Stat(name); errors.Is(err, os.ErrNotExist) {
+			return name
+		}
+		name = fmt.Sprintf("%s.%d.log", base, i)
+	}
+}
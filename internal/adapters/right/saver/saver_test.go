@@ -12,6 +12,8 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/suite"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/runtimeops"
 )
 
 type saverSuite struct {
@@ -192,7 +194,9 @@ func (s *saverSuite) TestGetFile() {
 				}
 			}
 
-			files, pathUpd, err := sv.getFile(v.wl, v.limit)
+			lines, err := sv.lines(v.wl)
+			s.NoError(err)
+			files, pathUpd, err := sv.getFile(v.wl, lines, v.limit)
 			s.NoError(err)
 
 			for j, w := range v.wantPathUpd {
@@ -0,0 +1,70 @@
+package saver
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+// Console Sink implementation
+
+const consoleTimeLayout = "2006-01-02 15:04:05.000"
+
+// ANSI colors of levels
+var levelColors = map[model.Level]string{
+	model.LevelDebug:  "\x1b[90m",
+	model.LevelWarn:   "\x1b[33m",
+	model.LevelError:  "\x1b[31m",
+	model.LevelSignal: "\x1b[35m",
+}
+
+type consoleSink struct {
+	mu    sync.Mutex
+	w     io.Writer
+	color bool
+}
+
+// NewConsoleSink returns Sink writing "time LEVEL uuid message key=value" lines to w, level is colored if color is set
+func NewConsoleSink(w io.Writer, color bool) *consoleSink {
+	return &consoleSink{w: w, color: color}
+}
+
+// NewStdoutSink returns console Sink of stdout without colors, as containers collect it
+func NewStdoutSink() *consoleSink {
+	return NewConsoleSink(os.Stdout, false)
+}
+
+func (c *consoleSink) Write(wl model.WrappedLog, _ []byte) error {
+	l := model.ParseLevel(wl.UW.Str)
+	b := strings.Builder{}
+	b.WriteString(wl.T.Format(consoleTimeLayout) + " ")
+	if color, ok := levelColors[l]; ok && c.color {
+		b.WriteString(color + fmt.Sprintf("%-6s", levelName(wl.UW.Str)) + "\x1b[0m")
+	} else {
+		b.WriteString(fmt.Sprintf("%-6s", levelName(wl.UW.Str)))
+	}
+	if l != model.LevelSignal {
+		b.WriteString(" " + wl.UW.UUID.String())
+	}
+	b.WriteString(" " + wl.L)
+	for _, v := range wl.F {
+		b.WriteString(" " + v.Key + "=" + textValue(v.Value))
+	}
+	b.WriteString("\n")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := io.WriteString(c.w, b.String())
+	if err != nil {
+		return fmt.Errorf("in saver.Write unable to write to console: %w", err)
+	}
+	return nil
+}
+
+func (c *consoleSink) Close() error {
+	return nil
+}
@@ -0,0 +1,272 @@
+package saver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/runtimeops"
+)
+
+var (
+	sinkUUID = uuid.MustParse("6f0c2a3e-8f6b-4f52-9a57-3b1c8d9e1f20")
+	sinkTime = time.Date(2023, 11, 23, 10, 0, 1, 123456789, time.UTC)
+)
+
+func (s *saverSuite) TestConsoleSink() {
+	tt := []struct {
+		name  string
+		wl    model.WrappedLog
+		color bool
+		want  string
+	}{
+		{
+			name: "info",
+			wl:   model.WrappedLog{T: sinkTime, UW: model.UUIDWrapper{UUID: sinkUUID}, L: "saved", F: []model.Field{{Key: "n", Value: 2}}},
+			want: "2023-11-23 10:00:01.123 INFO   6f0c2a3e-8f6b-4f52-9a57-3b1c8d9e1f20 saved n=2\n",
+		},
+		{
+			name: "signal",
+			wl:   model.WrappedLog{T: sinkTime, UW: model.UUIDWrapper{Str: "SIGNAL"}, L: "stopping"},
+			want: "2023-11-23 10:00:01.123 SIGNAL stopping\n",
+		},
+		{
+			name:  "colored error",
+			wl:    model.WrappedLog{T: sinkTime, UW: model.UUIDWrapper{UUID: sinkUUID, Str: "ERROR"}, L: "failed", F: []model.Field{{Key: "err", Value: errors.New("no route")}}},
+			color: true,
+			want:  "2023-11-23 10:00:01.123 \x1b[31mERROR \x1b[0m 6f0c2a3e-8f6b-4f52-9a57-3b1c8d9e1f20 failed err=\"no route\"\n",
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			b := &bytes.Buffer{}
+			s.NoError(NewConsoleSink(b, v.color).Write(v.wl, nil))
+			s.Equal(v.want, b.String())
+		})
+	}
+}
+
+func (s *saverSuite) TestSyslogFormat() {
+	sk, err := NewSyslogSink(SyslogConfig{Network: "udp", Addr: "127.0.0.1:9", AppName: "notifications", Hostname: "host 1"})
+	s.NoError(err)
+	defer sk.Close()
+	pid := strconv.Itoa(os.Getpid())
+
+	tt := []struct {
+		name string
+		wl   model.WrappedLog
+		want string
+	}{
+		{
+			name: "info",
+			wl:   model.WrappedLog{T: sinkTime, UW: model.UUIDWrapper{UUID: sinkUUID}, L: "saved"},
+			want: `<134>1 2023-11-23T10:00:01.123456Z host_1 notifications ` + pid + ` - [fields@32473 uuid="6f0c2a3e-8f6b-4f52-9a57-3b1c8d9e1f20"] saved`,
+		},
+		{
+			name: "error with fields",
+			wl:   model.WrappedLog{T: sinkTime, UW: model.UUIDWrapper{UUID: sinkUUID, Str: "ERROR"}, L: "failed", F: []model.Field{{Key: "path", Value: `/a"b]`}, {Key: "bad key=", Value: 1}}},
+			want: `<131>1 2023-11-23T10:00:01.123456Z host_1 notifications ` + pid + ` - [fields@32473 uuid="6f0c2a3e-8f6b-4f52-9a57-3b1c8d9e1f20" path="/a\"b\]" bad_key_="1"] failed`,
+		},
+		{
+			name: "signal",
+			wl:   model.WrappedLog{T: sinkTime, UW: model.UUIDWrapper{Str: "SIGNAL"}, L: "stopping"},
+			want: `<133>1 2023-11-23T10:00:01.123456Z host_1 notifications ` + pid + ` - - stopping`,
+		},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			s.Equal(v.want, string(sk.format(v.wl)))
+		})
+	}
+
+	_, err = NewSyslogSink(SyslogConfig{Network: "http", Addr: "127.0.0.1:9"})
+	s.Error(err)
+}
+
+func (s *saverSuite) TestSyslogSink() {
+	dir := s.T().TempDir()
+	tt := []struct {
+		name    string
+		network string
+		addr    string
+	}{
+		{name: "tcp", network: "tcp", addr: "127.0.0.1:0"},
+		{name: "udp", network: "udp", addr: "127.0.0.1:0"},
+		{name: "unix", network: "unix", addr: filepath.Join(dir, "s.sock")},
+		{name: "unixgram", network: "unixgram", addr: filepath.Join(dir, "g.sock")},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			got := make(chan string, 10)
+			var addr string
+			switch v.network {
+			case "tcp", "unix":
+				ln, err := net.Listen(v.network, v.addr)
+				s.NoError(err)
+				defer ln.Close()
+				addr = ln.Addr().String()
+				go serveFrames(ln, got)
+			default:
+				pc, err := net.ListenPacket(v.network, v.addr)
+				s.NoError(err)
+				defer pc.Close()
+				addr = pc.LocalAddr().String()
+				go func() {
+					b := make([]byte, 64*1024)
+					for {
+						n, _, err := pc.ReadFrom(b)
+						if err != nil {
+							return
+						}
+						got <- string(b[:n])
+					}
+				}()
+			}
+
+			sk, err := NewSyslogSink(SyslogConfig{Network: v.network, Addr: addr})
+			s.NoError(err)
+			for i := 0; i < 3; i++ {
+				s.NoError(sk.Write(model.WrappedLog{T: sinkTime, UW: model.UUIDWrapper{UUID: sinkUUID}, L: "log " + strconv.Itoa(i)}, nil))
+			}
+			for i := 0; i < 3; i++ {
+				s.True(strings.HasSuffix(receiveMsg(s, got), "] log "+strconv.Itoa(i)))
+			}
+			s.NoError(sk.Close())
+			s.ErrorIs(sk.Write(model.WrappedLog{}, nil), ErrClosed)
+		})
+	}
+}
+
+func (s *saverSuite) TestSyslogReconnect() {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	s.NoError(err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	sk, err := NewSyslogSink(SyslogConfig{Network: "tcp", Addr: addr, Buffer: 3, RetryMin: time.Millisecond, RetryMax: 10 * time.Millisecond, CloseTimeout: 50 * time.Millisecond})
+	s.NoError(err)
+	write := func(l string) {
+		s.NoError(sk.Write(model.WrappedLog{T: sinkTime, UW: model.UUIDWrapper{UUID: sinkUUID}, L: l}, nil))
+	}
+
+	// collector is down, buffer keeps the newest messages
+	for i := 0; i < 5; i++ {
+		write("buffered " + strconv.Itoa(i))
+	}
+	s.Equal(uint64(2), sk.Dropped())
+
+	ln, err = net.Listen("tcp", addr)
+	s.NoError(err)
+	conns := make(chan net.Conn, 10)
+	got := make(chan string, 100)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- c
+			go readFrames(c, got)
+		}
+	}()
+	for i := 2; i < 5; i++ {
+		s.True(strings.HasSuffix(receiveMsg(s, got), "] buffered "+strconv.Itoa(i)))
+	}
+
+	// collector drops connection, sink connects again
+	(<-conns).Close()
+	var conn net.Conn
+	for i := 0; i < 100 && conn == nil; i++ {
+		write("after " + strconv.Itoa(i))
+		select {
+		case conn = <-conns:
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	s.NotNil(conn)
+	s.True(strings.Contains(receiveMsg(s, got), "] after "))
+
+	// collector is down on Close, buffered messages are dropped after CloseTimeout.
+	// The first write after connection is closed by peer can succeed, so probe goes first.
+	ln.Close()
+	conn.Close()
+	write("probe")
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		write("lost")
+	}
+	s.Error(sk.Close())
+}
+
+func (s *saverSuite) TestSaveSinks() {
+	sep := runtimeops.GetSep()
+	wl := model.WrappedLog{T: sinkTime, UW: model.UUIDWrapper{UUID: sinkUUID, Str: "ERROR"}, L: "failed"}
+
+	// no folder, sinks only
+	b := &bytes.Buffer{}
+	sv := NewSaverWithConfig(Config{Sep: sep, Limit: 100, Sinks: []Sink{NewConsoleSink(b, false)}})
+	s.NoError(sv.Save(wl))
+	s.NoError(sv.Close())
+	s.Equal("2023-11-23 10:00:01.123 ERROR  6f0c2a3e-8f6b-4f52-9a57-3b1c8d9e1f20 failed\n", b.String())
+	s.Empty(sv.PathMap)
+
+	// files and sink
+	folder := s.T().TempDir()
+	b.Reset()
+	sv = NewSaverWithConfig(Config{Folder: folder, Sep: sep, Limit: 100, Sinks: []Sink{NewConsoleSink(b, false)}})
+	s.NoError(sv.Save(wl))
+	s.NoError(sv.Close())
+	s.NotEmpty(b.String())
+	s.Equal([]string{"2023-11-23_all.log", "2023-11-23_err.log"}, dirNames(s, folder))
+}
+
+// serveFrames reads octet counted frames of every connection of ln
+func serveFrames(ln net.Listener, got chan<- string) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go readFrames(c, got)
+	}
+}
+
+func readFrames(c net.Conn, got chan<- string) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		l, err := r.ReadString(' ')
+		if err != nil {
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(l, " "))
+		if err != nil {
+			return
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		if err != nil {
+			return
+		}
+		got <- string(b)
+	}
+}
+
+func receiveMsg(s *saverSuite, got <-chan string) string {
+	select {
+	case m := <-got:
+		return m
+	case <-time.After(2 * time.Second):
+		s.Fail("no syslog message")
+		return ""
+	}
+}
@@ -0,0 +1,97 @@
+package saver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+const DefaultSyncInterval = time.Second
+
+// write appends line to f. After failed write f is truncated to its size before, so no partial line is left.
+// f is synced or marked for periodic sync according to sync policy.
+func (s *saver) write(f *os.File, line []byte) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(line)
+	if err != nil {
+		if fi.Mode().IsRegular() {
+			f.Truncate(fi.Size())
+		}
+		return err
+	}
+	switch s.syncPolicy {
+	case model.SyncEveryWrite:
+		return s.fsync(f)
+	case model.SyncInterval:
+		s.dirty[f.Name()] = true
+	}
+	return nil
+}
+
+// syncLoop syncs files written since previous tick until stop is closed
+func (s *saver) syncLoop(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.syncDirty()
+		}
+	}
+}
+
+// syncDirty syncs files written since previous call
+func (s *saver) syncDirty() {
+	s.mu.Lock()
+	paths := s.dirty
+	s.dirty = make(map[string]bool)
+	s.mu.Unlock()
+
+	for i := range paths {
+		f, err := os.OpenFile(i, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			// renamed by rotation, it is synced next time it is written or never
+			continue
+		}
+		err = s.fsync(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(s.errOut, "%s saver: unable to sync %s: %v\n", time.Now().Format(logTimeLayout), i, err)
+		}
+	}
+}
+
+// failed reports write error once when writing starts failing, records lost meanwhile are counted
+func (s *saver) failed(path string, err error) {
+	s.lost++
+	if s.failure != nil {
+		return
+	}
+	s.failure = err
+	what := "unable to write"
+	if errors.Is(err, syscall.ENOSPC) {
+		what = "disk is full, unable to write"
+	}
+	fmt.Fprintf(s.errOut, "%s saver: %s %s: %v\n", time.Now().Format(logTimeLayout), what, path, err)
+}
+
+// recovered reports number of lost records to stderr and err stream after writing is restored
+func (s *saver) recovered() {
+	if s.failure == nil {
+		return
+	}
+	msg := fmt.Sprintf("%d log records lost: %v", s.lost, s.failure)
+	s.failure, s.lost = nil, 0
+	fmt.Fprintf(s.errOut, "%s saver: writing restored, %s\n", time.Now().Format(logTimeLayout), msg)
+	s.save(model.WrappedLog{T: time.Now(), UW: model.UUIDWrapper{Str: "ERROR"}, L: msg})
+}
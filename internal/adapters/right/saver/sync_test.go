@@ -0,0 +1,96 @@
+package saver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/runtimeops"
+)
+
+func (s *saverSuite) TestSync() {
+	sep := runtimeops.GetSep()
+	t := time.Date(2023, 11, 23, 10, 0, 0, 0, time.UTC)
+	tt := []struct {
+		name       string
+		policy     model.SyncPolicy
+		wantWrites int
+		wantClose  int
+	}{
+		{name: "default never", wantWrites: 0, wantClose: 0},
+		{name: "every write", policy: model.SyncEveryWrite, wantWrites: 6, wantClose: 6},
+		// files all and err are synced once
+		{name: "interval", policy: model.SyncInterval, wantWrites: 0, wantClose: 2},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			sv := NewSaverWithConfig(Config{Folder: s.T().TempDir(), Sep: sep, Limit: 1000, Sync: v.policy, SyncInterval: time.Hour})
+			synced := make([]string, 0)
+			sv.fsync = func(f *os.File) error {
+				synced = append(synced, filepath.Base(f.Name()))
+				return f.Sync()
+			}
+			for i := 0; i < 3; i++ {
+				s.NoError(sv.Save(model.WrappedLog{T: t, UW: model.UUIDWrapper{UUID: uuid.New(), Str: "ERROR"}, L: "log"}))
+			}
+			s.Len(synced, v.wantWrites)
+			s.NoError(sv.Close())
+			s.Len(synced, v.wantClose)
+		})
+	}
+
+	// interval sync runs in background
+	sv := NewSaverWithConfig(Config{Folder: s.T().TempDir(), Sep: sep, Limit: 1000, Sync: model.SyncInterval, SyncInterval: 5 * time.Millisecond})
+	synced := make(chan string, 10)
+	sv.mu.Lock()
+	sv.fsync = func(f *os.File) error {
+		synced <- filepath.Base(f.Name())
+		return f.Sync()
+	}
+	sv.mu.Unlock()
+	s.NoError(sv.Save(model.WrappedLog{T: t, UW: model.UUIDWrapper{UUID: uuid.New()}, L: "log"}))
+	select {
+	case name := <-synced:
+		s.Equal("2023-11-23_all.log", name)
+	case <-time.After(time.Second):
+		s.Fail("file is not synced")
+	}
+	s.NoError(sv.Close())
+}
+
+func (s *saverSuite) TestDiskFull() {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		s.T().Skip("no /dev/full")
+	}
+	sep := runtimeops.GetSep()
+	folder := s.T().TempDir()
+	t := time.Date(2023, 11, 23, 10, 0, 0, 0, time.UTC)
+	current := filepath.Join(folder, "2023-11-23_all.log")
+	s.NoError(os.Symlink("/dev/full", current))
+
+	errOut := &bytes.Buffer{}
+	sv := NewSaverWithConfig(Config{Folder: folder, Sep: sep, Limit: 1000, ErrorOutput: errOut})
+	for i := 0; i < 3; i++ {
+		s.Error(sv.Save(model.WrappedLog{T: t, UW: model.UUIDWrapper{UUID: uuid.New()}, L: "log"}))
+	}
+	// failure is reported once
+	s.Equal(1, strings.Count(errOut.String(), "\n"))
+	s.Contains(errOut.String(), "saver: disk is full, unable to write "+current)
+
+	// space is back, lost records are reported to err stream
+	s.NoError(os.Remove(current))
+	s.NoError(sv.Save(model.WrappedLog{T: t, UW: model.UUIDWrapper{UUID: uuid.New()}, L: "log"}))
+	s.NoError(sv.Close())
+	s.Contains(errOut.String(), "saver: writing restored, 3 log records lost")
+	errs := make([]string, 0)
+	s.NoError(NewReader(folder, sep, nil).Find(model.LogQuery{Stream: "err"}, func(wl model.WrappedLog, _ string) error {
+		errs = append(errs, wl.L)
+		return nil
+	}))
+	s.Len(errs, 1)
+	s.True(strings.HasPrefix(errs[0], "3 log records lost: "))
+}
@@ -0,0 +1,325 @@
+package saver
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+// Syslog Sink implementation
+
+const (
+	DefaultSyslogBuffer   = 1000
+	DefaultSyslogFacility = 16 // local0
+	// sdID is SD-ID of record uuid and fields, 32473 is example enterprise number of RFC 5612
+	sdID = "fields@32473"
+	// rfc5424Time has microseconds, the maximum RFC 5424 allows
+	rfc5424Time = "2006-01-02T15:04:05.000000Z07:00"
+	nilValue    = "-"
+)
+
+// severities of RFC 5424 by level
+var severities = map[model.Level]int{
+	model.LevelDebug:  7,
+	model.LevelInfo:   6,
+	model.LevelSignal: 5,
+	model.LevelWarn:   4,
+	model.LevelError:  3,
+}
+
+// SyslogConfig holds collector address and RFC 5424 header values
+type SyslogConfig struct {
+	// Network is tcp or unix (octet counting framing of RFC 6587), udp or unixgram (message per datagram)
+	Network string
+	Addr    string
+	// Facility is DefaultSyslogFacility if zero
+	Facility int
+	// AppName is executable name and Hostname is host name if not set
+	AppName  string
+	Hostname string
+	// Buffer is number of messages kept while collector is unreachable, the oldest ones are dropped when it is full
+	Buffer int
+	// Timeout limits dialing and writing, 5s if zero
+	Timeout time.Duration
+	// RetryMin and RetryMax bound reconnect backoff, 100ms and 30s if zero
+	RetryMin time.Duration
+	RetryMax time.Duration
+	// CloseTimeout is how long Close tries to send buffered messages, 5s if zero
+	CloseTimeout time.Duration
+}
+
+type syslogMsg struct {
+	seq uint64
+	b   []byte
+}
+
+type syslogSink struct {
+	c      SyslogConfig
+	procID string
+	stream bool
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	buf      []syslogMsg
+	seq      uint64
+	closed   bool
+	deadline time.Time
+	dropped  uint64
+	stop     chan struct{}
+	done     chan struct{}
+
+	// conn is used by run goroutine only
+	conn net.Conn
+}
+
+// NewSyslogSink returns Sink sending records to collector in background. Records are buffered,
+// connection is restored with backoff after failure.
+func NewSyslogSink(c SyslogConfig) (*syslogSink, error) {
+	stream := false
+	switch c.Network {
+	case "tcp", "unix":
+		stream = true
+	case "udp", "unixgram":
+	default:
+		return nil, fmt.Errorf("in saver.NewSyslogSink unknown network %q", c.Network)
+	}
+	if c.Facility == 0 {
+		c.Facility = DefaultSyslogFacility
+	}
+	if c.Facility < 0 || c.Facility > 23 {
+		return nil, fmt.Errorf("in saver.NewSyslogSink invalid facility %d", c.Facility)
+	}
+	if c.AppName == "" {
+		c.AppName = filepath.Base(os.Args[0])
+	}
+	if c.Hostname == "" {
+		c.Hostname, _ = os.Hostname()
+	}
+	if c.Buffer <= 0 {
+		c.Buffer = DefaultSyslogBuffer
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 5 * time.Second
+	}
+	if c.RetryMin <= 0 {
+		c.RetryMin = 100 * time.Millisecond
+	}
+	if c.RetryMax < c.RetryMin {
+		c.RetryMax = 30 * time.Second
+	}
+	if c.CloseTimeout <= 0 {
+		c.CloseTimeout = 5 * time.Second
+	}
+	s := &syslogSink{
+		c:      c,
+		procID: strconv.Itoa(os.Getpid()),
+		stream: stream,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	go s.run()
+	return s, nil
+}
+
+// Write puts RFC 5424 message of wl into buffer, it never waits for collector
+func (s *syslogSink) Write(wl model.WrappedLog, _ []byte) error {
+	msg := s.format(wl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	if len(s.buf) >= s.c.Buffer {
+		s.buf = s.buf[1:]
+		s.dropped++
+	}
+	s.seq++
+	s.buf = append(s.buf, syslogMsg{seq: s.seq, b: msg})
+	s.cond.Signal()
+	return nil
+}
+
+// Dropped returns number of messages dropped because buffer was full or Close timed out
+func (s *syslogSink) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close sends buffered messages during CloseTimeout, the rest are dropped
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.deadline = time.Now().Add(s.c.CloseTimeout)
+	before := s.dropped
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	close(s.stop)
+
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := s.dropped - before; n > 0 {
+		return fmt.Errorf("in saver.Close %d syslog messages are not sent to %s", n, s.c.Addr)
+	}
+	return nil
+}
+
+func (s *syslogSink) run() {
+	defer close(s.done)
+	defer func() {
+		if s.conn != nil {
+			s.conn.Close()
+		}
+	}()
+
+	backoff := s.c.RetryMin
+	for {
+		s.mu.Lock()
+		for len(s.buf) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if len(s.buf) == 0 {
+			s.mu.Unlock()
+			return
+		}
+		msg := s.buf[0]
+		closed, deadline := s.closed, s.deadline
+		s.mu.Unlock()
+
+		err := s.send(msg.b)
+		if err == nil {
+			backoff = s.c.RetryMin
+			s.mu.Lock()
+			// message could be dropped by Write meanwhile
+			if len(s.buf) > 0 && s.buf[0].seq == msg.seq {
+				s.buf = s.buf[1:]
+			}
+			s.mu.Unlock()
+			continue
+		}
+
+		wait := backoff
+		if closed {
+			left := time.Until(deadline)
+			if left <= 0 {
+				s.mu.Lock()
+				s.dropped += uint64(len(s.buf))
+				s.buf = nil
+				s.mu.Unlock()
+				return
+			}
+			if wait > left {
+				wait = left
+			}
+			time.Sleep(wait)
+		} else {
+			t := time.NewTimer(wait)
+			select {
+			case <-t.C:
+			case <-s.stop:
+				t.Stop()
+			}
+		}
+		backoff *= 2
+		if backoff > s.c.RetryMax {
+			backoff = s.c.RetryMax
+		}
+	}
+}
+
+// send writes msg to collector, connecting first if needed. Connection is closed after failed write.
+func (s *syslogSink) send(msg []byte) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.c.Network, s.c.Addr, s.c.Timeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	frame := msg
+	if s.stream {
+		frame = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(s.c.Timeout))
+	_, err := s.conn.Write(frame)
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// format returns "<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID - [fields@32473 uuid=... key=...] MSG"
+func (s *syslogSink) format(wl model.WrappedLog) []byte {
+	l := model.ParseLevel(wl.UW.Str)
+	b := strings.Builder{}
+	b.WriteString("<" + strconv.Itoa(s.c.Facility*8+severities[l]) + ">1 ")
+	b.WriteString(wl.T.Format(rfc5424Time) + " ")
+	b.WriteString(headerValue(s.c.Hostname, 255) + " ")
+	b.WriteString(headerValue(s.c.AppName, 48) + " ")
+	b.WriteString(s.procID + " " + nilValue + " ")
+
+	params := make([]string, 0, len(wl.F)+1)
+	if l != model.LevelSignal {
+		params = append(params, `uuid="`+wl.UW.UUID.String()+`"`)
+	}
+	for _, v := range wl.F {
+		params = append(params, sdName(v.Key)+`="`+sdValue(fmt.Sprint(fieldValue(v.Value)))+`"`)
+	}
+	if len(params) == 0 {
+		b.WriteString(nilValue)
+	} else {
+		b.WriteString("[" + sdID + " " + strings.Join(params, " ") + "]")
+	}
+	b.WriteString(" " + wl.L)
+	return []byte(b.String())
+}
+
+// headerValue replaces characters RFC 5424 header does not allow and truncates s to max
+func headerValue(s string, max int) string {
+	if s == "" {
+		return nilValue
+	}
+	r := []byte(s)
+	for i, v := range r {
+		if v < 33 || v > 126 {
+			r[i] = '_'
+		}
+	}
+	if len(r) > max {
+		r = r[:max]
+	}
+	return string(r)
+}
+
+// sdName returns PARAM-NAME of field key, '=', ' ', ']' and '"' are not allowed in it
+func sdName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, s)
+	return headerValue(s, 32)
+}
+
+// sdValue escapes '"', '\' and ']' of PARAM-VALUE
+func sdValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
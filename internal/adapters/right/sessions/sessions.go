@@ -0,0 +1,106 @@
+package sessions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+type Sessions interface {
+	Create(model.Session) (model.Session, error)
+	Get(string) (model.Session, error)
+	Delete(string) error
+	Close() error
+}
+
+// Sessions implementation
+
+var ErrNotFound = errors.New("session not found")
+
+type memSessions struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[string]model.Session
+	now      func() time.Time
+}
+
+// NewMemSessions returns Sessions kept in memory, each session lives for ttl
+func NewMemSessions(ttl time.Duration) *memSessions {
+	return &memSessions{
+		ttl:      ttl,
+		sessions: make(map[string]model.Session),
+		now:      time.Now,
+	}
+}
+
+// Create stores session of s.Principal with new random ID and CSRF token
+func (m *memSessions) Create(s model.Session) (model.Session, error) {
+	id, err := token()
+	if err != nil {
+		return model.Session{}, fmt.Errorf("in sessions.Create %w", err)
+	}
+	csrf, err := token()
+	if err != nil {
+		return model.Session{}, fmt.Errorf("in sessions.Create %w", err)
+	}
+	s.ID, s.CSRF = id, csrf
+	s.ExpiresAt = m.now().Add(m.ttl).UTC()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune()
+	m.sessions[id] = s
+	return s, nil
+}
+
+// Get returns session which is not expired
+func (m *memSessions) Get(id string) (model.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok || !m.now().Before(s.ExpiresAt) {
+		delete(m.sessions, id)
+		return model.Session{}, ErrNotFound
+	}
+	return s, nil
+}
+
+func (m *memSessions) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sessions[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *memSessions) Close() error {
+	return nil
+}
+
+// prune removes expired sessions
+func (m *memSessions) prune() {
+	now := m.now()
+	for i, v := range m.sessions {
+		if !now.Before(v.ExpiresAt) {
+			delete(m.sessions, i)
+		}
+	}
+}
+
+func token() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
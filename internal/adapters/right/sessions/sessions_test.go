@@ -0,0 +1,48 @@
+package sessions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+type sessionsSuite struct {
+	suite.Suite
+}
+
+func TestSessionsSuite(t *testing.T) {
+	suite.Run(t, new(sessionsSuite))
+}
+
+func (s *sessionsSuite) TestLifetime() {
+	now := time.Date(2022, 10, 2, 12, 0, 0, 0, time.UTC)
+	m := NewMemSessions(time.Hour)
+	m.now = func() time.Time { return now }
+
+	p := model.Principal{Subject: "2593ede0-2301-4480-a452-752f03dcfab0", Roles: []model.Role{model.RoleUser}}
+	first, err := m.Create(model.Session{Principal: p})
+	s.NoError(err)
+	s.Len(first.ID, 64)
+	s.Len(first.CSRF, 64)
+	s.NotEqual(first.ID, first.CSRF)
+	s.Equal(now.Add(time.Hour), first.ExpiresAt)
+
+	got, err := m.Get(first.ID)
+	s.NoError(err)
+	s.Equal(first, got)
+	_, err = m.Get("unknown")
+	s.ErrorIs(err, ErrNotFound)
+
+	second, err := m.Create(model.Session{Principal: p})
+	s.NoError(err)
+	s.NoError(m.Delete(second.ID))
+	s.ErrorIs(m.Delete(second.ID), ErrNotFound)
+	_, err = m.Get(second.ID)
+	s.ErrorIs(err, ErrNotFound)
+
+	now = now.Add(time.Hour)
+	_, err = m.Get(first.ID)
+	s.ErrorIs(err, ErrNotFound)
+}
@@ -1,7 +1,13 @@
 package store
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
@@ -11,7 +17,348 @@ type Store interface {
 	Read(uuid.UUID, url.Values) ([]map[string]interface{}, error)
 	Write([]model.NotificationDataStructured, uuid.UUID) error
 	Count(uuid.UUID, url.Values) (int, error)
+	Segment(string, int, func([]uuid.UUID) error) error
+	MarkRead(uuid.UUID, []uuid.UUID, string) (int, error)
+	Delete(uuid.UUID, []uuid.UUID) (int, error)
 	Close() error
 }
 
 // Store implementation
+
+const dayLayout = "2006-01-02"
+
+// memStore keeps notifications of every user in memory
+type memStore struct {
+	mu       sync.RWMutex
+	data     map[uuid.UUID][]map[string]interface{}
+	segments map[string][]uuid.UUID
+}
+
+func NewMemStore() *memStore {
+	return &memStore{
+		data:     make(map[uuid.UUID][]map[string]interface{}),
+		segments: make(map[string][]uuid.UUID),
+	}
+}
+
+// Read returns page of user's notifications filtered, searched and sorted by request parameters.
+// Parameters: page, per_page, filter (JSON object field -> {type, value}), search, sort_by, order.
+func (s *memStore) Read(u uuid.UUID, p url.Values) ([]map[string]interface{}, error) {
+	res, err := s.query(u, p)
+	if err != nil {
+		return nil, err
+	}
+	page, perPage, err := model.Paging(p)
+	if err != nil {
+		return nil, err
+	}
+	from := (page - 1) * perPage
+	if from >= len(res) {
+		return nil, model.ErrNoRows
+	}
+	to := from + perPage
+	if to > len(res) {
+		to = len(res)
+	}
+
+	return res[from:to], nil
+}
+
+// Write upserts notifications by uuid, replaced notification stays read
+func (s *memStore) Write(items []model.NotificationDataStructured, reqUUID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, v := range items {
+		m, err := toMap(v)
+		if err != nil {
+			return fmt.Errorf("in store.Write request %s: %w", reqUUID, err)
+		}
+		rows := s.data[v.UserUUID]
+		replaced := false
+		for i, w := range rows {
+			if w["uuid"] == m["uuid"] {
+				if _, ok := m["read_at"]; !ok && w["read_at"] != nil {
+					m["read_at"] = w["read_at"]
+				}
+				rows[i] = m
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			rows = append(rows, m)
+		}
+		s.data[v.UserUUID] = rows
+	}
+	return nil
+}
+
+// Count returns number of user's notifications matching request parameters, paging ignored
+func (s *memStore) Count(u uuid.UUID, p url.Values) (int, error) {
+	res, err := s.query(u, p)
+	if err != nil {
+		return 0, err
+	}
+	return len(res), nil
+}
+
+// MarkRead sets read_at of user's notifications with given uuids which are not read yet, returns number of marked ones
+func (s *memStore) MarkRead(u uuid.UUID, uuids []uuid.UUID, at string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	want := uuidSet(uuids)
+	n := 0
+	for _, v := range s.data[u] {
+		id, _ := v["uuid"].(string)
+		if _, ok := want[id]; ok && v["read_at"] == nil {
+			v["read_at"] = at
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Delete removes user's notifications with given uuids, returns number of removed ones
+func (s *memStore) Delete(u uuid.UUID, uuids []uuid.UUID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	want := uuidSet(uuids)
+	rows := s.data[u]
+	kept := rows[:0]
+	for _, v := range rows {
+		id, _ := v["uuid"].(string)
+		if _, ok := want[id]; !ok {
+			kept = append(kept, v)
+		}
+	}
+	n := len(rows) - len(kept)
+	for i := len(kept); i < len(rows); i++ {
+		rows[i] = nil
+	}
+	if len(kept) == 0 {
+		delete(s.data, u)
+	} else {
+		s.data[u] = kept
+	}
+	return n, nil
+}
+
+// AddSegment adds users to named segment
+func (s *memStore) AddSegment(name string, users []uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.segments[name] = append(s.segments[name], users...)
+}
+
+// Segment passes users of named segment to fn in chunks of at most size users
+func (s *memStore) Segment(name string, size int, fn func([]uuid.UUID) error) error {
+	if size < 1 {
+		return fmt.Errorf("in store.Segment invalid chunk size %d", size)
+	}
+	s.mu.RLock()
+	users, ok := s.segments[name]
+	s.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("in store.Segment unknown segment %q", name)
+	}
+	for i := 0; i < len(users); i += size {
+		end := i + size
+		if end > len(users) {
+			end = len(users)
+		}
+		err := fn(append([]uuid.UUID{}, users[i:end]...))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memStore) Close() error {
+	return nil
+}
+
+func (s *memStore) query(u uuid.UUID, p url.Values) ([]map[string]interface{}, error) {
+	s.mu.RLock()
+	rows := make([]map[string]interface{}, 0, len(s.data[u]))
+	for _, v := range s.data[u] {
+		rows = append(rows, copyRow(v))
+	}
+	s.mu.RUnlock()
+
+	filters, err := parseFilter(p.Get("filter"))
+	if err != nil {
+		return nil, err
+	}
+	rows, err = doFilter(rows, filters)
+	if err != nil {
+		return nil, err
+	}
+	if search := p.Get("search"); search != "" {
+		rows, err = doSearch(rows, search)
+		if err != nil {
+			return nil, err
+		}
+	}
+	by, order := p.Get("sort_by"), p.Get("order")
+	if by == "" {
+		by = "created_at"
+	}
+	if order == "" {
+		order = "desc"
+	}
+	return doSort(rows, by, order)
+}
+
+// parseFilter converts {"field":{"type":..., "value":...}} into list of filters
+func parseFilter(s string) ([]map[string]interface{}, error) {
+	if s == "" {
+		return nil, nil
+	}
+	raw := make(map[string]map[string]interface{})
+	err := json.Unmarshal([]byte(s), &raw)
+	if err != nil {
+		return nil, fmt.Errorf("in store.parseFilter invalid filter %q: %w", s, err)
+	}
+	fields := make([]string, 0, len(raw))
+	for i := range raw {
+		fields = append(fields, i)
+	}
+	sort.Strings(fields)
+
+	res := make([]map[string]interface{}, 0, len(raw))
+	for _, v := range fields {
+		res = append(res, map[string]interface{}{
+			"field": v,
+			"type":  raw[v]["type"],
+			"value": raw[v]["value"],
+		})
+	}
+	return res, nil
+}
+
+// doFilter keeps rows matching every filter.
+// "daytime" filter value is {"from": date, "to": date}, both inclusive and optional.
+// "list" filter value is list of allowed values.
+func doFilter(data []map[string]interface{}, filters []map[string]interface{}) ([]map[string]interface{}, error) {
+	res := data
+	for _, f := range filters {
+		field, _ := f["field"].(string)
+		match, err := matcher(f)
+		if err != nil {
+			return nil, err
+		}
+		filtered := make([]map[string]interface{}, 0, len(res))
+		for _, v := range res {
+			if match(v[field]) {
+				filtered = append(filtered, v)
+			}
+		}
+		res = filtered
+	}
+	return res, nil
+}
+
+func matcher(f map[string]interface{}) (func(interface{}) bool, error) {
+	switch f["type"] {
+	case "daytime":
+		value, ok := f["value"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("in store.doFilter daytime filter value is not object")
+		}
+		from, _ := value["from"].(string)
+		to, _ := value["to"].(string)
+		return func(v interface{}) bool {
+			s, _ := v.(string)
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return false
+			}
+			day := t.Format(dayLayout)
+			return (from == "" || day >= from) && (to == "" || day <= to)
+		}, nil
+	case "list":
+		value, ok := f["value"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("in store.doFilter list filter value is not list")
+		}
+		return func(v interface{}) bool {
+			for _, w := range value {
+				if fmt.Sprint(w) == fmt.Sprint(v) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+	return nil, fmt.Errorf("in store.doFilter unknown filter type %v", f["type"])
+}
+
+// doSearch keeps rows whose name or description contains s, case insensitive
+func doSearch(data []map[string]interface{}, s string) ([]map[string]interface{}, error) {
+	s = strings.ToLower(s)
+	res := make([]map[string]interface{}, 0, len(data))
+	for _, v := range data {
+		name, _ := v["name"].(string)
+		desc, _ := v["description"].(string)
+		if strings.Contains(strings.ToLower(name), s) || strings.Contains(strings.ToLower(desc), s) {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+// doSort sorts rows by field in "asc" or "desc" order, priority is sorted by rank
+func doSort(data []map[string]interface{}, by, order string) ([]map[string]interface{}, error) {
+	if order != "asc" && order != "desc" {
+		return nil, fmt.Errorf("in store.doSort unknown order %q", order)
+	}
+	less := func(i, j int) bool {
+		return fmt.Sprint(data[i][by]) < fmt.Sprint(data[j][by])
+	}
+	if by == "priority" {
+		less = func(i, j int) bool {
+			return rank(data[i]) < rank(data[j])
+		}
+	}
+	if order == "desc" {
+		sort.SliceStable(data, func(i, j int) bool { return less(j, i) })
+	} else {
+		sort.SliceStable(data, less)
+	}
+	return data, nil
+}
+
+func rank(m map[string]interface{}) int {
+	p, _ := m["priority"].(string)
+	return model.Priority(p).Rank()
+}
+
+func toMap(n model.NotificationDataStructured) (map[string]interface{}, error) {
+	b, err := json.Marshal(n)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{})
+	err = json.Unmarshal(b, &m)
+	return m, err
+}
+
+func uuidSet(uuids []uuid.UUID) map[string]struct{} {
+	res := make(map[string]struct{}, len(uuids))
+	for _, v := range uuids {
+		res[v.String()] = struct{}{}
+	}
+	return res
+}
+
+func copyRow(m map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(m))
+	for i, v := range m {
+		res[i] = v
+	}
+	return res
+}
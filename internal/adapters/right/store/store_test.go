@@ -1,9 +1,12 @@
 package store
 
 import (
+	"net/url"
 	"testing"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/suite"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
 )
 
 type storeSouite struct {
@@ -140,6 +143,25 @@ func (s *storeSouite) TestDoFilter() {
 				},
 			},
 		},
+		{
+			name: "priority list",
+			initData: []map[string]interface{}{
+				{"name": "azaza", "priority": "high"},
+				{"name": "bzbzb", "priority": "low"},
+				{"name": "czczc", "priority": "urgent"},
+			},
+			filters: []map[string]interface{}{
+				{
+					"field": "priority",
+					"type":  "list",
+					"value": []interface{}{"high", "urgent"},
+				},
+			},
+			wantData: []map[string]interface{}{
+				{"name": "azaza", "priority": "high"},
+				{"name": "czczc", "priority": "urgent"},
+			},
+		},
 	}
 	for _, v := range tt {
 		s.Run(v.name, func() {
@@ -351,6 +373,24 @@ func (s *storeSouite) TestDoSort() {
 				},
 			},
 		},
+
+		{
+			name: "priority by rank",
+			initData: []map[string]interface{}{
+				{"name": "azaza", "priority": "high"},
+				{"name": "bzbzb", "priority": "low"},
+				{"name": "czczc", "priority": "urgent"},
+				{"name": "dzdzd", "priority": "normal"},
+			},
+			by:    "priority",
+			order: "desc",
+			wantData: []map[string]interface{}{
+				{"name": "czczc", "priority": "urgent"},
+				{"name": "azaza", "priority": "high"},
+				{"name": "dzdzd", "priority": "normal"},
+				{"name": "bzbzb", "priority": "low"},
+			},
+		},
 	}
 	for _, v := range tt {
 		s.Run(v.name, func() {
@@ -362,3 +402,50 @@ func (s *storeSouite) TestDoSort() {
 		})
 	}
 }
+
+func (s *storeSouite) TestMarkReadAndDelete() {
+	st := NewMemStore()
+	u := uuid.New()
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	items := make([]model.NotificationDataStructured, 0, len(ids))
+	for _, v := range ids {
+		items = append(items, model.NotificationDataStructured{UserUUID: u, UUID: v, Category: "c", CreatedAt: "2022-10-02T12:00:00.000000Z"})
+	}
+	s.NoError(st.Write(items, uuid.New()))
+
+	n, err := st.MarkRead(u, ids[:2], "2022-10-03T12:00:00.000000Z")
+	s.NoError(err)
+	s.Equal(2, n)
+	n, err = st.MarkRead(u, ids[1:], "2022-10-04T12:00:00.000000Z")
+	s.NoError(err)
+	s.Equal(1, n)
+	n, err = st.MarkRead(uuid.New(), ids, "2022-10-04T12:00:00.000000Z")
+	s.NoError(err)
+	s.Equal(0, n)
+
+	// replaced notification stays read
+	s.NoError(st.Write(items[:1], uuid.New()))
+	n, err = st.Count(u, url.Values{"filter": {`{"uuid":{"type":"list","value":["` + ids[0].String() + `"]}}`}})
+	s.NoError(err)
+	s.Equal(1, n)
+	rows, err := st.Read(u, url.Values{"sort_by": {"uuid"}})
+	s.NoError(err)
+	readAt := make(map[interface{}]interface{})
+	for _, v := range rows {
+		readAt[v["uuid"]] = v["read_at"]
+	}
+	s.Equal("2022-10-03T12:00:00.000000Z", readAt[ids[0].String()])
+	s.Equal("2022-10-04T12:00:00.000000Z", readAt[ids[2].String()])
+
+	n, err = st.Delete(u, []uuid.UUID{ids[0], uuid.New()})
+	s.NoError(err)
+	s.Equal(1, n)
+	n, err = st.Count(u, url.Values{})
+	s.NoError(err)
+	s.Equal(2, n)
+	n, err = st.Delete(u, ids)
+	s.NoError(err)
+	s.Equal(2, n)
+	_, err = st.Read(u, url.Values{})
+	s.ErrorIs(err, model.ErrNoRows)
+}
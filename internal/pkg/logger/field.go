@@ -0,0 +1,48 @@
+package logger
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+// Field constructors
+
+func String(key, v string) model.Field {
+	return model.Field{Key: key, Value: v}
+}
+
+func Strings(key string, v []string) model.Field {
+	return model.Field{Key: key, Value: v}
+}
+
+func Int(key string, v int) model.Field {
+	return model.Field{Key: key, Value: v}
+}
+
+func Int64(key string, v int64) model.Field {
+	return model.Field{Key: key, Value: v}
+}
+
+func Bool(key string, v bool) model.Field {
+	return model.Field{Key: key, Value: v}
+}
+
+func Duration(key string, v time.Duration) model.Field {
+	return model.Field{Key: key, Value: v}
+}
+
+func UUID(key string, v uuid.UUID) model.Field {
+	return model.Field{Key: key, Value: v.String()}
+}
+
+// Err returns field "error" with text of err, Encoder writes error as string
+func Err(err error) model.Field {
+	return model.Field{Key: "error", Value: err}
+}
+
+// Any returns field of any value, Encoder writes it by fmt or JSON rules
+func Any(key string, v interface{}) model.Field {
+	return model.Field{Key: key, Value: v}
+}
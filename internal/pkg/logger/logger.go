@@ -0,0 +1,94 @@
+package logger
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+type Logger interface {
+	Debug(string, ...model.Field)
+	Info(string, ...model.Field)
+	Warn(string, ...model.Field)
+	Error(string, ...model.Field)
+	Signal(string, ...model.Field)
+	With(...model.Field) Logger
+	WithUUID(uuid.UUID) Logger
+	SetLevel(model.Level)
+	Level() model.Level
+}
+
+// Saver is where log records go, satisfied by saver.Saver
+type Saver interface {
+	Save(model.WrappedLog) error
+}
+
+// Saver backed Logger implementation
+
+type logger struct {
+	saver  Saver
+	level  *atomic.Int32
+	uuid   uuid.UUID
+	fields []model.Field
+}
+
+// NewLogger returns Logger writing records of level l and above to s
+func NewLogger(s Saver, l model.Level) *logger {
+	level := &atomic.Int32{}
+	level.Store(int32(l))
+	return &logger{
+		saver: s,
+		level: level,
+	}
+}
+
+func (l *logger) Debug(msg string, f ...model.Field)  { l.log(model.LevelDebug, msg, f) }
+func (l *logger) Info(msg string, f ...model.Field)   { l.log(model.LevelInfo, msg, f) }
+func (l *logger) Warn(msg string, f ...model.Field)   { l.log(model.LevelWarn, msg, f) }
+func (l *logger) Error(msg string, f ...model.Field)  { l.log(model.LevelError, msg, f) }
+func (l *logger) Signal(msg string, f ...model.Field) { l.log(model.LevelSignal, msg, f) }
+
+// With returns child Logger adding f to every record, level is shared with parent
+func (l *logger) With(f ...model.Field) Logger {
+	child := *l
+	child.fields = append(append([]model.Field{}, l.fields...), f...)
+	return &child
+}
+
+// WithUUID returns child Logger of request, its records have request uuid
+func (l *logger) WithUUID(u uuid.UUID) Logger {
+	child := *l
+	child.uuid = u
+	return &child
+}
+
+// SetLevel changes minimal level of l, its parent and all its children
+func (l *logger) SetLevel(level model.Level) {
+	l.level.Store(int32(level))
+}
+
+func (l *logger) Level() model.Level {
+	return model.Level(l.level.Load())
+}
+
+func (l *logger) log(level model.Level, msg string, f []model.Field) {
+	if int32(level) < l.level.Load() {
+		return
+	}
+	fields := l.fields
+	if len(f) > 0 {
+		fields = append(append([]model.Field{}, l.fields...), f...)
+	}
+	err := l.saver.Save(model.WrappedLog{
+		T:  time.Now(),
+		UW: model.UUIDWrapper{Str: level.String(), UUID: l.uuid},
+		L:  msg,
+		F:  fields,
+	})
+	if err != nil {
+		log.Printf("in logger.log unable to save %q: %v", msg, err)
+	}
+}
@@ -0,0 +1,107 @@
+package logger
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	"github.com/vynovikov/study/notifications_example/internal/pkg/model"
+)
+
+type loggerSuite struct {
+	suite.Suite
+}
+
+func TestLoggerSuite(t *testing.T) {
+	suite.Run(t, new(loggerSuite))
+}
+
+type recSaver struct {
+	logs []model.WrappedLog
+}
+
+func (r *recSaver) Save(wl model.WrappedLog) error {
+	r.logs = append(r.logs, wl)
+	return nil
+}
+
+func (s *loggerSuite) TestLevels() {
+	tt := []struct {
+		name     string
+		min      model.Level
+		wantStrs []string
+	}{
+		{name: "debug", min: model.LevelDebug, wantStrs: []string{"DEBUG", "", "WARN", "ERROR", "SIGNAL"}},
+		{name: "info", min: model.LevelInfo, wantStrs: []string{"", "WARN", "ERROR", "SIGNAL"}},
+		{name: "error", min: model.LevelError, wantStrs: []string{"ERROR", "SIGNAL"}},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			rs := &recSaver{}
+			l := NewLogger(rs, v.min)
+			l.Debug("d")
+			l.Info("i")
+			l.Warn("w")
+			l.Error("e")
+			l.Signal("s")
+			strs := make([]string, 0)
+			for _, w := range rs.logs {
+				strs = append(strs, w.UW.Str)
+			}
+			s.Equal(v.wantStrs, strs)
+		})
+	}
+}
+
+func (s *loggerSuite) TestChildren() {
+	rs := &recSaver{}
+	root := NewLogger(rs, model.LevelInfo)
+	id := uuid.New()
+	req := root.WithUUID(id).With(String("handler", "HandlePut"))
+
+	req.Info("saved", Int("count", 2))
+	root.Info("started")
+	// level is shared by parent and children
+	req.SetLevel(model.LevelWarn)
+	root.Info("dropped")
+	req.Info("dropped")
+	s.Equal(model.LevelWarn, root.Level())
+	root.SetLevel(model.LevelDebug)
+	req.Debug("debug")
+
+	s.Len(rs.logs, 3)
+	s.Equal(model.UUIDWrapper{UUID: id}, rs.logs[0].UW)
+	s.Equal("saved", rs.logs[0].L)
+	s.Equal([]model.Field{{Key: "handler", Value: "HandlePut"}, {Key: "count", Value: 2}}, rs.logs[0].F)
+	s.Equal(model.UUIDWrapper{}, rs.logs[1].UW)
+	s.Empty(rs.logs[1].F)
+	s.Equal(model.UUIDWrapper{UUID: id, Str: "DEBUG"}, rs.logs[2].UW)
+	s.Equal([]model.Field{{Key: "handler", Value: "HandlePut"}}, rs.logs[2].F)
+}
+
+func (s *loggerSuite) TestFields() {
+	id := uuid.New()
+	err := errors.New("no route")
+	tt := []struct {
+		name string
+		f    model.Field
+		want model.Field
+	}{
+		{name: "string", f: String("k", "v"), want: model.Field{Key: "k", Value: "v"}},
+		{name: "strings", f: Strings("k", []string{"a", "b"}), want: model.Field{Key: "k", Value: []string{"a", "b"}}},
+		{name: "int", f: Int("k", 1), want: model.Field{Key: "k", Value: 1}},
+		{name: "int64", f: Int64("k", 1), want: model.Field{Key: "k", Value: int64(1)}},
+		{name: "bool", f: Bool("k", true), want: model.Field{Key: "k", Value: true}},
+		{name: "duration", f: Duration("k", time.Second), want: model.Field{Key: "k", Value: time.Second}},
+		{name: "uuid", f: UUID("k", id), want: model.Field{Key: "k", Value: id.String()}},
+		{name: "error", f: Err(err), want: model.Field{Key: "error", Value: err}},
+		{name: "any", f: Any("k", []int{1}), want: model.Field{Key: "k", Value: []int{1}}},
+	}
+	for _, v := range tt {
+		s.Run(v.name, func() {
+			s.Equal(v.want, v.f)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AccessStreamField is field of access log records, Saver stream selecting {"stream": "access"} gets them
+const AccessStreamField = "stream"
+
+// AccessEntry is access log record of one request. Slow is set if Latency exceeds slow request threshold.
+type AccessEntry struct {
+	UUID      uuid.UUID
+	Method    string
+	Path      string
+	Status    int
+	Bytes     int64
+	Latency   time.Duration
+	UserAgent string
+	IP        string
+	Slow      bool
+}
+
+// Fields returns fields of log record of e, uuid is set by logger
+func (e AccessEntry) Fields() []Field {
+	return []Field{
+		{Key: AccessStreamField, Value: "access"},
+		{Key: "method", Value: e.Method},
+		{Key: "path", Value: e.Path},
+		{Key: "status", Value: e.Status},
+		{Key: "bytes", Value: e.Bytes},
+		{Key: "latency", Value: e.Latency},
+		{Key: "user_agent", Value: e.UserAgent},
+		{Key: "ip", Value: e.IP},
+		{Key: "slow", Value: e.Slow},
+	}
+}
+
+type requestUUIDKey struct{}
+
+// WithRequestUUID returns ctx holding uuid access log middleware assigned to request
+func WithRequestUUID(ctx context.Context, u uuid.UUID) context.Context {
+	return context.WithValue(ctx, requestUUIDKey{}, u)
+}
+
+// RequestUUID returns uuid assigned to request by access log middleware
+func RequestUUID(ctx context.Context) (uuid.UUID, bool) {
+	u, ok := ctx.Value(requestUUIDKey{}).(uuid.UUID)
+	return u, ok
+}
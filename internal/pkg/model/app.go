@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// App is producer allowed to send notifications, ID is its APPID
+type App struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Scope      AppScope  `json:"scope"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Revoked    bool      `json:"revoked"`
+	// Secrets are active secrets of app without values
+	Secrets []AppSecret `json:"secrets,omitempty"`
+}
+
+// AppSecret is shared secret of app, Secret is shown only when secret is issued
+type AppSecret struct {
+	UUID       uuid.UUID `json:"uuid"`
+	AppID      string    `json:"app_id"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
@@ -0,0 +1,7 @@
+package model
+
+// AppIdentity is app request is made by. Subject is certificate name or APPID header it is known by.
+type AppIdentity struct {
+	AppID   string `json:"app_id"`
+	Subject string `json:"subject"`
+}
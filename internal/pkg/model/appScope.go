@@ -0,0 +1,95 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ErrForbidden is returned when authenticated app may not perform request operation or touch its items
+var ErrForbidden = errors.New("forbidden")
+
+type Operation string
+
+const (
+	OperationRead      Operation = "read"
+	OperationWrite     Operation = "write"
+	OperationDelete    Operation = "delete"
+	OperationBroadcast Operation = "broadcast"
+	OperationMarkRead  Operation = "mark_read"
+	OperationAdmin     Operation = "admin"
+)
+
+// UserRange is inclusive range of user uuids in their string order
+type UserRange struct {
+	From uuid.UUID `json:"from"`
+	To   uuid.UUID `json:"to"`
+}
+
+// AppScope is what app may do. Empty Categories or Users allow any, Operations must be listed.
+type AppScope struct {
+	Categories []string    `json:"categories"`
+	Operations []Operation `json:"operations"`
+	Users      []UserRange `json:"users"`
+}
+
+func (s AppScope) AllowsOperation(op Operation) bool {
+	for _, v := range s.Operations {
+		if v == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (s AppScope) AllowsCategory(c string) bool {
+	if len(s.Categories) == 0 {
+		return true
+	}
+	for _, v := range s.Categories {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
+func (s AppScope) AllowsUser(u uuid.UUID) bool {
+	if len(s.Users) == 0 {
+		return true
+	}
+	for _, v := range s.Users {
+		if strings.Compare(u.String(), v.From.String()) >= 0 && strings.Compare(u.String(), v.To.String()) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ItemAuthError is reason item of request with Index is not allowed to app
+type ItemAuthError struct {
+	Index  int       `json:"index"`
+	UUID   uuid.UUID `json:"uuid"`
+	Reason string    `json:"reason"`
+}
+
+// ItemAuthErrors is error of request whose items are not allowed to app
+type ItemAuthErrors []ItemAuthError
+
+func (e ItemAuthErrors) Error() string {
+	b := strings.Builder{}
+	for i, v := range e {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		fmt.Fprintf(&b, "item %d: %s", v.Index, v.Reason)
+	}
+	return b.String()
+}
+
+// Is makes ItemAuthErrors match ErrForbidden
+func (e ItemAuthErrors) Is(target error) bool {
+	return target == ErrForbidden
+}
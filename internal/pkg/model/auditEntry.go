@@ -0,0 +1,70 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuditAction string
+
+const (
+	AuditSave         AuditAction = "save"
+	AuditDelete       AuditAction = "delete"
+	AuditMarkRead     AuditAction = "mark_read"
+	AuditAppCreate    AuditAction = "app_create"
+	AuditSecretIssue  AuditAction = "secret_issue"
+	AuditSecretRevoke AuditAction = "secret_revoke"
+	AuditAppRevoke    AuditAction = "app_revoke"
+	AuditBroadcast    AuditAction = "broadcast"
+	AuditLogLevel     AuditAction = "log_level"
+	AuditDenied       AuditAction = "denied"
+)
+
+type AuditOutcome string
+
+const (
+	AuditSuccess AuditOutcome = "success"
+	AuditFailure AuditOutcome = "failure"
+)
+
+// AuditEntry is record of audit log. Actor is APPID of app or subject of user, ActorKind is "app", "user",
+// or "anonymous" if request is denied before its actor is known.
+// User is owner of changed notifications, Targets are uuids of notifications or ids of apps and secrets.
+// Seq, Prev and Hash are set by Auditor: Prev is Hash of previous entry, empty for the first one.
+type AuditEntry struct {
+	Seq       uint64       `json:"seq"`
+	Time      time.Time    `json:"time"`
+	Request   uuid.UUID    `json:"request"`
+	Actor     string       `json:"actor"`
+	ActorKind string       `json:"actor_kind"`
+	Action    AuditAction  `json:"action"`
+	User      string       `json:"user,omitempty"`
+	Targets   []string     `json:"targets"`
+	Outcome   AuditOutcome `json:"outcome"`
+	Error     string       `json:"error,omitempty"`
+	Prev      string       `json:"prev"`
+	Hash      string       `json:"hash,omitempty"`
+}
+
+// ByUser splits e into entries per owner of items in order of first appearance, Targets of entry are uuids of owner's items.
+// If items are empty, e is returned as is.
+func (e AuditEntry) ByUser(items []NotificationDataStructured) []AuditEntry {
+	if len(items) == 0 {
+		return []AuditEntry{e}
+	}
+	res := make([]AuditEntry, 0, 1)
+	idx := make(map[uuid.UUID]int)
+	for _, v := range items {
+		i, ok := idx[v.UserUUID]
+		if !ok {
+			i = len(res)
+			idx[v.UserUUID] = i
+			u := e
+			u.User, u.Targets = v.UserUUID.String(), []string{}
+			res = append(res, u)
+		}
+		res[i].Targets = append(res[i].Targets, v.UUID.String())
+	}
+	return res
+}
@@ -0,0 +1,38 @@
+package model
+
+import "github.com/google/uuid"
+
+// Broadcast is one notification sent to list of users or to named segment
+type Broadcast struct {
+	Users       []uuid.UUID `json:"users"`
+	Segment     string      `json:"segment"`
+	Category    string      `json:"category"`
+	ObjectUUID  uuid.UUID   `json:"object_uuid"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Priority    Priority    `json:"priority,omitempty"`
+	CreatedAt   string      `json:"created_at"`
+	// AppID is app broadcast is sent by, it is taken from request identity, not from body
+	AppID string `json:"-"`
+	// Request is uuid of request broadcast is submitted by
+	Request uuid.UUID `json:"-"`
+}
+
+const (
+	BroadcastQueued    = "queued"
+	BroadcastRunning   = "running"
+	BroadcastDone      = "done"
+	BroadcastFailed    = "failed"
+	BroadcastCancelled = "cancelled"
+)
+
+// BroadcastProgress is state of broadcast, Total is unknown (0) for segment until it is read through.
+// AppID is app broadcast is sent by, only this app may read its progress.
+type BroadcastProgress struct {
+	UUID  uuid.UUID `json:"uuid"`
+	AppID string    `json:"app_id,omitempty"`
+	State string    `json:"state"`
+	Total int       `json:"total"`
+	Done  int       `json:"done"`
+	Error string    `json:"error,omitempty"`
+}
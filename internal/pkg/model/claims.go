@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// Claims are verified claims of user's token
+type Claims struct {
+	Subject   string
+	Roles     []Role
+	ExpiresAt time.Time
+}
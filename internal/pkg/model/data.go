@@ -1,3 +1,36 @@
 package model
 
-type NotificationDataStructured struct{}
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CreatedAtLayout is layout of created_at field
+const CreatedAtLayout = "2006-01-02T15:04:05.000000Z"
+
+var ErrNoRows = errors.New("no rows")
+
+// NotificationDataStructured is single notification as sent by producers
+type NotificationDataStructured struct {
+	UserUUID    uuid.UUID  `json:"user_uuid"`
+	Category    string     `json:"category"`
+	UUID        uuid.UUID  `json:"uuid"`
+	TaskUUID    *uuid.UUID `json:"task_uuid"`
+	ObjectUUID  uuid.UUID  `json:"object_uuid"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	CreatedAt   string     `json:"created_at"`
+	Priority    Priority   `json:"priority,omitempty"`
+	ReadAt      string     `json:"read_at,omitempty"`
+}
+
+// Time returns parsed created_at, zero time if it is not parsable
+func (n NotificationDataStructured) Time() time.Time {
+	t, err := time.Parse(time.RFC3339Nano, n.CreatedAt)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
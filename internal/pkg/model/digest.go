@@ -0,0 +1,17 @@
+package model
+
+import "github.com/google/uuid"
+
+// Digest is group of notifications sharing object_uuid and category
+type Digest struct {
+	UUID        uuid.UUID   `json:"uuid"`
+	UserUUID    uuid.UUID   `json:"user_uuid"`
+	ObjectUUID  uuid.UUID   `json:"object_uuid"`
+	Category    string      `json:"category"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Count       int         `json:"count"`
+	Members     []uuid.UUID `json:"members"`
+	CreatedAt   string      `json:"created_at"`
+	Priority    Priority    `json:"priority"`
+}
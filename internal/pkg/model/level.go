@@ -0,0 +1,65 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelSignal
+)
+
+// String returns level as UUIDWrapper.Str, info level is empty string
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	case LevelSignal:
+		return "SIGNAL"
+	}
+	return ""
+}
+
+// ParseLevel returns level of UUIDWrapper.Str, empty or unknown string is LevelInfo
+func ParseLevel(s string) Level {
+	for _, v := range []Level{LevelDebug, LevelWarn, LevelError, LevelSignal} {
+		if v.String() == s {
+			return v
+		}
+	}
+	return LevelInfo
+}
+
+// Name returns level name, INFO for info level
+func (l Level) Name() string {
+	if l == LevelInfo {
+		return "INFO"
+	}
+	return l.String()
+}
+
+// ParseLevelName returns level of name returned by Name, case is ignored
+func ParseLevelName(s string) (Level, error) {
+	for _, v := range []Level{LevelDebug, LevelInfo, LevelWarn, LevelError, LevelSignal} {
+		if strings.EqualFold(v.Name(), s) {
+			return v, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown level %q", s)
+}
+
+// Field is key/value pair of log record
+type Field struct {
+	Key   string
+	Value interface{}
+}
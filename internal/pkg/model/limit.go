@@ -0,0 +1,20 @@
+package model
+
+// LimitKey identifies caller whose requests are limited, empty fields are not limited
+type LimitKey struct {
+	AppID string
+	User  string
+	IP    string
+}
+
+// LimiterState is state of Limiter exposed in metrics
+type LimiterState struct {
+	Buckets int                        `json:"buckets"`
+	Routes  map[string]RouteLimitState `json:"routes"`
+}
+
+// RouteLimitState counts requests of route allowed and rejected by Limiter
+type RouteLimitState struct {
+	Allowed  uint64 `json:"allowed"`
+	Rejected uint64 `json:"rejected"`
+}
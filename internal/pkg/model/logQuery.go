@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LogQuery selects records of Saver stream. Zero UUID, zero From or To and empty Levels do not filter.
+type LogQuery struct {
+	UUID uuid.UUID
+	// From is inclusive, To is exclusive
+	From time.Time
+	To   time.Time
+	// Stream is name of Saver stream, all if empty
+	Stream string
+	Levels []Level
+}
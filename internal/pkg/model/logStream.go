@@ -0,0 +1,13 @@
+package model
+
+// LogStream is file stream of Saver. Record goes to stream if its level is one of Levels (any level if empty)
+// and it has every field of Fields with the same value.
+type LogStream struct {
+	Name string
+	// Prefix is part of file name after date, Name if empty
+	Prefix string
+	// Limit is size limit of file, Saver limit if zero
+	Limit  int64
+	Levels []Level
+	Fields map[string]string
+}
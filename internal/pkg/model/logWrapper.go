@@ -1,3 +1,11 @@
 package model
 
-type WrappedLog struct{}
+import "time"
+
+// WrappedLog is single log record with optional key/value fields
+type WrappedLog struct {
+	T  time.Time
+	UW UUIDWrapper
+	L  string
+	F  []Field
+}
@@ -0,0 +1,9 @@
+package model
+
+type OverflowPolicy string
+
+const (
+	OverflowBlock      OverflowPolicy = "block"
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	OverflowDrop       OverflowPolicy = "drop"
+)
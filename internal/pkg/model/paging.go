@@ -0,0 +1,31 @@
+package model
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const (
+	DefaultPage    = 1
+	DefaultPerPage = 10
+)
+
+// Paging returns page and per_page request parameters, defaults applied
+func Paging(p url.Values) (int, int, error) {
+	page, perPage := DefaultPage, DefaultPerPage
+	var err error
+	if v := p.Get("page"); v != "" {
+		page, err = strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return 0, 0, fmt.Errorf("in model.Paging invalid page %q", v)
+		}
+	}
+	if v := p.Get("per_page"); v != "" {
+		perPage, err = strconv.Atoi(v)
+		if err != nil || perPage < 1 {
+			return 0, 0, fmt.Errorf("in model.Paging invalid per_page %q", v)
+		}
+	}
+	return page, perPage, nil
+}
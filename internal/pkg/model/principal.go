@@ -0,0 +1,25 @@
+package model
+
+type Role string
+
+const (
+	RoleUser    Role = "user"
+	RoleSupport Role = "support"
+	RoleAdmin   Role = "admin"
+	RoleAuditor Role = "auditor"
+)
+
+// Principal is authenticated user, Subject is user_uuid of user
+type Principal struct {
+	Subject string `json:"subject"`
+	Roles   []Role `json:"roles"`
+}
+
+func (p Principal) Has(r Role) bool {
+	for _, v := range p.Roles {
+		if v == r {
+			return true
+		}
+	}
+	return false
+}
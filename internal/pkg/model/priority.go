@@ -0,0 +1,42 @@
+package model
+
+type Priority string
+
+const (
+	PriorityLow    Priority = "low"
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+	PriorityUrgent Priority = "urgent"
+)
+
+// Rank orders priorities from low (0) to urgent (3), unknown priority ranks as normal
+func (p Priority) Rank() int {
+	switch p {
+	case PriorityLow:
+		return 0
+	case PriorityHigh:
+		return 2
+	case PriorityUrgent:
+		return 3
+	}
+	return 1
+}
+
+func (p Priority) Valid() bool {
+	switch p {
+	case PriorityLow, PriorityNormal, PriorityHigh, PriorityUrgent:
+		return true
+	}
+	return false
+}
+
+// category -> default priority
+type PriorityDefaults map[string]Priority
+
+// For returns default priority of category, normal if category has none
+func (d PriorityDefaults) For(category string) Priority {
+	if p, ok := d[category]; ok {
+		return p
+	}
+	return PriorityNormal
+}
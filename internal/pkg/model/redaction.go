@@ -0,0 +1,20 @@
+package model
+
+type RedactionAction string
+
+const (
+	RedactHash RedactionAction = "hash"
+	RedactMask RedactionAction = "mask"
+	RedactDrop RedactionAction = "drop"
+)
+
+// RedactionRule changes value of field Field or parts of message and string fields matching Pattern.
+// With both Field and Pattern set only matches in the field are changed.
+// Dropped field is removed, dropped match is replaced with "[redacted]".
+type RedactionRule struct {
+	// Name is reported when rule fires, Field or Pattern if empty
+	Name    string
+	Field   string
+	Pattern string
+	Action  RedactionAction
+}
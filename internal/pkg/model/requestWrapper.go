@@ -1,5 +1,24 @@
 package model
 
-type WrappedReq struct{}
+import (
+	"net/http"
 
-type UUIDWrapper struct{}
+	"github.com/google/uuid"
+)
+
+// WrappedReq is incoming request with its uuid and already read body.
+// Op is operation of route request came to, Identity or Principal is set once app or user making request is authorized.
+type WrappedReq struct {
+	UUID      uuid.UUID
+	Req       *http.Request
+	Body      []byte
+	Op        Operation
+	Identity  AppIdentity
+	Principal Principal
+}
+
+// UUIDWrapper is uuid of request with level string ("", "ERROR", "SIGNAL")
+type UUIDWrapper struct {
+	Str  string
+	UUID uuid.UUID
+}
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// RetentionPolicy limits rotated files of log stream, zero value is not limited.
+// Compress gzips rotated files.
+type RetentionPolicy struct {
+	MaxFiles int
+	MaxBytes int64
+	MaxAge   time.Duration
+	Compress bool
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+type RotationInterval string
+
+const (
+	RotateHourly RotationInterval = "hourly"
+	RotateDaily  RotationInterval = "daily"
+)
+
+// RotationPolicy starts new file every Interval in Location (time.Local if nil).
+// Within period files are switched by size limit and numbered.
+type RotationPolicy struct {
+	Interval RotationInterval
+	Location *time.Location
+}
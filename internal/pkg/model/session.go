@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// Session is browser session of user. ID is kept in HttpOnly cookie, CSRF is sent back by client in header.
+type Session struct {
+	ID        string    `json:"-"`
+	CSRF      string    `json:"csrf_token"`
+	Principal Principal `json:"principal"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+const (
+	// SessionCookie holds session ID, it is HttpOnly
+	SessionCookie = "session"
+	// CSRFCookie holds CSRF token readable by client script
+	CSRFCookie = "csrf_token"
+	// CSRFHeader must repeat CSRFCookie in state-changing requests authorized by session
+	CSRFHeader = "X-CSRF-Token"
+)
@@ -0,0 +1,9 @@
+package model
+
+type SyncPolicy string
+
+const (
+	SyncEveryWrite SyncPolicy = "every_write"
+	SyncInterval   SyncPolicy = "interval"
+	SyncNever      SyncPolicy = "never"
+)
@@ -0,0 +1,11 @@
+package model
+
+// TokenInfo is RFC 7662 introspection response
+type TokenInfo struct {
+	Active    bool   `json:"active"`
+	Subject   string `json:"sub,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	Roles     []Role `json:"roles,omitempty"`
+}
@@ -0,0 +1,8 @@
+package runtimeops
+
+import "os"
+
+// GetSep returns path separator of current OS
+func GetSep() string {
+	return string(os.PathSeparator)
+}